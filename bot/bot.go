@@ -7,20 +7,20 @@ import (
 	"github.com/go-chi/httplog"
 	"github.com/go-chi/render"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 	"github.com/xanzy/go-gitlab"
 	"gitlab.com/jonny7/quetzal/policy"
-	"gopkg.in/yaml.v3"
 	"io"
-	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// Config is the user declared details provided from the yaml file
-// it contains general info for the bot along with a `Policies` property
+// Config is the user declared details provided from the environment,
+// it contains general info for the bot. The policies are loaded from the PolicyPath
 type Config struct {
 	User       string
 	Token      string
@@ -31,15 +31,82 @@ type Config struct {
 	Port       string
 	PolicyPath string
 	DryRun     bool
-	Policies   []policy.Policy `yaml:"policies"`
+	// Secrets are further webhook secrets that are accepted, so a secret can be rotated
+	// without rejecting webhooks that are still sent with the old one
+	Secrets []string
+	// LenientSecret accepts webhooks without a token even though a secret is configured
+	LenientSecret bool
+	// AllowedCIDRs restricts webhooks to these source networks, when empty any source is allowed
+	AllowedCIDRs []string
+	// QueuePath is the directory webhooks are queued in, when empty webhooks are processed
+	// synchronously as part of the request
+	QueuePath string
+	// Workers is the number of workers processing the queue
+	Workers int
+	// DeadLetterPath is the directory updates that failed after being retried are kept in,
+	// when empty they're only reported in the webhook's results
+	DeadLetterPath string
+	// DeliveryPath is the directory received webhooks are remembered in, when empty they're
+	// only remembered while the bot is running
+	DeliveryPath string
+	// DeliveryTTL is how long a webhook is remembered for, redeliveries within it aren't processed again
+	DeliveryTTL time.Duration
+	// LimitPath is the directory the firings of limited policies are counted in, when empty they're
+	// only counted while the bot is running
+	LimitPath string
+	// RotationPath is the directory the turns of round-robin assignments are kept in, when empty they're
+	// only kept while the bot is running
+	RotationPath string
+	// MilestoneTTL is how long a looked up milestone is kept for, before it's looked up again
+	MilestoneTTL time.Duration
+	// UserTTL is how long a looked up username or group membership is kept for, before it's looked up again
+	UserTTL time.Duration
+	// IgnoreSelf stops webhooks triggered by User, such as those sent because of the bot's own
+	// actions, from matching any policy
+	IgnoreSelf bool
+	// LoopMax is how many times a policy can fire on the same resource within the LoopWindow before
+	// it's halted as a loop, when zero loops aren't detected
+	LoopMax int
+	// LoopWindow is the period a policy's firings on a resource are counted over to detect a loop
+	LoopWindow time.Duration
+	// PolicyPollInterval is how often the policy file is checked for changes,
+	// when zero the policies are only reloaded on request or a SIGHUP
+	PolicyPollInterval time.Duration
+}
+
+// validate ensures the Config's settings can be used together. Firings are never forgotten without
+// a LoopWindow, so a policy detected as a loop would be halted on that resource for good
+func (c *Config) validate() error {
+	if c.LoopMax > 0 && c.LoopWindow <= 0 {
+		return fmt.Errorf("the loop window must be positive when loops are detected, but received: %s", c.LoopWindow)
+	}
+	return nil
 }
 
 // Bot struct encapsulates all behaviour of the bot
 type Bot struct {
-	Router *chi.Mux
-	Logger *zerolog.Logger
-	Config *Config
-	Client *gitlab.Client
+	Router      *chi.Mux
+	Logger      *zerolog.Logger
+	Config      *Config
+	Client      *gitlab.Client
+	Queue       *Queue
+	DeadLetters policy.DeadLetterStore
+	Deliveries  DeliveryStore
+	Limits      policy.LimitStore
+	Rotations   policy.RotationStore
+	Milestones  policy.MilestoneFinder
+	Changes     policy.ChangeFinder
+	Users       policy.UserFinder
+	workers     sync.WaitGroup
+	// policySet holds the current policySet, it's swapped as a whole when the policies are reloaded
+	policySet atomic.Value
+	// stop is closed when the bot is closed, stopping any background work
+	stop     chan struct{}
+	stopOnce sync.Once
+	// allowedNetworks are the parsed Config.AllowedCIDRs
+	allowedNetworks []*net.IPNet
+	// jobProcessed, when set, is called by a worker once it has processed a queued Job
+	jobProcessed func(Job)
 }
 
 // Message provides a simple message struct for times you need some
@@ -59,31 +126,71 @@ func (b *Bot) routes(r *chi.Mux) {
 	r.Get("/ping", b.ping())
 	r.Get("/policies", b.policies())
 	r.Post("/reload", b.reload())
+	// explaining looks up milestones, changes and users with the bot's token, so it needs the webhook secret
+	r.Post("/explain", b.webhookSecret(b.explain()))
+	r.Get("/queue", b.queueDepth())
+	// the dead letters act with the bot's token, so they need the webhook secret too
+	r.Get("/dead-letters", b.webhookSecret(b.deadLetters()))
+	r.Post("/dead-letters/{id}/replay", b.webhookSecret(b.replayDeadLetter()))
+	r.Delete("/dead-letters/{id}", b.webhookSecret(b.discardDeadLetter()))
+}
+
+// queueDepth endpoint reports how many webhooks are waiting to be processed
+func (b *Bot) queueDepth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if b.Queue == nil {
+			render.Respond(w, r, QueueDepth{})
+			return
+		}
+		render.Respond(w, r, b.Queue.Depth())
+	}
 }
 
 // policies endpoint returns all the loaded policies for the bot
 func (b *Bot) policies() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		render.Respond(w, r, b.Config.Policies)
+		render.Respond(w, r, b.Policies())
 	}
 }
 
-// reload will attempt to reload the bot's policies
+// reload will attempt to reload the bot's policies, the current policies
+// are kept if the policy file can't be loaded or is invalid
 func (b *Bot) reload() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		reader, err := createReader(b.Config.PolicyPath)
-		if err != nil {
+		if err := b.reloadPolicies(); err != nil {
 			w.WriteHeader(500)
-			render.Respond(w, r, Message{Msg: fmt.Sprintf("could not create reader for policy file: %v", err)})
+			render.Respond(w, r, Message{Msg: err.Error()})
 			return
 		}
-		err = b.loadPolicies(reader)
+		render.Respond(w, r, Message{Msg: "policies reloaded"})
+	}
+}
+
+// explain endpoint accepts a webhook and returns the trace of every loaded policy against it,
+// explaining which conditions passed or failed. No actions are taken
+func (b *Bot) explain() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(r.Body)
 		if err != nil {
 			w.WriteHeader(500)
-			render.Respond(w, r, Message{Msg: fmt.Sprintf("policies couldn't be reloaded: %v", err)})
+			render.Respond(w, r, nil)
 			return
 		}
-		render.Respond(w, r, Message{Msg: "policies reloaded"})
+		eventType := gitlab.HookEventType(r)
+		event, err := policy.ParseWebhook(eventType, payload)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.Respond(w, r, Message{Msg: fmt.Sprintf("Could not decode webhook: %v", err)})
+			return
+		}
+		webhook := policy.Webhook{EventType: eventType, Event: event}
+		results, ok := webhook.Explain(b.Policies(), b.options())
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			render.Respond(w, r, Message{Msg: fmt.Sprintf("webhooks of type %s are not supported", eventType)})
+			return
+		}
+		render.Respond(w, r, results)
 	}
 }
 
@@ -95,12 +202,12 @@ func (b *Bot) ping() http.HandlerFunc {
 }
 
 // processWebhook is the main endpoint for this bot
-// and bridges user specified plugins and the gitlab webhook
+// and bridges user specified plugins and the gitlab webhook.
+// When the bot has a Queue the webhook is queued and accepted straight away,
+// otherwise, or during a dry run, it is processed as part of the request. A webhook that has already
+// been received is not processed again, the original delivery is returned instead
 func (b *Bot) processWebhook() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		done := make(chan struct{})
-		defer close(done)
-
 		payload, err := io.ReadAll(r.Body)
 		if err != nil {
 			w.WriteHeader(500)
@@ -108,34 +215,155 @@ func (b *Bot) processWebhook() http.HandlerFunc {
 			return
 		}
 		eventType := gitlab.HookEventType(r)
-		event, err := gitlab.ParseWebhook(eventType, payload)
+		event, err := policy.ParseWebhook(eventType, payload)
 		if err != nil {
 			render.Respond(w, r, Message{Msg: fmt.Sprintf("Could not decode webhook: %v", err)})
 			return
 		}
-		webhook := policy.Webhook{
-			EventType: eventType,
-			Event:     event,
+
+		delivery, claimed, err := b.claimDelivery(r.Header.Get(eventUUIDHeader))
+		if err != nil {
+			w.WriteHeader(500)
+			render.Respond(w, r, Message{Msg: fmt.Sprintf("webhook delivery could not be recorded: %v", err)})
+			return
+		}
+		if !claimed {
+			render.Respond(w, r, Duplicate{Msg: fmt.Sprintf("webhook %s has already been received", delivery.UUID), Delivery: delivery})
+			return
 		}
 
-		preparedPolicies := b.preparePolicies(done)
-		workers := make([]<-chan policy.WebhookResult, runtime.NumCPU())
-		for i := 0; i < runtime.NumCPU(); i++ {
-			workers[i] = webhook.FilterEvent(preparedPolicies, b.Client)
+		// a dry run is processed straight away, so the response can report the requests that would have been made
+		if b.Queue != nil && !b.Config.DryRun {
+			// the delivery is marked as queued first, as a worker may finish the job before Enqueue returns
+			delivery.Status = deliveryStatusQueued
+			b.completeDelivery(delivery)
+			job, queueErr := b.Queue.Enqueue(eventType, delivery.UUID, payload)
+			if queueErr != nil {
+				b.releaseDelivery(delivery)
+				w.WriteHeader(500)
+				render.Respond(w, r, Message{Msg: fmt.Sprintf("webhook could not be queued: %v", queueErr)})
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			render.Respond(w, r, Message{Msg: fmt.Sprintf("webhook queued as job %s", job.ID)})
+			return
 		}
 
-		validPolicies := mergePolicies(workers...)
-		var p []policy.WebhookResult
-		for v := range validPolicies {
-			p = append(p, v)
+		results := b.process(policy.Webhook{EventType: eventType, Event: event})
+		delivery.Status, delivery.Results = deliveryStatusProcessed, results
+		b.completeDelivery(delivery)
+		render.Respond(w, r, results)
+	}
+}
+
+// process runs the webhook against every loaded policy
+func (b *Bot) process(webhook policy.Webhook) []policy.WebhookResult {
+	done := make(chan struct{})
+	defer close(done)
+
+	// the policies are read once, so a reload part way through doesn't mix two policy sets
+	policies := b.Policies()
+	if help, ok := webhook.Help(b.Config.User, policies, b.Client, b.options()); ok {
+		return []policy.WebhookResult{help}
+	}
+
+	preparedPolicies := preparePolicies(done, policies)
+	workers := make([]<-chan policy.WebhookResult, runtime.NumCPU())
+	for i := 0; i < runtime.NumCPU(); i++ {
+		workers[i] = webhook.FilterEvent(preparedPolicies, b.Client, b.options())
+	}
+
+	validPolicies := mergePolicies(workers...)
+	var p []policy.WebhookResult
+	for v := range validPolicies {
+		p = append(p, v)
+	}
+	return p
+}
+
+// startWorkers starts the configured number of workers to drain the Queue
+func (b *Bot) startWorkers() {
+	workers := b.Config.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	b.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer b.workers.Done()
+			for {
+				job, ok := b.Queue.Dequeue()
+				if !ok {
+					return
+				}
+				b.processJob(job)
+				if b.jobProcessed != nil {
+					b.jobProcessed(job)
+				}
+			}
+		}()
+	}
+}
+
+// processJob processes a queued webhook and removes it from the Queue
+func (b *Bot) processJob(job Job) {
+	event, err := policy.ParseWebhook(job.EventType, job.Payload)
+	if err != nil {
+		b.Logger.Error().Msg(fmt.Sprintf("queued job %s could not be decoded: %v", job.ID, err))
+	} else {
+		results := b.process(policy.Webhook{EventType: job.EventType, Event: event})
+		b.Logger.Info().Interface("results", results).Msg(fmt.Sprintf("processed job %s", job.ID))
+		b.completeJobDelivery(job, results)
+	}
+	if err = b.Queue.Ack(job); err != nil {
+		b.Logger.Error().Msg(fmt.Sprintf("queued job %s could not be removed: %v", job.ID, err))
+	}
+}
+
+// completeJobDelivery records the results of a queued webhook against its Delivery
+func (b *Bot) completeJobDelivery(job Job, results []policy.WebhookResult) {
+	if job.UUID == "" {
+		return
+	}
+	b.completeDelivery(Delivery{
+		UUID:       job.UUID,
+		Status:     deliveryStatusProcessed,
+		JobID:      job.ID,
+		ReceivedAt: job.ReceivedAt,
+		ExpiresAt:  job.ReceivedAt.Add(b.deliveryTTL()),
+		Results:    results,
+	})
+}
+
+// Close stops watching the policies and stops the workers once they have finished their current Job,
+// along with any dead letters being replayed
+func (b *Bot) Close() {
+	b.stopOnce.Do(func() {
+		if b.stop != nil {
+			close(b.stop)
 		}
+	})
+	if b.Queue != nil {
+		b.Queue.Close()
+	}
+	b.workers.Wait()
+}
 
-		render.Respond(w, r, p)
+// options are the policy.Options derived from the bot's Config
+func (b *Bot) options() policy.Options {
+	opts := policy.Options{DryRun: b.Config.DryRun, DeadLetters: b.DeadLetters, Limits: b.Limits, Milestones: b.Milestones, Changes: b.Changes, Users: b.Users, Rotations: b.Rotations}
+	if b.Config.IgnoreSelf {
+		opts.Self = b.Config.User
+	}
+	if b.Config.LoopMax > 0 {
+		opts.Loop = &policy.Loop{Max: b.Config.LoopMax, Window: b.Config.LoopWindow}
 	}
+	return opts
 }
 
 func (b *Bot) newClient() error {
-	client, err := gitlab.NewClient(b.Config.Token, gitlab.WithBaseURL(b.Config.Host))
+	// go-gitlab's own retries are turned off, so an Action's Retry is the only one and its attempts are counted
+	client, err := gitlab.NewClient(b.Config.Token, gitlab.WithBaseURL(b.Config.Host), gitlab.WithoutRetries())
 	if err != nil {
 		return err
 	}
@@ -168,11 +396,11 @@ func mergePolicies(incoming ...<-chan policy.WebhookResult) <-chan policy.Webhoo
 }
 
 // preparePolicies creates a channel of policies to process concurrently.
-func (b *Bot) preparePolicies(done <-chan struct{}) <-chan policy.Policy {
+func preparePolicies(done <-chan struct{}, policies []policy.Policy) <-chan policy.Policy {
 	out := make(chan policy.Policy)
 	go func() {
 		defer close(out)
-		for _, ruleSet := range b.Config.Policies {
+		for _, ruleSet := range policies {
 			select {
 			case <-done:
 				return
@@ -192,31 +420,6 @@ func createReader(file string) (io.ReadCloser, error) {
 	return f, err
 }
 
-// loadPolicies loads the specified policies.yml file
-func (b *Bot) loadPolicies(reader io.ReadCloser) error {
-	defer func(reader io.ReadCloser) {
-		err := reader.Close()
-		if err != nil {
-			b.Logger.Error().Msg(fmt.Sprintf("the config file failed to close: %v", err))
-		}
-	}(reader)
-
-	body, err := ioutil.ReadAll(reader)
-	if err != nil {
-		log.Error().Msg(fmt.Sprintf("policy file could not be read, error:%v", err))
-		return err
-	}
-
-	var policies policy.Policies
-	err = yaml.Unmarshal(body, &policies)
-	if err != nil {
-		b.Logger.Info().Msg(fmt.Sprintf("policy file could not be unmarshalled, error:%v", err))
-		return err
-	}
-	b.Config.Policies = policies.Policies
-	return nil
-}
-
 // validatePolicies validates all the policies and fields where only certain values are allowed
 func (b *Bot) validatePolicies(policies <-chan policy.Policy) <-chan error {
 	ch := make(chan error)
@@ -231,15 +434,20 @@ func (b *Bot) validatePolicies(policies <-chan policy.Policy) <-chan error {
 
 // New creates a new bot taking the config filename and path from `main`'s arguments
 func New(config Config, policies string) (*Bot, error) {
-	done := make(chan struct{})
-	defer close(done)
-
 	logger := zerolog.New(os.Stdout)
 
 	b := &Bot{
 		Router: chi.NewRouter(),
 		Logger: &logger,
 		Config: &config,
+		stop:   make(chan struct{}),
+	}
+	if b.Config.PolicyPath == "" {
+		b.Config.PolicyPath = policies
+	}
+	if err := b.Config.validate(); err != nil {
+		b.Logger.Fatal().Msg(fmt.Sprintf("config is invalid: %v", err))
+		return nil, err
 	}
 
 	p, err := createReader(policies)
@@ -250,17 +458,10 @@ func New(config Config, policies string) (*Bot, error) {
 		b.Logger.Fatal().Msg(fmt.Sprintf("policies couldn't be loaded: %v", err))
 	}
 
-	policiesToValidate := b.preparePolicies(done)
-	workers := make([]<-chan error, runtime.NumCPU())
-	for i := 0; i < runtime.NumCPU(); i++ {
-		workers[i] = b.validatePolicies(policiesToValidate)
-	}
-	validated := mergeErrors(done, workers...)
-
-	for v := range validated {
-		if v != nil {
-			b.Logger.Fatal().Msg(fmt.Sprintf("invalid policy: %v", v))
-		}
+	b.allowedNetworks, err = parseCIDRs(b.Config.AllowedCIDRs)
+	if err != nil {
+		b.Logger.Fatal().Msg(fmt.Sprintf("allowed webhook sources couldn't be parsed: %v", err))
+		return nil, err
 	}
 
 	b.Router.Use(render.SetContentType(render.ContentTypeJSON))
@@ -273,6 +474,55 @@ func New(config Config, policies string) (*Bot, error) {
 		b.Logger.Fatal().Msg(fmt.Sprintf("gitlab client couldn't be established: %v", err))
 		return nil, err
 	}
+	b.Milestones = NewMilestoneCache(b.Client, b.Config.MilestoneTTL)
+	b.Changes = NewChangeCache(b.Client)
+	b.Users = NewUserCache(b.Client, b.Config.UserTTL)
+
+	if b.Config.DeadLetterPath != "" {
+		store, storeErr := NewFileDeadLetterStore(b.Config.DeadLetterPath)
+		if storeErr != nil {
+			b.Logger.Fatal().Msg(fmt.Sprintf("dead letter store couldn't be opened: %v", storeErr))
+			return nil, storeErr
+		}
+		b.DeadLetters = store
+	}
+
+	b.Deliveries = NewMemoryDeliveryStore()
+	if b.Config.DeliveryPath != "" {
+		b.Deliveries, err = NewFileDeliveryStore(b.Config.DeliveryPath)
+		if err != nil {
+			b.Logger.Fatal().Msg(fmt.Sprintf("delivery store couldn't be opened: %v", err))
+			return nil, err
+		}
+	}
+
+	b.Limits = NewMemoryLimitStore()
+	if b.Config.LimitPath != "" {
+		b.Limits, err = NewFileLimitStore(b.Config.LimitPath)
+		if err != nil {
+			b.Logger.Fatal().Msg(fmt.Sprintf("limit store couldn't be opened: %v", err))
+			return nil, err
+		}
+	}
+
+	b.Rotations = NewMemoryRotationStore()
+	if b.Config.RotationPath != "" {
+		b.Rotations, err = NewFileRotationStore(b.Config.RotationPath)
+		if err != nil {
+			b.Logger.Fatal().Msg(fmt.Sprintf("rotation store couldn't be opened: %v", err))
+			return nil, err
+		}
+	}
+
+	if b.Config.QueuePath != "" {
+		b.Queue, err = NewQueue(b.Config.QueuePath)
+		if err != nil {
+			b.Logger.Fatal().Msg(fmt.Sprintf("webhook queue couldn't be opened: %v", err))
+			return nil, err
+		}
+		b.startWorkers()
+	}
+	b.watchPolicies()
 
 	return b, nil
 }
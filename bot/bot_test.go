@@ -4,12 +4,14 @@ import (
 	"encoding/json"
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
+	"github.com/xanzy/go-gitlab"
 	"gitlab.com/jonny7/quetzal/policy"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestReload(t *testing.T) {
@@ -33,8 +35,8 @@ func TestReload(t *testing.T) {
 		t.Errorf("expected %d, but got: %d", want, got)
 	}
 
-	if len(b.Config.Policies) != 2 {
-		t.Errorf("expected 2 policies, recevied %d", len(b.Config.Policies))
+	if len(b.Policies()) != 2 {
+		t.Errorf("expected 2 policies, recevied %d", len(b.Policies()))
 	}
 }
 
@@ -71,14 +73,14 @@ func TestLoadPolicies(t *testing.T) {
 	reader, _ := createReader("../examples/.policies.yaml")
 	_ = b.loadPolicies(reader)
 
-	if len(b.Config.Policies) != 2 {
-		t.Errorf("expected 2 policies, but got: %v", len(b.Config.Policies))
+	if len(b.Policies()) != 2 {
+		t.Errorf("expected 2 policies, but got: %v", len(b.Policies()))
 	}
-	if b.Config.Policies[0].Name != "assign MR" {
-		t.Errorf("expected name to be `%s`, but got: %s", "assign mr", b.Config.Policies[0].Name)
+	if b.Policies()[0].Name != "assign MR" {
+		t.Errorf("expected name to be `%s`, but got: %s", "assign mr", b.Policies()[0].Name)
 	}
-	if b.Config.Policies[1].Actions.RemoveLabels[0] != "done" {
-		t.Errorf("expected name to be `%s`, but got: %s", "done", b.Config.Policies[1].Actions.RemoveLabels[0])
+	if b.Policies()[1].Actions.RemoveLabels[0] != "done" {
+		t.Errorf("expected name to be `%s`, but got: %s", "done", b.Policies()[1].Actions.RemoveLabels[0])
 	}
 }
 
@@ -159,7 +161,199 @@ func TestNew(t *testing.T) {
 	if err != nil {
 		t.Errorf("failed to init bot, %v", err)
 	}
-	if len(bot.Config.Policies) != 2 {
-		t.Errorf("expected 2 policies to be on the bot, but got %d", len(bot.Config.Policies))
+	if len(bot.Policies()) != 2 {
+		t.Errorf("expected 2 policies to be on the bot, but got %d", len(bot.Policies()))
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	data := []struct {
+		name          string
+		config        Config
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "Loop detection", config: Config{LoopMax: 5, LoopWindow: 10 * time.Minute}, expectedIsNil: true, errMsg: "expected nil for a loop window"},
+		{name: "No loop detection", config: Config{}, expectedIsNil: true, errMsg: "expected nil as loops aren't detected"},
+		{name: "Zero loop window", config: Config{LoopMax: 5}, expectedIsNil: false, errMsg: "expected an error as the firings would never be forgotten"},
+		{name: "Negative loop window", config: Config{LoopMax: 5, LoopWindow: -time.Minute}, expectedIsNil: false, errMsg: "expected an error for a negative loop window"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if err := d.config.validate(); (err == nil) != d.expectedIsNil {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestProcessWebhookQueued(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create queue: %v", err)
+	}
+	b := Bot{
+		Router: chi.NewRouter(),
+		Logger: &zerolog.Logger{},
+		Config: &Config{Endpoint: "/webhook-endpoint", Workers: 1},
+		Queue:  q,
+	}
+	b.routes(b.Router)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/webhook-endpoint", strings.NewReader(`{"object_kind":"merge_request"}`))
+	req.Header.Set("X-Gitlab-Event", string(gitlab.EventTypeMergeRequest))
+	b.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("expected %d, but got: %d", http.StatusAccepted, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/queue", nil)
+	b.ServeHTTP(w, req)
+
+	var depth QueueDepth
+	if err = json.NewDecoder(w.Body).Decode(&depth); err != nil {
+		t.Errorf("response couldn't be decoded: %v", err)
+	}
+	if depth.Pending != 1 {
+		t.Errorf("expected 1 pending webhook, got %+v", depth)
+	}
+
+	processed := make(chan Job, 1)
+	b.jobProcessed = func(job Job) { processed <- job }
+	b.startWorkers()
+	select {
+	case <-processed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the queued webhook to be processed")
+	}
+	b.Close()
+	if depth := q.Depth(); depth != (QueueDepth{}) {
+		t.Errorf("expected the queue to be empty, got %+v", depth)
+	}
+}
+
+func TestProcessWebhookDryRunNotQueued(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create queue: %v", err)
+	}
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL("https://gitlab.example.com"))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	b := Bot{
+		Router: chi.NewRouter(),
+		Logger: &zerolog.Logger{},
+		Config: &Config{Endpoint: "/webhook-endpoint", DryRun: true},
+		Client: client,
+		Queue:  q,
+	}
+	_ = b.loadPolicies(io.NopCloser(strings.NewReader(`policies:
+  - name: comment
+    resource: Merge Request Hook
+    actions:
+      comment: hello`)))
+	b.routes(b.Router)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/webhook-endpoint", strings.NewReader(`{"object_kind":"merge_request"}`))
+	req.Header.Set("X-Gitlab-Event", string(gitlab.EventTypeMergeRequest))
+	b.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, but got: %d", http.StatusOK, w.Code)
+	}
+	var results []policy.WebhookResult
+	if err = json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("response couldn't be decoded: %v", err)
+	}
+	if len(results) != 1 || len(results[0].Actions) != 1 || !results[0].Actions[0].DryRun {
+		t.Errorf("expected the response to report the dry run's request, got %+v", results)
+	}
+	if depth := b.Queue.Depth(); depth.Pending != 0 {
+		t.Errorf("expected the dry run not to be queued, got %+v", depth)
+	}
+}
+
+func TestProcessWebhookInvalid(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create queue: %v", err)
+	}
+	b := Bot{
+		Router: chi.NewRouter(),
+		Logger: &zerolog.Logger{},
+		Config: &Config{Endpoint: "/webhook-endpoint"},
+		Queue:  q,
+	}
+	b.routes(b.Router)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/webhook-endpoint", strings.NewReader(`{}`))
+	req.Header.Set("X-Gitlab-Event", "Unknown Hook")
+	b.ServeHTTP(w, req)
+
+	if b.Queue.Depth().Pending != 0 {
+		t.Errorf("expected an undecodable webhook not to be queued")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	b := Bot{
+		Router: chi.NewRouter(),
+		Logger: &zerolog.Logger{},
+		Config: &Config{Endpoint: "/webhook-endpoint", Secret: "s3cret"},
+	}
+	_ = b.loadPolicies(io.NopCloser(strings.NewReader(`policies:
+  - name: open merge requests
+    resource: Merge Request Hook
+    conditions:
+      state:
+        - open
+  - name: merged merge requests
+    resource: Merge Request Hook
+    conditions:
+      state:
+        - merge`)))
+	b.routes(b.Router)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/explain", strings.NewReader(`{"object_kind":"merge_request","object_attributes":{"action":"open"}}`))
+	req.Header.Set("X-Gitlab-Event", string(gitlab.EventTypeMergeRequest))
+	req.Header.Set("X-Gitlab-Token", "s3cret")
+	b.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, but got: %d", http.StatusOK, w.Code)
+	}
+	var results []policy.WebhookResult
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("response couldn't be decoded: %v", err)
+	}
+	if len(results) != 2 || !results[0].Matched || results[1].Matched {
+		t.Fatalf("expected only the first policy to match, got %+v", results)
+	}
+	if state := results[1].Trace[1]; state.Condition != "state" || state.Passed || state.Actual != "open" {
+		t.Errorf("expected the state condition to explain the failure, got %+v", state)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/explain", strings.NewReader(`{`))
+	req.Header.Set("X-Gitlab-Event", string(gitlab.EventTypeMergeRequest))
+	req.Header.Set("X-Gitlab-Token", "s3cret")
+	b.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected %d, but got: %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/explain", strings.NewReader(`{"object_kind":"merge_request"}`))
+	req.Header.Set("X-Gitlab-Event", string(gitlab.EventTypeMergeRequest))
+	b.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected explaining without the secret to be refused, but got: %d", w.Code)
 	}
 }
@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"sync"
+)
+
+// maxCachedChanges is how many merge requests' changes a ChangeCache keeps, the oldest are dropped first
+const maxCachedChanges = 500
+
+// ChangeCache is a policy.ChangeFinder that looks up the files merge requests change with the GitLab API.
+// The changes of a merge request don't change until it's pushed to, so they're kept against its latest commit
+type ChangeCache struct {
+	client *gitlab.Client
+	mu     sync.Mutex
+	cached map[string][]string
+	// order is the keys from oldest to newest, so the oldest can be dropped
+	order []string
+}
+
+// NewChangeCache creates an empty ChangeCache
+func NewChangeCache(client *gitlab.Client) *ChangeCache {
+	return &ChangeCache{client: client, cached: map[string][]string{}}
+}
+
+// ChangedPaths returns the old and new path of every file the merge request changes
+func (c *ChangeCache) ChangedPaths(project, mergeRequest int, sha string) ([]string, error) {
+	key := fmt.Sprintf("%d/%d/%s", project, mergeRequest, sha)
+	c.mu.Lock()
+	paths, ok := c.cached[key]
+	c.mu.Unlock()
+	if ok {
+		return paths, nil
+	}
+
+	mr, _, err := c.client.MergeRequests.GetMergeRequestChanges(project, mergeRequest, nil)
+	if err != nil {
+		return nil, err
+	}
+	paths = []string{}
+	for _, change := range mr.Changes {
+		paths = append(paths, change.NewPath)
+		if change.OldPath != change.NewPath {
+			paths = append(paths, change.OldPath)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// a merge request without a commit can't be told apart from its next push, so it isn't kept
+	if _, exists := c.cached[key]; !exists && sha != "" {
+		c.cached[key] = paths
+		c.order = append(c.order, key)
+		if len(c.order) > maxCachedChanges {
+			delete(c.cached, c.order[0])
+			c.order = c.order[1:]
+		}
+	}
+	return paths, nil
+}
+
+// Diffs returns the merge request with the diff of each of its changes. They're requested as raw diffs, so
+// GitLab doesn't leave out large ones, and they aren't cached as they're only needed once for each push
+func (c *ChangeCache) Diffs(project, mergeRequest int) (*gitlab.MergeRequest, error) {
+	mr, _, err := c.client.MergeRequests.GetMergeRequestChanges(project, mergeRequest, &gitlab.GetMergeRequestChangesOptions{AccessRawDiffs: gitlab.Bool(true)})
+	return mr, err
+}
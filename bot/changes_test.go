@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestChangeCache(t *testing.T) {
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/merge_requests/7/changes", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"iid": 7, "changes": [
+			{"old_path": "docs/index.md", "new_path": "docs/index.md"},
+			{"old_path": "docs/old.md", "new_path": "docs/new.md", "renamed_file": true}
+		]}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	cache := NewChangeCache(client)
+	expected := []string{"docs/index.md", "docs/new.md", "docs/old.md"}
+	for i := 0; i < 2; i++ {
+		paths, findErr := cache.ChangedPaths(1, 7, "abc")
+		if findErr != nil || !reflect.DeepEqual(paths, expected) {
+			t.Fatalf("expected %v, got %v and error %v", expected, paths, findErr)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected the changes to be cached, but they were requested %d times", requests)
+	}
+	if _, err = cache.ChangedPaths(1, 7, "def"); err != nil || requests != 2 {
+		t.Errorf("expected the changes to be looked up again after a push")
+	}
+	if _, err = cache.ChangedPaths(1, 8, "abc"); err == nil {
+		t.Errorf("expected an error for an unknown merge request")
+	}
+}
+
+func TestChangeCacheDiffs(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/merge_requests/7/changes", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_raw_diffs") != "true" {
+			t.Errorf("expected raw diffs to be requested, got %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"iid": 7, "changes_count": "1", "changes": [{"old_path": "main.go", "new_path": "main.go", "diff": "+new"}]}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	mr, err := NewChangeCache(client).Diffs(1, 7)
+	if err != nil || len(mr.Changes) != 1 || mr.Changes[0].Diff != "+new" {
+		t.Errorf("expected the merge request's diffs, got %+v and error %v", mr, err)
+	}
+}
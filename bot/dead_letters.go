@@ -0,0 +1,207 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"gitlab.com/jonny7/quetzal/policy"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errDeadLetterNotFound is returned when a DeadLetter doesn't exist in the store
+var errDeadLetterNotFound = errors.New("dead letter not found")
+
+// FileDeadLetterStore is a policy.DeadLetterStore that keeps each DeadLetter in its own file
+type FileDeadLetterStore struct {
+	dir string
+	mu  sync.Mutex
+	seq uint64
+}
+
+// NewFileDeadLetterStore creates the store's directory if needed
+func NewFileDeadLetterStore(dir string) (*FileDeadLetterStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileDeadLetterStore{dir: dir}, nil
+}
+
+// Put saves the DeadLetter, assigning it an ID if it doesn't have one
+func (s *FileDeadLetterStore) Put(letter policy.DeadLetter) (policy.DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if letter.ID == "" {
+		s.seq++
+		letter.ID = fmt.Sprintf("%020d-%06d", time.Now().UnixNano(), s.seq%1000000)
+	}
+	path, err := s.path(letter.ID)
+	if err != nil {
+		return letter, err
+	}
+	return letter, writeJSON(path, letter)
+}
+
+// Get returns the DeadLetter with the given ID
+func (s *FileDeadLetterStore) Get(id string) (policy.DeadLetter, error) {
+	var letter policy.DeadLetter
+	path, err := s.path(id)
+	if err != nil {
+		return letter, err
+	}
+	err = readJSON(path, &letter)
+	if os.IsNotExist(err) {
+		return letter, errDeadLetterNotFound
+	}
+	return letter, err
+}
+
+// List returns every DeadLetter, oldest first
+func (s *FileDeadLetterStore) List() ([]policy.DeadLetter, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), jobExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	letters := []policy.DeadLetter{}
+	for _, name := range names {
+		letter, getErr := s.Get(strings.TrimSuffix(name, jobExt))
+		if getErr != nil {
+			return nil, getErr
+		}
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
+
+// Delete removes the DeadLetter with the given ID
+func (s *FileDeadLetterStore) Delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return errDeadLetterNotFound
+	}
+	return err
+}
+
+// path ensures an ID can't be used to reach outside the store's directory
+func (s *FileDeadLetterStore) path(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid dead letter id: %s", id)
+	}
+	return filepath.Join(s.dir, id+jobExt), nil
+}
+
+// deadLetters endpoint lists the updates that failed after being retried
+func (b *Bot) deadLetters() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if b.DeadLetters == nil {
+			render.Respond(w, r, []policy.DeadLetter{})
+			return
+		}
+		letters, err := b.DeadLetters.List()
+		if err != nil {
+			w.WriteHeader(500)
+			render.Respond(w, r, Message{Msg: fmt.Sprintf("dead letters couldn't be listed: %v", err)})
+			return
+		}
+		render.Respond(w, r, letters)
+	}
+}
+
+// replayDeadLetter endpoint runs a failed update again in the background, as its retries can wait between
+// attempts. It is removed from the store when it succeeds, otherwise it's kept with the latest error
+func (b *Bot) replayDeadLetter() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		letter, ok := b.deadLetter(w, r)
+		if !ok {
+			return
+		}
+		if err := policy.CheckReplay(letter, b.options()); err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			render.Respond(w, r, Message{Msg: fmt.Sprintf("dead letter couldn't be replayed: %v", err)})
+			return
+		}
+		b.workers.Add(1)
+		go func() {
+			defer b.workers.Done()
+			b.replay(letter)
+		}()
+		w.WriteHeader(http.StatusAccepted)
+		render.Respond(w, r, Message{Msg: fmt.Sprintf("dead letter %s is being replayed", letter.ID)})
+	}
+}
+
+// replay runs the DeadLetter's update again and records the outcome in the store
+func (b *Bot) replay(letter policy.DeadLetter) {
+	replayed, succeeded, err := policy.Replay(letter, b.Client, b.options())
+	if err != nil {
+		b.Logger.Error().Msg(fmt.Sprintf("dead letter %s couldn't be replayed: %v", letter.ID, err))
+		return
+	}
+	if succeeded {
+		err = b.DeadLetters.Delete(replayed.ID)
+	} else {
+		_, err = b.DeadLetters.Put(replayed)
+	}
+	if err != nil {
+		b.Logger.Error().Msg(fmt.Sprintf("dead letter %s couldn't be updated: %v", letter.ID, err))
+		return
+	}
+	if !succeeded {
+		b.Logger.Error().Msg(fmt.Sprintf("dead letter %s failed again: %s", letter.ID, replayed.Error))
+		return
+	}
+	b.Logger.Info().Msg(fmt.Sprintf("dead letter %s replayed", letter.ID))
+}
+
+// discardDeadLetter endpoint removes a failed update without replaying it
+func (b *Bot) discardDeadLetter() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		letter, ok := b.deadLetter(w, r)
+		if !ok {
+			return
+		}
+		if err := b.DeadLetters.Delete(letter.ID); err != nil {
+			w.WriteHeader(500)
+			render.Respond(w, r, Message{Msg: fmt.Sprintf("dead letter couldn't be discarded: %v", err)})
+			return
+		}
+		render.Respond(w, r, Message{Msg: fmt.Sprintf("dead letter %s discarded", letter.ID)})
+	}
+}
+
+// deadLetter finds the DeadLetter from the `id` url param, responding with an error if it can't
+func (b *Bot) deadLetter(w http.ResponseWriter, r *http.Request) (policy.DeadLetter, bool) {
+	if b.DeadLetters == nil {
+		w.WriteHeader(http.StatusNotFound)
+		render.Respond(w, r, Message{Msg: "dead letters are not enabled"})
+		return policy.DeadLetter{}, false
+	}
+	letter, err := b.DeadLetters.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, errDeadLetterNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		render.Respond(w, r, Message{Msg: err.Error()})
+		return policy.DeadLetter{}, false
+	}
+	return letter, true
+}
@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/xanzy/go-gitlab"
+	"gitlab.com/jonny7/quetzal/policy"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFileDeadLetterStore(t *testing.T) {
+	store, err := NewFileDeadLetterStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	letter, err := store.Put(policy.DeadLetter{Policy: "comment", EventType: gitlab.EventTypeMergeRequest, Error: "502 bad gateway"})
+	if err != nil || letter.ID == "" {
+		t.Fatalf("expected the dead letter to be stored with an id, got %q and error %v", letter.ID, err)
+	}
+	second, _ := store.Put(policy.DeadLetter{Policy: "label"})
+
+	got, err := store.Get(letter.ID)
+	if err != nil || got.Policy != "comment" || got.Error != "502 bad gateway" {
+		t.Errorf("expected the stored dead letter, got %+v and error %v", got, err)
+	}
+
+	letters, err := store.List()
+	if err != nil || len(letters) != 2 || letters[0].ID != letter.ID || letters[1].ID != second.ID {
+		t.Errorf("expected 2 dead letters in the order stored, got %+v and error %v", letters, err)
+	}
+
+	if err = store.Delete(letter.ID); err != nil {
+		t.Errorf("failed to delete dead letter: %v", err)
+	}
+	if _, err = store.Get(letter.ID); err != errDeadLetterNotFound {
+		t.Errorf("expected a deleted dead letter to be not found, got %v", err)
+	}
+	if _, err = store.Get("../queue"); err == nil {
+		t.Errorf("expected an id outside the store to be rejected")
+	}
+}
+
+func TestDeadLetterEndpoints(t *testing.T) {
+	store, err := NewFileDeadLetterStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	letter, _ := store.Put(policy.DeadLetter{Policy: "comment"})
+
+	b := Bot{
+		Router:      chi.NewRouter(),
+		Logger:      &zerolog.Logger{},
+		Config:      &Config{Endpoint: "/webhook-endpoint"},
+		DeadLetters: store,
+	}
+	b.routes(b.Router)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/dead-letters", nil)
+	b.ServeHTTP(w, req)
+
+	var letters []policy.DeadLetter
+	if err = json.NewDecoder(w.Body).Decode(&letters); err != nil || len(letters) != 1 {
+		t.Errorf("expected 1 dead letter, got %+v and error %v", letters, err)
+	}
+
+	data := []struct {
+		name     string
+		method   string
+		path     string
+		expected int
+	}{
+		{name: "Replay unknown", method: http.MethodPost, path: "/dead-letters/missing/replay", expected: http.StatusNotFound},
+		{name: "Replay unsupported event", method: http.MethodPost, path: "/dead-letters/" + letter.ID + "/replay", expected: http.StatusUnprocessableEntity},
+		{name: "Discard", method: http.MethodDelete, path: "/dead-letters/" + letter.ID, expected: http.StatusOK},
+		{name: "Discard again", method: http.MethodDelete, path: "/dead-letters/" + letter.ID, expected: http.StatusNotFound},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(d.method, d.path, nil)
+			b.ServeHTTP(w, req)
+			if w.Code != d.expected {
+				t.Errorf("expected %d, but got: %d", d.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestDeadLetterEndpointsNeedSecret(t *testing.T) {
+	store, err := NewFileDeadLetterStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	letter, _ := store.Put(policy.DeadLetter{Policy: "comment"})
+
+	b := Bot{
+		Router:      chi.NewRouter(),
+		Logger:      &zerolog.Logger{},
+		Config:      &Config{Endpoint: "/webhook-endpoint", Secret: "s3cret"},
+		DeadLetters: store,
+	}
+	b.routes(b.Router)
+
+	for _, d := range []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/dead-letters"},
+		{http.MethodPost, "/dead-letters/" + letter.ID + "/replay"},
+		{http.MethodDelete, "/dead-letters/" + letter.ID},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(d.method, d.path, nil)
+		b.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("expected %s %s to need the secret, but got: %d", d.method, d.path, w.Code)
+		}
+	}
+	if _, err = store.Get(letter.ID); err != nil {
+		t.Errorf("expected the dead letter to be kept, got %v", err)
+	}
+}
+
+func TestReplayDeadLetterInBackground(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/merge_requests/234/notes", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id": 1}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL(server.URL), gitlab.WithoutRetries())
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	store, err := NewFileDeadLetterStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	event := gitlab.MergeEvent{}
+	event.Project.ID = 1
+	event.ObjectAttributes.IID = 234
+	encoded, _ := json.Marshal(event)
+	letter, _ := store.Put(policy.DeadLetter{Policy: "comment", EventType: gitlab.EventTypeMergeRequest, Event: encoded, Action: policy.Action{Comment: "hello"}, Update: "note"})
+
+	b := Bot{
+		Router:      chi.NewRouter(),
+		Logger:      &zerolog.Logger{},
+		Config:      &Config{Endpoint: "/webhook-endpoint"},
+		Client:      client,
+		DeadLetters: store,
+	}
+	b.routes(b.Router)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/dead-letters/"+letter.ID+"/replay", nil)
+	b.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected the replay to be accepted, but got: %d", w.Code)
+	}
+	b.Close()
+	if _, err = store.Get(letter.ID); err != errDeadLetterNotFound {
+		t.Errorf("expected the replayed dead letter to be removed, got %v", err)
+	}
+}
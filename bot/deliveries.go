@@ -0,0 +1,225 @@
+package bot
+
+import (
+	"fmt"
+	"gitlab.com/jonny7/quetzal/policy"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventUUIDHeader identifies a webhook delivery, GitLab sends the same UUID when it redelivers a webhook
+const eventUUIDHeader = "X-Gitlab-Event-UUID"
+
+// defaultDeliveryTTL is how long a delivery is remembered when no TTL is given
+const defaultDeliveryTTL = 24 * time.Hour
+
+// deliveryStatus reports how far a Delivery has got
+type deliveryStatus string
+
+const (
+	deliveryStatusQueued    deliveryStatus = "queued"
+	deliveryStatusProcessed deliveryStatus = "processed"
+)
+
+// Delivery is a webhook that has been received, it's remembered so a redelivery isn't processed twice
+type Delivery struct {
+	UUID       string         `json:"uuid"`
+	Status     deliveryStatus `json:"status"`
+	JobID      string         `json:"jobId,omitempty"`
+	ReceivedAt time.Time      `json:"receivedAt"`
+	ExpiresAt  time.Time      `json:"expiresAt"`
+	// Results are the results of the original delivery, once it has been processed
+	Results []policy.WebhookResult `json:"results,omitempty"`
+}
+
+// expired reports whether the Delivery can be forgotten
+func (d Delivery) expired(now time.Time) bool {
+	return !now.Before(d.ExpiresAt)
+}
+
+// Duplicate is the response to a webhook that has already been received
+type Duplicate struct {
+	Msg      string   `json:"msg"`
+	Delivery Delivery `json:"delivery"`
+}
+
+// DeliveryStore remembers the webhooks that have been received until they expire
+type DeliveryStore interface {
+	// Claim records the Delivery, unless one with the same UUID hasn't expired yet.
+	// In that case the existing Delivery is returned along with false
+	Claim(delivery Delivery) (Delivery, bool, error)
+	// Update saves the progress of a claimed Delivery
+	Update(delivery Delivery) error
+	// Release forgets the Delivery, so the webhook is processed if it's delivered again
+	Release(uuid string) error
+}
+
+// MemoryDeliveryStore is a DeliveryStore that only lasts as long as the bot is running
+type MemoryDeliveryStore struct {
+	mu         sync.Mutex
+	deliveries map[string]Delivery
+}
+
+// NewMemoryDeliveryStore creates an empty MemoryDeliveryStore
+func NewMemoryDeliveryStore() *MemoryDeliveryStore {
+	return &MemoryDeliveryStore{deliveries: map[string]Delivery{}}
+}
+
+// Claim records the Delivery unless it has already been received
+func (s *MemoryDeliveryStore) Claim(delivery Delivery) (Delivery, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for uuid, existing := range s.deliveries {
+		if existing.expired(now) {
+			delete(s.deliveries, uuid)
+		}
+	}
+	if existing, ok := s.deliveries[delivery.UUID]; ok {
+		return existing, false, nil
+	}
+	s.deliveries[delivery.UUID] = delivery
+	return delivery, true, nil
+}
+
+// Update saves the progress of the Delivery
+func (s *MemoryDeliveryStore) Update(delivery Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries[delivery.UUID] = delivery
+	return nil
+}
+
+// Release forgets the Delivery
+func (s *MemoryDeliveryStore) Release(uuid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.deliveries, uuid)
+	return nil
+}
+
+// FileDeliveryStore is a DeliveryStore that keeps each Delivery in its own file,
+// so redeliveries are still recognised after a restart
+type FileDeliveryStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileDeliveryStore creates the store's directory if needed and removes any expired Deliveries
+func NewFileDeliveryStore(dir string) (*FileDeliveryStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	s := &FileDeliveryStore{dir: dir}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), jobExt) {
+			continue
+		}
+		var delivery Delivery
+		path := filepath.Join(dir, entry.Name())
+		if readErr := readJSON(path, &delivery); readErr != nil || delivery.expired(now) {
+			if removeErr := os.Remove(path); removeErr != nil {
+				return nil, removeErr
+			}
+		}
+	}
+	return s, nil
+}
+
+// Claim records the Delivery unless it has already been received
+func (s *FileDeliveryStore) Claim(delivery Delivery) (Delivery, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, err := s.path(delivery.UUID)
+	if err != nil {
+		return delivery, false, err
+	}
+	var existing Delivery
+	err = readJSON(path, &existing)
+	if err == nil && !existing.expired(time.Now()) {
+		return existing, false, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return delivery, false, err
+	}
+	return delivery, true, writeJSON(path, delivery)
+}
+
+// Update saves the progress of the Delivery
+func (s *FileDeliveryStore) Update(delivery Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, err := s.path(delivery.UUID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(path, delivery)
+}
+
+// Release forgets the Delivery
+func (s *FileDeliveryStore) Release(uuid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, err := s.path(uuid)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path ensures a UUID can't be used to reach outside the store's directory
+func (s *FileDeliveryStore) path(uuid string) (string, error) {
+	if uuid == "" || uuid != filepath.Base(uuid) || strings.HasPrefix(uuid, ".") {
+		return "", fmt.Errorf("invalid event uuid: %s", uuid)
+	}
+	return filepath.Join(s.dir, uuid+jobExt), nil
+}
+
+// claimDelivery records the webhook's UUID. The bool is false when the webhook has been received before,
+// in which case the original Delivery is returned. Webhooks without a UUID are always processed
+func (b *Bot) claimDelivery(uuid string) (Delivery, bool, error) {
+	if b.Deliveries == nil || uuid == "" {
+		return Delivery{}, true, nil
+	}
+	now := time.Now().UTC()
+	return b.Deliveries.Claim(Delivery{UUID: uuid, ReceivedAt: now, ExpiresAt: now.Add(b.deliveryTTL())})
+}
+
+// deliveryTTL is how long Deliveries are remembered for
+func (b *Bot) deliveryTTL() time.Duration {
+	if b.Config.DeliveryTTL <= 0 {
+		return defaultDeliveryTTL
+	}
+	return b.Config.DeliveryTTL
+}
+
+// completeDelivery saves the progress of a claimed Delivery
+func (b *Bot) completeDelivery(delivery Delivery) {
+	if b.Deliveries == nil || delivery.UUID == "" {
+		return
+	}
+	if err := b.Deliveries.Update(delivery); err != nil {
+		b.Logger.Error().Msg(fmt.Sprintf("delivery %s couldn't be updated: %v", delivery.UUID, err))
+	}
+}
+
+// releaseDelivery forgets a Delivery that couldn't be processed, so GitLab's redelivery is processed
+func (b *Bot) releaseDelivery(delivery Delivery) {
+	if b.Deliveries == nil || delivery.UUID == "" {
+		return
+	}
+	if err := b.Deliveries.Release(delivery.UUID); err != nil {
+		b.Logger.Error().Msg(fmt.Sprintf("delivery %s couldn't be released: %v", delivery.UUID, err))
+	}
+}
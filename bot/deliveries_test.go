@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeliveryStores(t *testing.T) {
+	fileStore, err := NewFileDeliveryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	data := []struct {
+		name  string
+		store DeliveryStore
+	}{
+		{name: "Memory", store: NewMemoryDeliveryStore()},
+		{name: "File", store: fileStore},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			now := time.Now().UTC()
+			delivery := Delivery{UUID: "a-uuid", ReceivedAt: now, ExpiresAt: now.Add(time.Hour)}
+
+			if _, claimed, claimErr := d.store.Claim(delivery); claimErr != nil || !claimed {
+				t.Fatalf("expected the first delivery to be claimed, got %v and error %v", claimed, claimErr)
+			}
+			delivery.Status = deliveryStatusProcessed
+			if err = d.store.Update(delivery); err != nil {
+				t.Fatalf("failed to update delivery: %v", err)
+			}
+			existing, claimed, _ := d.store.Claim(Delivery{UUID: "a-uuid", ReceivedAt: now, ExpiresAt: now.Add(time.Hour)})
+			if claimed || existing.Status != deliveryStatusProcessed {
+				t.Errorf("expected the redelivery to return the original delivery, got %v and %+v", claimed, existing)
+			}
+
+			if err = d.store.Release("a-uuid"); err != nil {
+				t.Fatalf("failed to release delivery: %v", err)
+			}
+			if _, claimed, _ = d.store.Claim(delivery); !claimed {
+				t.Errorf("expected a released delivery to be claimed again")
+			}
+
+			expired := Delivery{UUID: "expired-uuid", ReceivedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)}
+			_, _, _ = d.store.Claim(expired)
+			if _, claimed, _ = d.store.Claim(expired); !claimed {
+				t.Errorf("expected an expired delivery to be claimed again")
+			}
+		})
+	}
+}
+
+func TestFileDeliveryStoreRemovesExpired(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewFileDeliveryStore(dir)
+	now := time.Now().UTC()
+	_, _, _ = store.Claim(Delivery{UUID: "kept", ExpiresAt: now.Add(time.Hour)})
+	_, _, _ = store.Claim(Delivery{UUID: "expired", ExpiresAt: now.Add(-time.Hour)})
+
+	restarted, err := NewFileDeliveryStore(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	if _, claimed, _ := restarted.Claim(Delivery{UUID: "kept", ExpiresAt: now.Add(time.Hour)}); claimed {
+		t.Errorf("expected a delivery to be remembered after a restart")
+	}
+	if _, _, err = restarted.Claim(Delivery{UUID: "../escape"}); err == nil {
+		t.Errorf("expected a uuid outside the store to be rejected")
+	}
+}
+
+func TestProcessWebhookDuplicate(t *testing.T) {
+	b := Bot{
+		Router:     chi.NewRouter(),
+		Logger:     &zerolog.Logger{},
+		Config:     &Config{Endpoint: "/webhook-endpoint"},
+		Deliveries: NewMemoryDeliveryStore(),
+	}
+	b.routes(b.Router)
+
+	send := func(uuid string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/webhook-endpoint", strings.NewReader(`{"object_kind":"merge_request"}`))
+		req.Header.Set("X-Gitlab-Event", string(gitlab.EventTypeMergeRequest))
+		if uuid != "" {
+			req.Header.Set(eventUUIDHeader, uuid)
+		}
+		b.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("first-uuid"); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "already been received") {
+		t.Fatalf("expected the first delivery to be processed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := send("first-uuid")
+	var duplicate Duplicate
+	if err := json.NewDecoder(w.Body).Decode(&duplicate); err != nil {
+		t.Fatalf("response couldn't be decoded: %v", err)
+	}
+	if duplicate.Delivery.UUID != "first-uuid" || duplicate.Delivery.Status != deliveryStatusProcessed {
+		t.Errorf("expected the original delivery to be returned, got %+v", duplicate.Delivery)
+	}
+
+	if w = send(""); strings.Contains(w.Body.String(), "already been received") {
+		t.Errorf("expected webhooks without a uuid to always be processed")
+	}
+	if w = send(""); strings.Contains(w.Body.String(), "already been received") {
+		t.Errorf("expected webhooks without a uuid to always be processed")
+	}
+}
+
+func TestProcessWebhookQueuedDuplicate(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create queue: %v", err)
+	}
+	deliveries := NewMemoryDeliveryStore()
+	b := Bot{
+		Router:     chi.NewRouter(),
+		Logger:     &zerolog.Logger{},
+		Config:     &Config{Endpoint: "/webhook-endpoint", Workers: 1},
+		Queue:      q,
+		Deliveries: deliveries,
+	}
+	b.routes(b.Router)
+
+	for i, expected := range []int{http.StatusAccepted, http.StatusOK} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/webhook-endpoint", strings.NewReader(`{"object_kind":"merge_request"}`))
+		req.Header.Set("X-Gitlab-Event", string(gitlab.EventTypeMergeRequest))
+		req.Header.Set(eventUUIDHeader, "queued-uuid")
+		b.ServeHTTP(w, req)
+		if w.Code != expected {
+			t.Errorf("delivery %d: expected %d, but got: %d", i+1, expected, w.Code)
+		}
+	}
+	if depth := q.Depth(); depth.Pending != 1 {
+		t.Errorf("expected the redelivery not to be queued, got %+v", depth)
+	}
+
+	processed := make(chan Job, 1)
+	b.jobProcessed = func(job Job) { processed <- job }
+	b.startWorkers()
+	select {
+	case <-processed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the queued webhook to be processed")
+	}
+	b.Close()
+	if depth := q.Depth(); depth != (QueueDepth{}) {
+		t.Errorf("expected the queue to be empty, got %+v", depth)
+	}
+
+	existing, claimed, _ := deliveries.Claim(Delivery{UUID: "queued-uuid"})
+	if claimed || existing.Status != deliveryStatusProcessed || existing.JobID == "" {
+		t.Errorf("expected the queued delivery to be marked as processed, got %+v", existing)
+	}
+}
@@ -0,0 +1,29 @@
+package bot
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// writeJSON encodes v to a temporary file and renames it into place,
+// so a partially written file is never read back
+func writeJSON(path string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, body, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readJSON decodes the file at path into v
+func readJSON(path string, v interface{}) error {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,151 @@
+package bot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// limitSweepInterval is how often a store removes the counters whose firings have all left their window
+const limitSweepInterval = time.Hour
+
+// limitCounter is the firings recorded against a limit's key
+type limitCounter struct {
+	Key    string        `json:"key"`
+	Window time.Duration `json:"window,omitempty"`
+	Fired  []time.Time   `json:"fired"`
+}
+
+// take prunes the firings outside the window and records another if fewer than max remain.
+// The bool reports whether the firing was recorded
+func (c *limitCounter) take(max int, window time.Duration, now time.Time) bool {
+	c.Window = window
+	if window > 0 {
+		since := now.Add(-window)
+		kept := c.Fired[:0]
+		for _, fired := range c.Fired {
+			if fired.After(since) {
+				kept = append(kept, fired)
+			}
+		}
+		c.Fired = kept
+	}
+	if len(c.Fired) >= max {
+		return false
+	}
+	c.Fired = append(c.Fired, now)
+	return true
+}
+
+// expired reports whether every firing has left the window, so the counter no longer limits anything.
+// A counter without a window never expires
+func (c limitCounter) expired(now time.Time) bool {
+	if c.Window <= 0 {
+		return false
+	}
+	since := now.Add(-c.Window)
+	for _, fired := range c.Fired {
+		if fired.After(since) {
+			return false
+		}
+	}
+	return true
+}
+
+// MemoryLimitStore is a policy.LimitStore that only lasts as long as the bot is running
+type MemoryLimitStore struct {
+	mu       sync.Mutex
+	counters map[string]*limitCounter
+	swept    time.Time
+}
+
+// NewMemoryLimitStore creates an empty MemoryLimitStore
+func NewMemoryLimitStore() *MemoryLimitStore {
+	return &MemoryLimitStore{counters: map[string]*limitCounter{}}
+}
+
+// Take records a firing against the key unless the limit has been reached
+func (s *MemoryLimitStore) Take(key string, max int, window time.Duration, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	counter, ok := s.counters[key]
+	if !ok {
+		counter = &limitCounter{Key: key}
+		s.counters[key] = counter
+	}
+	return counter.take(max, window, now), nil
+}
+
+// sweep removes the expired counters, at most once every limitSweepInterval
+func (s *MemoryLimitStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < limitSweepInterval {
+		return
+	}
+	s.swept = now
+	for key, counter := range s.counters {
+		if counter.expired(now) {
+			delete(s.counters, key)
+		}
+	}
+}
+
+// FileLimitStore is a policy.LimitStore that keeps the firings of each key in its own file,
+// so limits still apply after a restart
+type FileLimitStore struct {
+	dir   string
+	mu    sync.Mutex
+	swept time.Time
+}
+
+// NewFileLimitStore creates the store's directory if needed
+func NewFileLimitStore(dir string) (*FileLimitStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileLimitStore{dir: dir}, nil
+}
+
+// Take records a firing against the key unless the limit has been reached
+func (s *FileLimitStore) Take(key string, max int, window time.Duration, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	path := s.path(key)
+	counter := limitCounter{Key: key}
+	if err := readJSON(path, &counter); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if !counter.take(max, window, now) {
+		return false, nil
+	}
+	return true, writeJSON(path, counter)
+}
+
+// sweep removes the files of expired counters, at most once every limitSweepInterval. A file that
+// can't be read is left for Take to report when its key fires
+func (s *FileLimitStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < limitSweepInterval {
+		return
+	}
+	s.swept = now
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*"+jobExt))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		var counter limitCounter
+		if err = readJSON(path, &counter); err == nil && counter.expired(now) {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+// path hashes the key, which contains the policy's name, so it's always a safe file name
+func (s *FileLimitStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+jobExt)
+}
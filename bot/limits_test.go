@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"gitlab.com/jonny7/quetzal/policy"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLimitStores(t *testing.T) {
+	fileStore, err := NewFileLimitStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	data := []struct {
+		name  string
+		store policy.LimitStore
+	}{
+		{name: "Memory", store: NewMemoryLimitStore()},
+		{name: "File", store: fileStore},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			now := time.Now().UTC()
+			for i, expected := range []bool{true, true, false} {
+				taken, takeErr := d.store.Take("close stale/project/1", 2, time.Hour, now.Add(time.Duration(i)*time.Minute))
+				if takeErr != nil || taken != expected {
+					t.Fatalf("expected firing %d to be taken %v, got %v and error %v", i+1, expected, taken, takeErr)
+				}
+			}
+			if taken, _ := d.store.Take("close stale/project/2", 2, time.Hour, now); !taken {
+				t.Errorf("expected a different key to be counted separately")
+			}
+			if taken, _ := d.store.Take("close stale/project/1", 2, time.Hour, now.Add(time.Hour+30*time.Second)); !taken {
+				t.Errorf("expected a firing once the first had left the window")
+			}
+		})
+	}
+}
+
+func TestLimitStoresSweepExpiredCounters(t *testing.T) {
+	dir := t.TempDir()
+	fileStore, err := NewFileLimitStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	memoryStore := NewMemoryLimitStore()
+	data := []struct {
+		name     string
+		store    policy.LimitStore
+		counters func() int
+	}{
+		{name: "Memory", store: memoryStore, counters: func() int { return len(memoryStore.counters) }},
+		{name: "File", store: fileStore, counters: func() int {
+			paths, _ := filepath.Glob(filepath.Join(dir, "*"+jobExt))
+			return len(paths)
+		}},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			now := time.Now().UTC()
+			for _, key := range []string{"close stale/project/1", "close stale/project/2"} {
+				if _, takeErr := d.store.Take(key, 2, time.Hour, now); takeErr != nil {
+					t.Fatalf("failed to take %s: %v", key, takeErr)
+				}
+			}
+			if _, takeErr := d.store.Take("welcome/project/1/merge_request/7", 1, 0, now); takeErr != nil {
+				t.Fatalf("failed to take a firing without a window: %v", takeErr)
+			}
+			if _, takeErr := d.store.Take("close stale/project/3", 2, time.Hour, now.Add(30*time.Minute)); takeErr != nil {
+				t.Fatalf("failed to take a firing: %v", takeErr)
+			}
+			if got := d.counters(); got != 4 {
+				t.Fatalf("expected no counters to be swept within the sweep interval, got %d", got)
+			}
+			if _, takeErr := d.store.Take("close stale/project/4", 2, time.Hour, now.Add(time.Hour+time.Minute)); takeErr != nil {
+				t.Fatalf("failed to take a firing: %v", takeErr)
+			}
+			if got := d.counters(); got != 3 {
+				t.Errorf("expected the counters whose firings had left the window to be swept, got %d counters", got)
+			}
+		})
+	}
+}
+
+func TestFileLimitStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileLimitStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	if taken, takeErr := store.Take("welcome/project/1/merge_request/7", 1, 0, time.Now()); takeErr != nil || !taken {
+		t.Fatalf("expected the first firing to be taken, got %v and error %v", taken, takeErr)
+	}
+	reopened, err := NewFileLimitStore(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	if taken, _ := reopened.Take("welcome/project/1/merge_request/7", 1, 0, time.Now().Add(24*time.Hour)); taken {
+		t.Errorf("expected the limit without a window to still apply after a restart")
+	}
+}
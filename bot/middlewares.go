@@ -1,19 +1,37 @@
 package bot
 
 import (
+	"crypto/subtle"
+	"fmt"
 	"github.com/go-chi/render"
+	"net"
 	"net/http"
+	"strings"
 )
 
-// webhookSecret confirms that a webhook secret matched the preconfigured one
-// on the bot. If no secret exists in GitLab it's initialized with its zero value
+// webhookSecret confirms that a webhook secret matched one of the preconfigured ones
+// on the bot. When a secret is configured the bot is strict by default and rejects webhooks
+// without a token, unless it's been made lenient. Without any secrets a webhook is only rejected
+// when it has a token. Webhooks can also be restricted to the configured source networks
 func (b *Bot) webhookSecret(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("X-Gitlab-Token") == "" {
+		if !b.allowedSource(r) {
+			w.WriteHeader(http.StatusForbidden)
+			render.Respond(w, r, "webhook source not allowed")
+			return
+		}
+		token := r.Header.Get("X-Gitlab-Token")
+		secrets := b.Config.secrets()
+		if token == "" {
+			if len(secrets) > 0 && !b.Config.LenientSecret {
+				w.WriteHeader(401)
+				render.Respond(w, r, "webhook secret missing")
+				return
+			}
 			next.ServeHTTP(w, r)
 			return
 		}
-		if r.Header.Get("X-Gitlab-Token") != b.Config.Secret {
+		if !secretMatches(token, secrets) {
 			w.WriteHeader(401)
 			render.Respond(w, r, "webhook secret mismatch")
 			return
@@ -21,3 +39,75 @@ func (b *Bot) webhookSecret(next http.HandlerFunc) http.HandlerFunc {
 		next.ServeHTTP(w, r)
 	}
 }
+
+// secrets are all the active webhook secrets, the rotated ones along with the main Secret
+func (c *Config) secrets() []string {
+	var secrets []string
+	for _, secret := range append([]string{c.Secret}, c.Secrets...) {
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// secretMatches compares the token against every secret in constant time,
+// so neither the secret nor which of them matched can be learnt from the response time
+func secretMatches(token string, secrets []string) bool {
+	matched := 0
+	for _, secret := range secrets {
+		matched |= subtle.ConstantTimeCompare([]byte(token), []byte(secret))
+	}
+	return matched == 1
+}
+
+// allowedSource reports whether the request came from one of the allowed networks,
+// every source is allowed when none are configured
+func (b *Bot) allowedSource(r *http.Request) bool {
+	if len(b.allowedNetworks) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range b.allowedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCIDRs parses the allowed source networks, a single IP address is treated as a network of one
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid source address: %s", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source network: %v", err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
@@ -3,6 +3,7 @@ package bot
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -74,3 +75,65 @@ func TestEmptyWebhookSecret(t *testing.T) {
 		t.Errorf("expected %d, but got: %d", want, got)
 	}
 }
+
+func TestStrictWebhookSecret(t *testing.T) {
+	networks, err := parseCIDRs([]string{"10.0.0.0/8", "192.168.1.7", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("failed to parse networks: %v", err)
+	}
+	data := []struct {
+		name       string
+		config     Config
+		networks   []*net.IPNet
+		token      string
+		remoteAddr string
+		expected   int
+	}{
+		{name: "Missing token is rejected", config: Config{Secret: "extremely-secret"}, expected: 401},
+		{name: "Missing token is accepted when lenient", config: Config{Secret: "extremely-secret", LenientSecret: true}, expected: 200},
+		{name: "Rotated secret is accepted", config: Config{Secret: "new-secret", Secrets: []string{"old-secret"}}, token: "old-secret", expected: 200},
+		{name: "Rotated secrets are all checked", config: Config{Secrets: []string{"old-secret", "new-secret"}}, token: "new-secret", expected: 200},
+		{name: "Unknown secret is rejected", config: Config{Secret: "new-secret", Secrets: []string{"old-secret"}}, token: "older-secret", expected: 401},
+		{name: "Allowed network", config: Config{}, networks: networks, remoteAddr: "10.1.2.3:4567", expected: 200},
+		{name: "Allowed address", config: Config{}, networks: networks, remoteAddr: "192.168.1.7:4567", expected: 200},
+		{name: "Allowed IPv6 network", config: Config{}, networks: networks, remoteAddr: "[2001:db8::1]:4567", expected: 200},
+		{name: "Forbidden network", config: Config{}, networks: networks, remoteAddr: "192.168.1.8:4567", expected: 403},
+		{name: "Forbidden network with secret", config: Config{Secret: "extremely-secret"}, networks: networks, token: "extremely-secret", remoteAddr: "172.16.0.1:4567", expected: 403},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			config := d.config
+			config.Endpoint = "/webhook-endpoint"
+			srv := Bot{
+				Router:          chi.NewRouter(),
+				Logger:          &zerolog.Logger{},
+				Config:          &config,
+				allowedNetworks: d.networks,
+			}
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, srv.Config.Endpoint, nil)
+			if d.token != "" {
+				req.Header.Set("X-Gitlab-Token", d.token)
+			}
+			if d.remoteAddr != "" {
+				req.RemoteAddr = d.remoteAddr
+			}
+
+			srv.webhookSecret(testHandler).ServeHTTP(w, req)
+
+			if w.Code != d.expected {
+				t.Errorf("expected %d, but got: %d", d.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	if _, err := parseCIDRs([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("expected an invalid network to be rejected")
+	}
+	if _, err := parseCIDRs([]string{"not-an-address"}); err == nil {
+		t.Errorf("expected an invalid address to be rejected")
+	}
+}
@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"errors"
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// milestoneKey identifies a milestone within the project it was looked up for
+type milestoneKey struct {
+	project int
+	id      int
+}
+
+// cachedMilestone is a milestone along with when it was looked up
+type cachedMilestone struct {
+	milestone *gitlab.Milestone
+	found     time.Time
+}
+
+// MilestoneCache is a policy.MilestoneFinder that looks milestones up with the GitLab API,
+// keeping each for its TTL so webhooks about the same milestone don't each make a request
+type MilestoneCache struct {
+	client *gitlab.Client
+	ttl    time.Duration
+	mu     sync.Mutex
+	cached map[milestoneKey]cachedMilestone
+	// now tells the time the TTL is measured with, tests replace it
+	now func() time.Time
+}
+
+// NewMilestoneCache creates an empty MilestoneCache, a TTL of 0 looks the milestone up every time
+func NewMilestoneCache(client *gitlab.Client, ttl time.Duration) *MilestoneCache {
+	return &MilestoneCache{client: client, ttl: ttl, cached: map[milestoneKey]cachedMilestone{}, now: time.Now}
+}
+
+// FindMilestone returns the milestone from the cache, or looks it up once it's expired.
+// A milestone that isn't the project's is looked up in the project's group, as webhooks
+// give the id of group milestones too
+func (c *MilestoneCache) FindMilestone(project, id int) (*gitlab.Milestone, error) {
+	key := milestoneKey{project: project, id: id}
+	c.mu.Lock()
+	cached, ok := c.cached[key]
+	c.mu.Unlock()
+	if ok && c.now().Sub(cached.found) < c.ttl {
+		return cached.milestone, nil
+	}
+
+	milestone, resp, err := c.client.Milestones.GetMilestone(project, id)
+	if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+		milestone, err = c.findGroupMilestone(project, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.cached[key] = cachedMilestone{milestone: milestone, found: c.now()}
+	c.mu.Unlock()
+	return milestone, nil
+}
+
+// findGroupMilestone looks the milestone up in the group the project belongs to
+func (c *MilestoneCache) findGroupMilestone(project, id int) (*gitlab.Milestone, error) {
+	p, _, err := c.client.Projects.GetProject(project, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.Namespace == nil || p.Namespace.Kind != "group" {
+		return nil, errors.New("the milestone isn't the project's and the project isn't in a group")
+	}
+	gm, _, err := c.client.GroupMilestones.GetGroupMilestone(p.Namespace.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	return &gitlab.Milestone{
+		ID:          gm.ID,
+		IID:         gm.IID,
+		Title:       gm.Title,
+		Description: gm.Description,
+		StartDate:   gm.StartDate,
+		DueDate:     gm.DueDate,
+		State:       gm.State,
+		UpdatedAt:   gm.UpdatedAt,
+		CreatedAt:   gm.CreatedAt,
+		Expired:     gm.Expired,
+	}, nil
+}
@@ -0,0 +1,59 @@
+package bot
+
+import (
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMilestoneCache(t *testing.T) {
+	requests := map[string]int{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/milestones/5", func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		fmt.Fprint(w, `{"id": 5, "title": "v1.0", "state": "active", "due_date": "2021-06-30"}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/milestones/8", func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "404 Milestone Not Found"}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1, "namespace": {"id": 3, "kind": "group"}}`)
+	})
+	mux.HandleFunc("/api/v4/groups/3/milestones/8", func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		fmt.Fprint(w, `{"id": 8, "group_id": 3, "title": "Q3", "state": "closed"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	now := time.Now()
+	cache := NewMilestoneCache(client, time.Minute)
+	cache.now = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		milestone, findErr := cache.FindMilestone(1, 5)
+		if findErr != nil || milestone.Title != "v1.0" || milestone.DueDate == nil {
+			t.Fatalf("expected the project's milestone, got %+v and error %v", milestone, findErr)
+		}
+	}
+	if requests["/api/v4/projects/1/milestones/5"] != 1 {
+		t.Errorf("expected the milestone to be cached, but it was requested %d times", requests["/api/v4/projects/1/milestones/5"])
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err = cache.FindMilestone(1, 5); err != nil || requests["/api/v4/projects/1/milestones/5"] != 2 {
+		t.Errorf("expected the milestone to be looked up again once expired")
+	}
+
+	milestone, err := cache.FindMilestone(1, 8)
+	if err != nil || milestone.Title != "Q3" || milestone.State != "closed" {
+		t.Errorf("expected the group's milestone, got %+v and error %v", milestone, err)
+	}
+}
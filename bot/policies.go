@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"fmt"
+	"gitlab.com/jonny7/quetzal/policy"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// policySet is an immutable set of validated policies, a reload swaps in a new set
+// rather than changing the policies of the current one
+type policySet struct {
+	policies []policy.Policy
+}
+
+// Policies returns the bot's current policies, they must not be modified
+func (b *Bot) Policies() []policy.Policy {
+	set, ok := b.policySet.Load().(policySet)
+	if !ok {
+		return nil
+	}
+	return set.policies
+}
+
+// parsePolicies reads and validates the policy file, any invalid policy fails the whole file
+func (b *Bot) parsePolicies(reader io.ReadCloser) ([]policy.Policy, error) {
+	defer func(reader io.ReadCloser) {
+		err := reader.Close()
+		if err != nil {
+			b.Logger.Error().Msg(fmt.Sprintf("the config file failed to close: %v", err))
+		}
+	}(reader)
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("policy file could not be read: %v", err)
+	}
+
+	var policies policy.Policies
+	if err = yaml.Unmarshal(body, &policies); err != nil {
+		return nil, fmt.Errorf("policy file could not be unmarshalled: %v", err)
+	}
+	if err = policies.ValidateNames(); err != nil {
+		return nil, fmt.Errorf("invalid policy: %v", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	policiesToValidate := preparePolicies(done, policies.Policies)
+	workers := make([]<-chan error, runtime.NumCPU())
+	for i := 0; i < runtime.NumCPU(); i++ {
+		workers[i] = b.validatePolicies(policiesToValidate)
+	}
+	for v := range mergeErrors(done, workers...) {
+		if v != nil {
+			return nil, fmt.Errorf("invalid policy: %v", v)
+		}
+	}
+	return policies.Policies, nil
+}
+
+// loadPolicies parses and validates the policies, then swaps them in.
+// The current policies are kept when there's an error
+func (b *Bot) loadPolicies(reader io.ReadCloser) error {
+	policies, err := b.parsePolicies(reader)
+	if err != nil {
+		return err
+	}
+	b.policySet.Store(policySet{policies: policies})
+	return nil
+}
+
+// reloadPolicies loads the policies from the Config's PolicyPath
+func (b *Bot) reloadPolicies() error {
+	reader, err := createReader(b.Config.PolicyPath)
+	if err != nil {
+		return fmt.Errorf("could not create reader for policy file: %v", err)
+	}
+	if err = b.loadPolicies(reader); err != nil {
+		return fmt.Errorf("policies couldn't be reloaded: %v", err)
+	}
+	b.Logger.Info().Msg(fmt.Sprintf("reloaded %d policies from %s", len(b.Policies()), b.Config.PolicyPath))
+	return nil
+}
+
+// watchPolicies reloads the policies when the bot receives a SIGHUP, and when the
+// policy file changes if a PolicyPollInterval is configured. It stops once the bot is closed
+func (b *Bot) watchPolicies() {
+	// the signal and file are watched before returning, so no change can be missed
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go b.reloadOnChange(hup, policyFileModified(b.Config.PolicyPath))
+}
+
+// reloadOnChange reloads the policies on every signal, or when the policy file's modification time changes
+func (b *Bot) reloadOnChange(hup chan os.Signal, modified time.Time) {
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if b.Config.PolicyPollInterval > 0 {
+		ticker := time.NewTicker(b.Config.PolicyPollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-hup:
+			modified = policyFileModified(b.Config.PolicyPath)
+			b.logReload(b.reloadPolicies())
+		case <-tick:
+			latest := policyFileModified(b.Config.PolicyPath)
+			if latest.IsZero() || latest.Equal(modified) {
+				continue
+			}
+			modified = latest
+			b.logReload(b.reloadPolicies())
+		}
+	}
+}
+
+// logReload logs a failed reload, the reload endpoint reports its own errors
+func (b *Bot) logReload(err error) {
+	if err != nil {
+		b.Logger.Error().Msg(fmt.Sprintf("%v, keeping the current policies", err))
+	}
+}
+
+// policyFileModified returns when the policy file was last modified, or the zero time if it can't be found
+func policyFileModified(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/xanzy/go-gitlab"
+	"gitlab.com/jonny7/quetzal/policy"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const validPolicies = `policies:
+  - name: first
+    resource: Issue Hook
+`
+
+const invalidPolicies = `policies:
+  - name: invalid resource
+    resource: Nothing Hook
+`
+
+func TestLoadPoliciesKeepsCurrentOnError(t *testing.T) {
+	b := Bot{
+		Router: chi.NewRouter(),
+		Logger: &zerolog.Logger{},
+		Config: &Config{Endpoint: "/webhook-endpoint"},
+	}
+	if err := b.loadPolicies(readerFor(validPolicies)); err != nil {
+		t.Fatalf("failed to load policies: %v", err)
+	}
+
+	data := []struct {
+		name     string
+		policies string
+	}{
+		{name: "Invalid policy", policies: invalidPolicies},
+		{name: "Invalid yaml", policies: "policies: [{"},
+		{name: "Duplicate names", policies: validPolicies + "  - name: first\n    resource: Note Hook\n"},
+		{name: "Missing name", policies: validPolicies + "  - resource: Note Hook\n"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if err := b.loadPolicies(readerFor(d.policies)); err == nil {
+				t.Errorf("expected the policies to be rejected")
+			}
+			if got := b.Policies(); len(got) != 1 || got[0].Name != "first" {
+				t.Errorf("expected the current policies to be kept, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestReloadInvalidPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	writePolicies(t, path, validPolicies)
+	b := Bot{
+		Router: chi.NewRouter(),
+		Logger: &zerolog.Logger{},
+		Config: &Config{Endpoint: "/webhook-endpoint", PolicyPath: path},
+	}
+	b.routes(b.Router)
+	if err := b.reloadPolicies(); err != nil {
+		t.Fatalf("failed to load policies: %v", err)
+	}
+
+	writePolicies(t, path, invalidPolicies)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/reload", nil)
+	b.ServeHTTP(w, req)
+
+	if w.Code != 500 {
+		t.Errorf("expected %d, but got: %d", 500, w.Code)
+	}
+	if got := b.Policies(); len(got) != 1 || got[0].Name != "first" {
+		t.Errorf("expected the current policies to be kept, got %+v", got)
+	}
+}
+
+func TestReloadWhileProcessing(t *testing.T) {
+	b := Bot{
+		Router: chi.NewRouter(),
+		Logger: &zerolog.Logger{},
+		Config: &Config{Endpoint: "/webhook-endpoint"},
+	}
+	if err := b.loadPolicies(readerFor(validPolicies)); err != nil {
+		t.Fatalf("failed to load policies: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			_ = b.loadPolicies(readerFor(validPolicies))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			b.process(policy.Webhook{EventType: gitlab.EventTypeMergeRequest, Event: &gitlab.MergeEvent{}})
+		}
+	}()
+	wg.Wait()
+}
+
+func TestWatchPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	writePolicies(t, path, validPolicies)
+	b := Bot{
+		Router: chi.NewRouter(),
+		Logger: &zerolog.Logger{},
+		Config: &Config{Endpoint: "/webhook-endpoint", PolicyPath: path, PolicyPollInterval: 10 * time.Millisecond},
+		stop:   make(chan struct{}),
+	}
+	if err := b.reloadPolicies(); err != nil {
+		t.Fatalf("failed to load policies: %v", err)
+	}
+	b.watchPolicies()
+	defer b.Close()
+
+	t.Run("File change", func(t *testing.T) {
+		writePolicies(t, path, validPolicies+"  - name: second\n    resource: Issue Hook\n")
+		// the modification time is moved on, as the file may be rewritten within the file system's timestamp resolution
+		future := time.Now().Add(time.Minute)
+		if err := os.Chtimes(path, future, future); err != nil {
+			t.Fatalf("failed to touch policy file: %v", err)
+		}
+		waitForPolicies(t, &b, 2)
+	})
+
+	t.Run("SIGHUP", func(t *testing.T) {
+		writePolicies(t, path, validPolicies+"  - name: second\n    resource: Issue Hook\n  - name: third\n    resource: Issue Hook\n")
+		if err := syscall.Kill(syscall.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatalf("failed to send SIGHUP: %v", err)
+		}
+		waitForPolicies(t, &b, 3)
+	})
+}
+
+func readerFor(policies string) io.ReadCloser {
+	return io.NopCloser(strings.NewReader(policies))
+}
+
+func writePolicies(t *testing.T, path, policies string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(policies), 0o640); err != nil {
+		t.Fatalf("failed to write policies: %v", err)
+	}
+}
+
+func waitForPolicies(t *testing.T, b *Bot, expected int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(b.Policies()) != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d policies after reloading, got %d", expected, len(b.Policies()))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
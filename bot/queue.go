@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errQueueClosed is returned when enqueuing onto a closed Queue
+var errQueueClosed = errors.New("queue is closed")
+
+// jobExt is the file extension of a persisted Job
+const jobExt = ".json"
+
+// Job is a webhook waiting to be processed by a worker
+type Job struct {
+	ID        string           `json:"id"`
+	EventType gitlab.EventType `json:"eventType"`
+	// UUID is the webhook's event UUID, if GitLab sent one
+	UUID       string          `json:"uuid,omitempty"`
+	ReceivedAt time.Time       `json:"receivedAt"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// QueueDepth reports how many Jobs are in the Queue
+type QueueDepth struct {
+	Pending  int `json:"pending"`
+	InFlight int `json:"inFlight"`
+}
+
+// Queue is a file-backed FIFO queue of Jobs. Each Job is written to its own file in the
+// queue's directory and is only removed once it has been acknowledged, so any webhooks
+// that were not processed are picked up again when the bot restarts
+type Queue struct {
+	dir      string
+	mu       sync.Mutex
+	cond     *sync.Cond
+	pending  []Job
+	inFlight int
+	closed   bool
+	seq      uint64
+}
+
+// NewQueue creates the queue's directory if needed and loads any Jobs left from a previous run
+func NewQueue(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	q := &Queue{dir: dir}
+	q.cond = sync.NewCond(&q.mu)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), jobExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	// job ids are zero padded so sorting by name keeps them in the order they were received
+	sort.Strings(names)
+	for _, name := range names {
+		var job Job
+		if readErr := readJSON(filepath.Join(dir, name), &job); readErr != nil {
+			return nil, fmt.Errorf("queued job %s could not be read: %v", name, readErr)
+		}
+		q.pending = append(q.pending, job)
+	}
+	return q, nil
+}
+
+// Enqueue persists the webhook and makes it available to the workers
+func (q *Queue) Enqueue(eventType gitlab.EventType, uuid string, payload []byte) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return Job{}, errQueueClosed
+	}
+	q.seq++
+	job := Job{
+		ID:         fmt.Sprintf("%020d-%06d", time.Now().UnixNano(), q.seq%1000000),
+		EventType:  eventType,
+		UUID:       uuid,
+		ReceivedAt: time.Now().UTC(),
+		Payload:    payload,
+	}
+	if err := writeJSON(q.path(job), job); err != nil {
+		return Job{}, err
+	}
+	q.pending = append(q.pending, job)
+	q.cond.Signal()
+	return job, nil
+}
+
+func (q *Queue) path(job Job) string {
+	return filepath.Join(q.dir, job.ID+jobExt)
+}
+
+// Dequeue blocks until a Job is available. The bool is false once the Queue has been closed
+func (q *Queue) Dequeue() (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.pending) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return Job{}, false
+	}
+	job := q.pending[0]
+	q.pending = q.pending[1:]
+	q.inFlight++
+	return job, true
+}
+
+// Ack removes a processed Job from disk
+func (q *Queue) Ack(job Job) error {
+	q.mu.Lock()
+	q.inFlight--
+	q.mu.Unlock()
+	if err := os.Remove(q.path(job)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Depth returns the number of pending and in flight Jobs
+func (q *Queue) Depth() QueueDepth {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueDepth{Pending: len(q.pending), InFlight: q.inFlight}
+}
+
+// Close stops any waiting workers, pending Jobs stay on disk for the next run
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"github.com/xanzy/go-gitlab"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewQueue(dir)
+	if err != nil {
+		t.Fatalf("failed to create queue: %v", err)
+	}
+
+	first, err := q.Enqueue(gitlab.EventTypeMergeRequest, "", []byte(`{"object_kind":"merge_request"}`))
+	if err != nil {
+		t.Fatalf("failed to enqueue: %v", err)
+	}
+	second, _ := q.Enqueue(gitlab.EventTypeIssue, "", []byte(`{"object_kind":"issue"}`))
+
+	if depth := q.Depth(); depth.Pending != 2 || depth.InFlight != 0 {
+		t.Errorf("expected 2 pending jobs, got %+v", depth)
+	}
+
+	job, ok := q.Dequeue()
+	if !ok || job.ID != first.ID {
+		t.Fatalf("expected the first job to be dequeued first, got %s", job.ID)
+	}
+	if depth := q.Depth(); depth.Pending != 1 || depth.InFlight != 1 {
+		t.Errorf("expected 1 pending and 1 in flight job, got %+v", depth)
+	}
+	if err = q.Ack(job); err != nil {
+		t.Errorf("failed to ack job: %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(dir, first.ID+jobExt)); !os.IsNotExist(statErr) {
+		t.Errorf("expected an acknowledged job to be removed from disk")
+	}
+
+	t.Run("Jobs survive a restart", func(t *testing.T) {
+		restarted, restartErr := NewQueue(dir)
+		if restartErr != nil {
+			t.Fatalf("failed to reopen queue: %v", restartErr)
+		}
+		if depth := restarted.Depth(); depth.Pending != 1 {
+			t.Fatalf("expected the unprocessed job to be reloaded, got %+v", depth)
+		}
+		reloaded, _ := restarted.Dequeue()
+		if reloaded.ID != second.ID || reloaded.EventType != gitlab.EventTypeIssue || string(reloaded.Payload) != `{"object_kind":"issue"}` {
+			t.Errorf("expected the reloaded job to match the queued one, got %+v", reloaded)
+		}
+	})
+
+	t.Run("Closed queue", func(t *testing.T) {
+		q.Close()
+		if _, ok = q.Dequeue(); ok {
+			t.Errorf("expected dequeue to stop once the queue is closed")
+		}
+		if _, err = q.Enqueue(gitlab.EventTypeIssue, "", nil); err != errQueueClosed {
+			t.Errorf("expected enqueue to fail once the queue is closed, got %v", err)
+		}
+	})
+}
+
+func TestQueueCorruptJob(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken"+jobExt), []byte("{"), 0o640); err != nil {
+		t.Fatalf("failed to write job: %v", err)
+	}
+	if _, err := NewQueue(dir); err == nil {
+		t.Errorf("expected an error as the queued job can't be decoded")
+	}
+}
@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// rotation is the position of a round-robin rotation
+type rotation struct {
+	Key      string `json:"key"`
+	Position int    `json:"position"`
+}
+
+// MemoryRotationStore is a policy.RotationStore that only lasts as long as the bot is running
+type MemoryRotationStore struct {
+	mu        sync.Mutex
+	positions map[string]int
+}
+
+// NewMemoryRotationStore creates an empty MemoryRotationStore
+func NewMemoryRotationStore() *MemoryRotationStore {
+	return &MemoryRotationStore{positions: map[string]int{}}
+}
+
+// Rotate returns the position of the rotation and moves it on by step
+func (s *MemoryRotationStore) Rotate(key string, step int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	position := s.positions[key]
+	s.positions[key] = position + step
+	return position, nil
+}
+
+// FileRotationStore is a policy.RotationStore that keeps the position of each rotation in its own file,
+// so round-robin assignments carry on where they left off after a restart
+type FileRotationStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileRotationStore creates the store's directory if needed
+func NewFileRotationStore(dir string) (*FileRotationStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileRotationStore{dir: dir}, nil
+}
+
+// Rotate returns the position of the rotation and moves it on by step
+func (s *FileRotationStore) Rotate(key string, step int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := s.path(key)
+	r := rotation{Key: key}
+	if err := readJSON(path, &r); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	position := r.Position
+	if step == 0 {
+		return position, nil
+	}
+	r.Position += step
+	return position, writeJSON(path, r)
+}
+
+// path hashes the key, which contains the usernames, so it's always a safe file name
+func (s *FileRotationStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+jobExt)
+}
@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"gitlab.com/jonny7/quetzal/policy"
+	"testing"
+)
+
+func TestRotationStores(t *testing.T) {
+	fileStore, err := NewFileRotationStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	data := []struct {
+		name  string
+		store policy.RotationStore
+	}{
+		{name: "Memory", store: NewMemoryRotationStore()},
+		{name: "File", store: fileStore},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			for i, step := range []int{1, 0, 2, 1} {
+				expected := []int{0, 1, 1, 3}[i]
+				position, rotateErr := d.store.Rotate("assign/alice,bob,carol", step)
+				if rotateErr != nil || position != expected {
+					t.Fatalf("expected rotation %d to be at %d, got %d and error %v", i+1, expected, position, rotateErr)
+				}
+			}
+			if position, _ := d.store.Rotate("assignReviewers/alice,bob,carol", 1); position != 0 {
+				t.Errorf("expected a different key to rotate separately")
+			}
+		})
+	}
+}
+
+func TestFileRotationStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileRotationStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	if _, err = store.Rotate("assign/alice,bob", 1); err != nil {
+		t.Fatalf("failed to rotate: %v", err)
+	}
+	reopened, err := NewFileRotationStore(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	if position, _ := reopened.Rotate("assign/alice,bob", 1); position != 1 {
+		t.Errorf("expected the rotation to carry on after a restart, got %d", position)
+	}
+}
@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cachedLookup is the result of a lookup along with when it was made
+type cachedLookup struct {
+	value interface{}
+	found time.Time
+}
+
+// UserCache is a policy.UserFinder that looks users, group memberships, reviewers and open merge requests up
+// with the GitLab API. Users and memberships are kept for the TTL, so webhooks about the same people don't
+// each make a request
+type UserCache struct {
+	client *gitlab.Client
+	ttl    time.Duration
+	mu     sync.Mutex
+	cached map[string]cachedLookup
+	// now tells the time the TTL is measured with, tests replace it
+	now func() time.Time
+}
+
+// NewUserCache creates an empty UserCache, a TTL of 0 looks everything up every time
+func NewUserCache(client *gitlab.Client, ttl time.Duration) *UserCache {
+	return &UserCache{client: client, ttl: ttl, cached: map[string]cachedLookup{}, now: time.Now}
+}
+
+// lookup returns the cached value of the key, or finds it once it's expired. Failed lookups aren't kept
+func (c *UserCache) lookup(key string, find func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	cached, ok := c.cached[key]
+	c.mu.Unlock()
+	if ok && c.now().Sub(cached.found) < c.ttl {
+		return cached.value, nil
+	}
+	value, err := find()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.cached[key] = cachedLookup{value: value, found: c.now()}
+	c.mu.Unlock()
+	return value, nil
+}
+
+// Username returns the username of the user with the id
+func (c *UserCache) Username(id int) (string, error) {
+	value, err := c.lookup(fmt.Sprintf("user/%d", id), func() (interface{}, error) {
+		user, _, err := c.client.Users.GetUser(id, gitlab.GetUsersOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return user.Username, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// InGroup reports whether the user with the id is a member of the group, including
+// through a parent group. go-gitlab only gets direct members, so the request is built here
+func (c *UserCache) InGroup(group string, id int) (bool, error) {
+	value, err := c.lookup(fmt.Sprintf("group/%s/%d", group, id), func() (interface{}, error) {
+		req, err := c.client.NewRequest(http.MethodGet, fmt.Sprintf("groups/%s/members/all/%d", url.PathEscape(group), id), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.client.Do(req, nil)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return true, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return value.(bool), nil
+}
+
+// Reviewers returns the usernames of the merge request's reviewers. They aren't cached,
+// as a webhook is often sent because they've just changed
+func (c *UserCache) Reviewers(project, mergeRequest int) ([]string, error) {
+	mr, _, err := c.client.MergeRequests.GetMergeRequest(project, mergeRequest, nil)
+	if err != nil {
+		return nil, err
+	}
+	reviewers := []string{}
+	for _, reviewer := range mr.Reviewers {
+		reviewers = append(reviewers, reviewer.Username)
+	}
+	return reviewers, nil
+}
+
+// UserID returns the id of the user with the username
+func (c *UserCache) UserID(username string) (int, error) {
+	value, err := c.lookup("username/"+strings.ToLower(username), func() (interface{}, error) {
+		users, _, err := c.client.Users.ListUsers(&gitlab.ListUsersOptions{Username: &username})
+		if err != nil {
+			return nil, err
+		}
+		if len(users) == 0 {
+			return nil, fmt.Errorf("there's no user with the username %s", username)
+		}
+		return users[0].ID, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value.(int), nil
+}
+
+// OpenMergeRequests counts the open merge requests the user is assigned to, or reviewing. They aren't
+// cached, as each assignment changes them. Only the total of the first page is needed
+func (c *UserCache) OpenMergeRequests(id int, reviewing bool) (int, error) {
+	opt := &gitlab.ListMergeRequestsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 1},
+		State:       gitlab.String("opened"),
+		Scope:       gitlab.String("all"),
+		AssigneeID:  &id,
+	}
+	if reviewing {
+		opt.AssigneeID, opt.ReviewerID = nil, &id
+	}
+	mrs, resp, err := c.client.MergeRequests.ListMergeRequests(opt)
+	if err != nil {
+		return 0, err
+	}
+	if resp.TotalItems == 0 && len(mrs) > 0 {
+		// GitLab leaves out the total when there are over 10,000, so they're counted as the most
+		return math.MaxInt32, nil
+	}
+	return resp.TotalItems, nil
+}
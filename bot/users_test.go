@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUserCache(t *testing.T) {
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users/5", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"id": 5, "username": "jonny"}`)
+	})
+	mux.HandleFunc("/api/v4/groups/org/team/members/all/5", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 5, "username": "jonny"}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/merge_requests/7", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"iid": 7, "reviewers": [{"id": 6, "username": "sam"}]}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	now := time.Date(2021, 9, 20, 12, 0, 0, 0, time.UTC)
+	cache := NewUserCache(client, time.Minute)
+	cache.now = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		if username, findErr := cache.Username(5); findErr != nil || username != "jonny" {
+			t.Fatalf("expected jonny, got %s and error %v", username, findErr)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected the user to be cached, but they were requested %d times", requests)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err = cache.Username(5); err != nil || requests != 2 {
+		t.Errorf("expected the user to be looked up again once the ttl passed")
+	}
+	if _, err = cache.Username(6); err == nil {
+		t.Errorf("expected an error for an unknown user")
+	}
+
+	if member, findErr := cache.InGroup("org/team", 5); findErr != nil || !member {
+		t.Errorf("expected user 5 to be a member, got %v and error %v", member, findErr)
+	}
+	if member, findErr := cache.InGroup("org/team", 6); findErr != nil || member {
+		t.Errorf("expected a 404 to mean user 6 isn't a member, got %v and error %v", member, findErr)
+	}
+
+	if reviewers, findErr := cache.Reviewers(1, 7); findErr != nil || !reflect.DeepEqual(reviewers, []string{"sam"}) {
+		t.Errorf("expected sam to be the reviewer, got %v and error %v", reviewers, findErr)
+	}
+}
+
+func TestUserCacheAssignees(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("username") != "jonny" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		fmt.Fprint(w, `[{"id": 5, "username": "jonny"}]`)
+	})
+	mux.HandleFunc("/api/v4/merge_requests", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("state") != "opened" || query.Get("scope") != "all" {
+			t.Errorf("expected only open merge requests to be counted, got %v", query)
+		}
+		total := "3"
+		if query.Get("reviewer_id") == "5" {
+			total = "2"
+		}
+		w.Header().Set("X-Total", total)
+		fmt.Fprint(w, `[{"iid": 1}]`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	cache := NewUserCache(client, time.Minute)
+	if id, findErr := cache.UserID("jonny"); findErr != nil || id != 5 {
+		t.Errorf("expected jonny's id to be 5, got %d and error %v", id, findErr)
+	}
+	if _, err = cache.UserID("sam"); err == nil {
+		t.Errorf("expected an error for an unknown username")
+	}
+	if open, findErr := cache.OpenMergeRequests(5, false); findErr != nil || open != 3 {
+		t.Errorf("expected 3 assigned merge requests, got %d and error %v", open, findErr)
+	}
+	if open, findErr := cache.OpenMergeRequests(5, true); findErr != nil || open != 2 {
+		t.Errorf("expected 2 merge requests to review, got %d and error %v", open, findErr)
+	}
+}
@@ -1,29 +1,96 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"gitlab.com/jonny7/quetzal/bot"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(validate(os.Args[2:], os.Stdout, os.Stderr))
+		case "simulate":
+			os.Exit(simulate(os.Args[2:], os.Stdout, os.Stderr))
+		case "serve":
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q, available commands are: serve, validate, simulate\n", os.Args[1])
+			os.Exit(2)
+		}
+	}
+	serve()
+}
+
+// serve runs the bot, configured from the environment
+func serve() {
 	user := getEnvStr("user", "")
 	token := getEnvStr("token", "")
 	botServer := getEnvStr("bot", "")
 	endpoint := getEnvStr("webhook", "/webhook-endpoint")
 	secret := getEnvStr("secret", "")
+	secrets := getEnvList("secrets", nil)
+	allowedCIDRs := getEnvList("allowedcidrs", nil)
 	host := getEnvStr("host", "https://gitlab.com")
 	port := getEnvStr("port", "7838")
 	dry, err := getEnvBool("dry", false)
 	if err != nil {
 		log.Fatalf("dry var was unprocessible: %v", err)
 	}
+	lenientSecret, err := getEnvBool("lenientsecret", false)
+	if err != nil {
+		log.Fatalf("lenientsecret var was unprocessible: %v", err)
+	}
 	policies := getEnvStr("policies", "./examples/.policies.yaml")
+	policyPoll, err := getEnvDuration("policypoll", 5*time.Second)
+	if err != nil {
+		log.Fatalf("policypoll var was unprocessible: %v", err)
+	}
+	queue := getEnvStr("queue", "./.quetzal/queue")
+	deadLetters := getEnvStr("deadletters", "./.quetzal/dead-letters")
+	deliveries := getEnvStr("deliveries", "./.quetzal/deliveries")
+	limits := getEnvStr("limits", "./.quetzal/limits")
+	rotations := getEnvStr("rotations", "./.quetzal/rotations")
+	deliveryTTL, err := getEnvDuration("deliveryttl", 24*time.Hour)
+	if err != nil {
+		log.Fatalf("deliveryttl var was unprocessible: %v", err)
+	}
+	milestoneTTL, err := getEnvDuration("milestonettl", 10*time.Minute)
+	if err != nil {
+		log.Fatalf("milestonettl var was unprocessible: %v", err)
+	}
+	userTTL, err := getEnvDuration("userttl", 10*time.Minute)
+	if err != nil {
+		log.Fatalf("userttl var was unprocessible: %v", err)
+	}
+	ignoreSelf, err := getEnvBool("ignoreself", true)
+	if err != nil {
+		log.Fatalf("ignoreself var was unprocessible: %v", err)
+	}
+	loopMax, err := getEnvInt("loopmax", 5)
+	if err != nil {
+		log.Fatalf("loopmax var was unprocessible: %v", err)
+	}
+	loopWindow, err := getEnvDuration("loopwindow", 10*time.Minute)
+	if err != nil {
+		log.Fatalf("loopwindow var was unprocessible: %v", err)
+	}
+	if loopMax > 0 && loopWindow <= 0 {
+		log.Fatalf("loopwindow var must be positive when loopmax is set, but received: %s", loopWindow)
+	}
+	workers, err := getEnvInt("workers", runtime.NumCPU())
+	if err != nil {
+		log.Fatalf("workers var was unprocessible: %v", err)
+	}
 	version, err := getEnvBool("version", false)
 	if err != nil {
 		log.Fatalf("version var was unprocessible: %v", err)
@@ -44,20 +111,29 @@ func main() {
 		Port:       fmt.Sprintf(":%s", port),
 		PolicyPath: policies,
 		DryRun:     dry,
-	}
+		QueuePath:  queue,
+		Workers:    workers,
 
-	errorCh := make(chan error)
-	go func() {
-		sigs := make(chan os.Signal, 1)
-		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-		errorCh <- fmt.Errorf("%s", <-sigs)
-	}()
+		Secrets:        secrets,
+		LenientSecret:  lenientSecret,
+		AllowedCIDRs:   allowedCIDRs,
+		DeadLetterPath: deadLetters,
+		DeliveryPath:   deliveries,
+		DeliveryTTL:    deliveryTTL,
+		LimitPath:      limits,
+		RotationPath:   rotations,
+		MilestoneTTL:   milestoneTTL,
+		UserTTL:        userTTL,
+		IgnoreSelf:     ignoreSelf,
+		LoopMax:        loopMax,
+		LoopWindow:     loopWindow,
 
-	go func() {
-		errorCh <- run(config, policies)
-	}()
+		PolicyPollInterval: policyPoll,
+	}
 
-	log.Printf("exiting %v", <-errorCh)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	log.Printf("exiting %v", run(config, policies, sigs))
 }
 
 func getEnvBool(key string, defaultVal bool) (bool, error) {
@@ -71,6 +147,41 @@ func getEnvBool(key string, defaultVal bool) (bool, error) {
 	return defaultVal, nil
 }
 
+func getEnvInt(key string, defaultVal int) (int, error) {
+	if value, ok := os.LookupEnv(key); ok {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return defaultVal, err
+		}
+		return i, nil
+	}
+	return defaultVal, nil
+}
+
+func getEnvDuration(key string, defaultVal time.Duration) (time.Duration, error) {
+	if value, ok := os.LookupEnv(key); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return defaultVal, err
+		}
+		return d, nil
+	}
+	return defaultVal, nil
+}
+
+func getEnvList(key string, defaultVal []string) []string {
+	if value, ok := os.LookupEnv(key); ok {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+	return defaultVal
+}
+
 func getEnvStr(key, defaultVal string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
@@ -78,14 +189,35 @@ func getEnvStr(key, defaultVal string) string {
 	return defaultVal
 }
 
-func run(config bot.Config, policies string) error {
+// shutdownTimeout is how long requests in progress are given to finish once the bot is told to stop
+const shutdownTimeout = 30 * time.Second
+
+// run serves the bot until it fails or a signal is received. Either way the bot is closed,
+// so the workers finish the jobs they're running before it exits
+func run(config bot.Config, policies string, sigs <-chan os.Signal) error {
 	b, err := bot.New(config, policies)
 	if err != nil {
 		return err
 	}
-	if httpErr := http.ListenAndServe(b.Config.Port, b.Router); httpErr != nil {
-		return httpErr
+	defer b.Close()
+
+	server := &http.Server{Addr: b.Config.Port, Handler: b.Router}
+	errorCh := make(chan error, 1)
+	go func() {
+		errorCh <- server.ListenAndServe()
+	}()
+	log.Printf("Quetzal running on %s", b.Config.Port)
+
+	select {
+	case err = <-errorCh:
+		return err
+	case sig := <-sigs:
+		log.Printf("received %s, waiting for the webhooks in progress to finish", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err = server.Shutdown(ctx); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s", sig)
 	}
-	fmt.Printf("Quetzal running with the following configuration: %v", b.Config)
-	return nil
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"gitlab.com/jonny7/quetzal/policy"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+)
+
+// eventTypes maps a webhook's `object_kind` to its event type, for when the event type isn't given
+var eventTypes = map[string]gitlab.EventType{
+	"merge_request": gitlab.EventTypeMergeRequest,
+	"issue":         gitlab.EventTypeIssue,
+	"note":          gitlab.EventTypeNote,
+}
+
+// simulate runs a saved webhook against the policies without making any changes in GitLab,
+// printing which policies matched and the requests they would have made. It returns the exit code
+func simulate(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	policies := flags.String("policies", getEnvStr("policies", "./examples/.policies.yaml"), "The path to the policies file")
+	event := flags.String("event", "", "The webhook's event type, such as \"Merge Request Hook\" (default is taken from the payload's object_kind)")
+	user := flags.String("user", getEnvStr("user", ""), "The bot user, so help commands are answered")
+	asJSON := flags.Bool("json", false, "Print the results as json")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: quetzal simulate [flags] <webhook.json>")
+		fmt.Fprintln(stderr, "Nothing is looked up in GitLab, so conditions that look things up, such as paths, reviewers,")
+		fmt.Fprintln(stderr, "a milestone by title or an author in a group, aren't met, and assign, assignReviewers and size")
+		fmt.Fprintln(stderr, "actions report an error rather than a request")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	body, err := os.ReadFile(*policies)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", *policies, err)
+		return 1
+	}
+	if errs := policy.ValidateYAML(body); len(errs) > 0 {
+		for _, e := range errs {
+			fmt.Fprintf(stderr, "%s:%v\n", *policies, e)
+		}
+		return 1
+	}
+	var loaded policy.Policies
+	if err = yaml.Unmarshal(body, &loaded); err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", *policies, err)
+		return 1
+	}
+
+	payload, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", flags.Arg(0), err)
+		return 1
+	}
+	eventType := gitlab.EventType(*event)
+	if eventType == "" {
+		if eventType, err = payloadEventType(payload); err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", flags.Arg(0), err)
+			return 2
+		}
+	}
+
+	results, err := policy.Simulate(eventType, payload, loaded.Policies, *user)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", flags.Arg(0), err)
+		return 1
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(results); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+	printSimulation(stdout, eventType, results)
+	return 0
+}
+
+// payloadEventType works out the event type from the webhook's `object_kind`
+func payloadEventType(payload []byte) (gitlab.EventType, error) {
+	var kind struct {
+		ObjectKind string `json:"object_kind"`
+	}
+	if err := json.Unmarshal(payload, &kind); err != nil {
+		return "", fmt.Errorf("webhook could not be decoded: %v", err)
+	}
+	eventType, ok := eventTypes[kind.ObjectKind]
+	if !ok {
+		return "", fmt.Errorf("the event type of object_kind %q is unknown, use -event to set it", kind.ObjectKind)
+	}
+	return eventType, nil
+}
+
+// printSimulation prints each policy, whether it matched and the requests it would have made
+func printSimulation(out io.Writer, eventType gitlab.EventType, results []policy.WebhookResult) {
+	matched := 0
+	for _, result := range results {
+		if !result.Matched {
+			fmt.Fprintf(out, "- %s: not matched\n", result.Policy.Name)
+			printFailedConditions(out, result.Trace, "    ")
+			continue
+		}
+		matched++
+		fmt.Fprintf(out, "+ %s: matched\n", result.Policy.Name)
+		if len(result.Actions) == 0 {
+			fmt.Fprintln(out, "    no updates")
+		}
+		for _, action := range result.Actions {
+			if action.Error != "" {
+				fmt.Fprintf(out, "    %s update failed: %s\n", action.Update, action.Error)
+				continue
+			}
+			if action.Request == nil {
+				continue
+			}
+			fmt.Fprintf(out, "    %s update: %s %s", action.Update, action.Request.Method, action.Request.Endpoint)
+			if len(action.Request.Body) > 0 {
+				fmt.Fprintf(out, " %s", action.Request.Body)
+			}
+			fmt.Fprintln(out)
+		}
+	}
+	fmt.Fprintf(out, "%d of %d policies matched the %s\n", matched, len(results), eventType)
+}
+
+// printFailedConditions prints each condition that didn't pass, along with the failed conditions nested within it
+func printFailedConditions(out io.Writer, trace policy.Trace, indent string) {
+	for _, condition := range trace {
+		if condition.Passed {
+			continue
+		}
+		if condition.Children != nil {
+			fmt.Fprintf(out, "%s%s: not met", indent, condition.Condition)
+		} else {
+			fmt.Fprintf(out, "%s%s: expected %v, got %v", indent, condition.Condition, condition.Expected, condition.Actual)
+		}
+		if condition.Reason != "" {
+			fmt.Fprintf(out, " (%s)", condition.Reason)
+		}
+		fmt.Fprintln(out)
+		printFailedConditions(out, condition.Children, indent+"  ")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"gitlab.com/jonny7/quetzal/policy"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	data := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout []string
+		stderr []string
+	}{
+		{
+			name: "Matched and unmatched policies",
+			args: []string{"-policies", "testdata/valid.yaml", "-user", "quetzal", "testdata/merge_request.json"},
+			code: 0,
+			stdout: []string{
+				"+ thank bug reports: matched",
+				`    note update: POST /api/v4/projects/1/merge_requests/7/notes {"body":"thanks for the fix"}`,
+				"- close issues: not matched",
+				"    resource: expected Issue Hook, got Merge Request Hook",
+				"1 of 2 policies matched the Merge Request Hook",
+			},
+		},
+		{
+			name:   "Event type given",
+			args:   []string{"-policies", "testdata/valid.yaml", "-user", "quetzal", "-event", "Issue Hook", "testdata/merge_request.json"},
+			code:   0,
+			stdout: []string{"- thank bug reports: not matched", "    resource:", "+ close issues: matched", "    status update:", "1 of 2 policies matched the Issue Hook"},
+		},
+		{
+			name:   "Invalid policies",
+			args:   []string{"-policies", "testdata/invalid.yaml", "testdata/merge_request.json"},
+			code:   1,
+			stderr: []string{"testdata/invalid.yaml:5:15:", "testdata/invalid.yaml:9:7:"},
+		},
+		{
+			name:   "Unknown object kind",
+			args:   []string{"-policies", "testdata/valid.yaml", "testdata/push.json"},
+			code:   2,
+			stderr: []string{`testdata/push.json: the event type of object_kind "push" is unknown, use -event to set it`},
+		},
+		{
+			name:   "Missing webhook",
+			args:   []string{"-policies", "testdata/valid.yaml", "testdata/missing.json"},
+			code:   1,
+			stderr: []string{"testdata/missing.json: open testdata/missing.json"},
+		},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := simulate(d.args, &stdout, &stderr); code != d.code {
+				t.Errorf("expected exit code %d, but got %d: %s", d.code, code, stderr.String())
+			}
+			assertLines(t, "stdout", stdout.String(), d.stdout)
+			assertLines(t, "stderr", stderr.String(), d.stderr)
+		})
+	}
+}
+
+func TestSimulateJSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"-json", "-policies", "testdata/valid.yaml", "-user", "quetzal", "testdata/merge_request.json"}
+	if code := simulate(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, but got %d: %s", code, stderr.String())
+	}
+	var results []policy.WebhookResult
+	if err := json.Unmarshal(stdout.Bytes(), &results); err != nil {
+		t.Fatalf("expected the results as json: %v", err)
+	}
+	if len(results) != 2 || !results[0].Matched || results[1].Matched {
+		t.Fatalf("expected only the first policy to match, got %+v", results)
+	}
+	if request := results[0].Actions[0].Request; request == nil || request.Endpoint != "/api/v4/projects/1/merge_requests/7/notes" {
+		t.Errorf("expected the note request, got %+v", results[0].Actions[0])
+	}
+}
+
+func TestSimulateUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := simulate(nil, &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2 without a webhook, but got %d", code)
+	}
+	if !bytes.HasPrefix(stderr.Bytes(), []byte("usage: quetzal simulate")) {
+		t.Errorf("expected the usage to be printed, got %q", stderr.String())
+	}
+}
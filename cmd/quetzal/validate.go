@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"gitlab.com/jonny7/quetzal/policy"
+	"io"
+	"os"
+)
+
+// validate checks each of the policy files, printing every error found in them.
+// It returns the exit code: 0 when all files are valid, 1 when any are invalid and 2 on bad usage
+func validate(files []string, stdout, stderr io.Writer) int {
+	if len(files) == 0 {
+		fmt.Fprintln(stderr, "usage: quetzal validate <file> [file...]")
+		return 2
+	}
+	code := 0
+	for _, file := range files {
+		body, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", file, err)
+			code = 1
+			continue
+		}
+		errs := policy.ValidateYAML(body)
+		for _, e := range errs {
+			fmt.Fprintf(stderr, "%s:%v\n", file, e)
+		}
+		if len(errs) > 0 {
+			code = 1
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: ok\n", file)
+	}
+	return code
+}
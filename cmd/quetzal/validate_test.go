@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	data := []struct {
+		name   string
+		files  []string
+		code   int
+		stdout []string
+		stderr []string
+	}{
+		{name: "Valid file", files: []string{"testdata/valid.yaml"}, code: 0, stdout: []string{"testdata/valid.yaml: ok"}},
+		{
+			name:  "Every error is reported",
+			files: []string{"testdata/invalid.yaml"},
+			code:  1,
+			stderr: []string{
+				`testdata/invalid.yaml:5:15: policy "reopen merge requests": policies[0].actions.status: merge Request Events only allow for statuses of open, closed, approved`,
+				`testdata/invalid.yaml:9:7: policy "typo": policies[1].conditions.labelz: unknown field "labelz"`,
+			},
+		},
+		{
+			name:   "Every file is checked",
+			files:  []string{"testdata/invalid.yaml", "testdata/valid.yaml"},
+			code:   1,
+			stdout: []string{"testdata/valid.yaml: ok"},
+			stderr: []string{"testdata/invalid.yaml:5:15:", "testdata/invalid.yaml:9:7:"},
+		},
+		{name: "Missing file", files: []string{"testdata/missing.yaml"}, code: 1, stderr: []string{"testdata/missing.yaml: open testdata/missing.yaml"}},
+		{name: "No files", code: 2, stderr: []string{"usage: quetzal validate"}},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := validate(d.files, &stdout, &stderr); code != d.code {
+				t.Errorf("expected exit code %d, but got %d: %s", d.code, code, stderr.String())
+			}
+			assertLines(t, "stdout", stdout.String(), d.stdout)
+			assertLines(t, "stderr", stderr.String(), d.stderr)
+		})
+	}
+}
+
+// assertLines checks that each expected line starts one of the lines written to out, and that nothing else was written
+func assertLines(t *testing.T, name, out string, expected []string) {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if out == "" {
+		lines = nil
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines on %s, but got %d: %q", len(expected), name, len(lines), out)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, expected[i]) {
+			t.Errorf("expected line %d on %s to start with %q, but got %q", i+1, name, expected[i], line)
+		}
+	}
+}
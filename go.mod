@@ -6,6 +6,7 @@ require (
 	github.com/go-chi/chi/v5 v5.0.4
 	github.com/go-chi/httplog v0.2.0
 	github.com/go-chi/render v1.0.1
+	github.com/hashicorp/go-retryablehttp v0.6.8
 	github.com/rs/zerolog v1.24.0
 	github.com/xanzy/go-gitlab v0.50.4
 	go.uber.org/goleak v1.1.12
@@ -16,7 +17,6 @@ require (
 	github.com/golang/protobuf v1.2.0 // indirect
 	github.com/google/go-querystring v1.0.0 // indirect
 	github.com/hashicorp/go-cleanhttp v0.5.1 // indirect
-	github.com/hashicorp/go-retryablehttp v0.6.8 // indirect
 	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4 // indirect
 	golang.org/x/oauth2 v0.0.0-20181106182150-f42d05182288 // indirect
 	golang.org/x/time v0.0.0-20191024005414-555d28b269f0 // indirect
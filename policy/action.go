@@ -22,6 +22,14 @@ type Action struct {
 	Mention []string `yaml:"mention,omitempty"`
 	// Comment will leave a comment on said issue
 	Comment string `yaml:"comment,omitempty"`
+	// Assign sets who the issue or merge request is assigned to
+	Assign *Assign `yaml:"assign,omitempty"`
+	// AssignReviewers sets who reviews the merge request
+	AssignReviewers *Assign `yaml:"assignReviewers,omitempty"`
+	// Size labels a merge request by the lines and files it changes
+	Size *Size `yaml:"size,omitempty"`
+	// Retry configures how failed updates to GitLab are retried
+	Retry *Retry `yaml:"retry,omitempty"`
 }
 
 // Labels represents an array of labels
@@ -42,13 +50,61 @@ func (a Action) commentate() string {
 	return fmt.Sprintf("%s%s", out, a.Comment)
 }
 
+// render replaces any `{{name}}` placeholders in the Action with the given arguments,
+// placeholders without a matching argument are left as they are
+func (a Action) render(args map[string]string) Action {
+	var pairs []string
+	for k, v := range args {
+		pairs = append(pairs, fmt.Sprintf("{{%s}}", k), v)
+	}
+	r := strings.NewReplacer(pairs...)
+	renderAll := func(sl []string) []string {
+		if sl == nil {
+			return nil
+		}
+		rendered := make([]string, len(sl))
+		for i, s := range sl {
+			rendered[i] = r.Replace(s)
+		}
+		return rendered
+	}
+	rendered := a
+	rendered.Labels = Labels{renderAll(a.Labels.Labels)}
+	rendered.RemoveLabels = renderAll(a.RemoveLabels)
+	rendered.Mention = renderAll(a.Mention)
+	rendered.Comment = r.Replace(a.Comment)
+	renderAssign := func(assign *Assign) *Assign {
+		if assign == nil {
+			return nil
+		}
+		users := *assign
+		users.Users = renderAll(assign.Users)
+		return &users
+	}
+	rendered.Assign = renderAssign(a.Assign)
+	rendered.AssignReviewers = renderAssign(a.AssignReviewers)
+	return rendered
+}
+
 func (a Action) updateLabels() bool {
-	if a.RemoveLabels != nil || a.Labels.Labels != nil {
+	if a.RemoveLabels != nil || a.Labels.Labels != nil || a.Size != nil {
 		return true
 	}
 	return false
 }
 
+func (a Action) sizeLabels() *Size {
+	return a.Size
+}
+
+func (a Action) assign() *Assign {
+	return a.Assign
+}
+
+func (a Action) assignReviewers() *Assign {
+	return a.AssignReviewers
+}
+
 func (a Action) addNote() bool {
 	if a.Mention != nil || a.Comment != "" {
 		return true
@@ -60,16 +116,12 @@ func (a Action) updateState() bool {
 	return a.Status != ""
 }
 
-// validate the actions are possible based on the webhook
-func (a Action) validate(eventType gitlab.EventType) error {
-	// validate status action against the type of webhook it wants to update
+// validateStatus validates the status action against the type of webhook it wants to update
+func (a Action) validateStatus(eventType gitlab.EventType) error {
 	if a.Status == "" {
 		return nil
 	}
-	if err := a.Status.fieldValidator(eventType); err != nil {
-		return err
-	}
-	return nil
+	return a.Status.fieldValidator(eventType)
 }
 
 func (as ActionStatus) fieldValidator(eventType gitlab.EventType) error {
@@ -81,5 +133,13 @@ func (as ActionStatus) fieldValidator(eventType gitlab.EventType) error {
 			return fmt.Errorf("merge Request Events only allow for statuses of open, closed, approved")
 		}
 	}
+	if eventType == gitlab.EventTypeIssue || eventType == gitlab.EventConfidentialIssue {
+		switch strings.ToLower(string(as)) {
+		case string(issueStateOpen), string(issueStateClose), string(issueStateReopen):
+			return nil
+		default:
+			return fmt.Errorf("issue Events only allow for statuses of open, close, reopen")
+		}
+	}
 	return fmt.Errorf("the status of %s for event type %s is invalid", as, eventType)
 }
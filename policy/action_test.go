@@ -88,7 +88,7 @@ func TestUpdateStatus(t *testing.T) {
 	}
 }
 
-func TestActionValidate(t *testing.T) {
+func TestActionValidateStatus(t *testing.T) {
 	//: 16
 	data := []struct {
 		name          string
@@ -100,10 +100,12 @@ func TestActionValidate(t *testing.T) {
 		{name: "No Status", action: Action{}, event: gitlab.EventTypeMergeRequest, expectedIsNil: true, errMsg: "expected true as Action Status is empty"},
 		{name: "Status Accurate", action: Action{Status: ActionStatus(mergeRequestStateApproved)}, event: gitlab.EventTypeMergeRequest, expectedIsNil: true, errMsg: "expected true as status on action is valid for type"},
 		{name: "Status Invalid for Event", action: Action{Status: ActionStatus(mergeRequestStateApproved)}, event: gitlab.EventTypeSystemHook, expectedIsNil: false, errMsg: "expected false as status on action is invalid for type"},
+		{name: "Issue Status Accurate", action: Action{Status: ActionStatus(issueStateReopen)}, event: gitlab.EventTypeIssue, expectedIsNil: true, errMsg: "expected true as status on action is valid for issues"},
+		{name: "Issue Status Invalid", action: Action{Status: ActionStatus(mergeRequestStateApproved)}, event: gitlab.EventTypeIssue, expectedIsNil: false, errMsg: "expected false as issues cannot be approved"},
 	}
 	for _, d := range data {
 		t.Run(d.name, func(t *testing.T) {
-			got := d.action.validate(d.event)
+			got := d.action.validateStatus(d.event)
 			want := expectedIsNil(got)
 			if want != d.expectedIsNil {
 				t.Errorf(d.errMsg)
@@ -111,3 +113,23 @@ func TestActionValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestActionRender(t *testing.T) {
+	action := Action{Labels: Labels{[]string{"{{name}}"}}, Mention: []string{"{{who}}"}, Comment: "assigned to {{who}} by {{author}}"}
+	got := action.render(map[string]string{"name": "bug", "who": "jonny7"})
+	if got.Labels.Labels[0] != "bug" {
+		t.Errorf("expected label to be rendered as bug, got %s", got.Labels.Labels[0])
+	}
+	if got.Mention[0] != "jonny7" {
+		t.Errorf("expected mention to be rendered as jonny7, got %s", got.Mention[0])
+	}
+	if got.Comment != "assigned to jonny7 by {{author}}" {
+		t.Errorf("expected unknown placeholders to be left as they are, got %s", got.Comment)
+	}
+	if got.RemoveLabels != nil {
+		t.Errorf("expected empty fields to stay empty, got %v", got.RemoveLabels)
+	}
+	if action.Labels.Labels[0] != "{{name}}" {
+		t.Errorf("expected the original action to be unchanged, got %s", action.Labels.Labels[0])
+	}
+}
@@ -0,0 +1,206 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"sort"
+	"strings"
+)
+
+// AssignStrategy is how an Assign picks from its users
+type AssignStrategy string
+
+const (
+	// assignFixed picks every one of the users
+	assignFixed AssignStrategy = "fixed"
+	// assignRoundRobin picks the users in turn, carrying on from where the last pick left off
+	assignRoundRobin AssignStrategy = "roundRobin"
+	// assignLeastLoaded picks the users with the fewest open merge requests
+	assignLeastLoaded AssignStrategy = "leastLoaded"
+)
+
+// Assign is the action that assigns users to an issue or merge request, or makes them its reviewers.
+// The picked users replace any that are already assigned
+type Assign struct {
+	// Users are the usernames that can be picked
+	Users []string `yaml:"users"`
+	// Strategy is `fixed`, `roundRobin` or `leastLoaded`, `fixed` by default
+	Strategy AssignStrategy `yaml:"strategy,omitempty"`
+	// Count is how many of the Users `roundRobin` and `leastLoaded` pick, 1 by default
+	Count int `yaml:"count,omitempty"`
+}
+
+// RotationStore keeps the position of each round-robin rotation
+type RotationStore interface {
+	// Rotate returns the position of the rotation with the key and moves it on by step,
+	// a step of 0 looks at the position without moving it
+	Rotate(key string, step int) (int, error)
+}
+
+// candidate is one of an Assign's users once their id has been looked up
+type candidate struct {
+	username string
+	id       int
+	// index is the candidate's position in the Assign's Users
+	index int
+}
+
+// picked are the users an Assign picked
+type picked struct {
+	ids       []int
+	usernames []string
+}
+
+// strategy is the Assign's AssignStrategy, defaulting to fixed
+func (a *Assign) strategy() AssignStrategy {
+	if a.Strategy == "" {
+		return assignFixed
+	}
+	return a.Strategy
+}
+
+// count is how many users are picked, defaulting to 1
+func (a *Assign) count() int {
+	if a.Count == 0 {
+		return 1
+	}
+	return a.Count
+}
+
+// rotationKey identifies the rotation of the Users, so policies with the same users share their turns
+func (a *Assign) rotationKey(field string) string {
+	return field + "/" + strings.ToLower(strings.Join(a.Users, ","))
+}
+
+// fieldValidator ensures the Assign has users to pick, and can be used with the resource.
+// Reviewers can only be assigned to merge requests, and comments can only assign users when
+// the note condition limits them to comments on issues or merge requests
+func (a *Assign) fieldValidator(field string, eventType gitlab.EventType, note *Note) error {
+	if a == nil {
+		return nil
+	}
+	switch {
+	case field == "assignReviewers" && eventType != gitlab.EventTypeMergeRequest:
+		return fmt.Errorf("%s can only be used with the %s resource, not %s", field, gitlab.EventTypeMergeRequest, eventType)
+	case eventType == gitlab.EventTypeNote || eventType == gitlab.EventConfidentialNote:
+		if note == nil || note.Type == nil || (*note.Type != NoteIssue && *note.Type != NoteMergeRequest) {
+			return fmt.Errorf("%s can only be used with comments when the noteType is `%s` or `%s`", field, NoteIssue, NoteMergeRequest)
+		}
+	case eventType != gitlab.EventTypeMergeRequest && eventType != gitlab.EventTypeIssue && eventType != gitlab.EventConfidentialIssue:
+		return fmt.Errorf("%s can only be used with issues and merge requests, not %s", field, eventType)
+	case len(a.Users) == 0:
+		return fmt.Errorf("%s must have users to pick from", field)
+	}
+	seen := map[string]bool{}
+	for _, user := range a.Users {
+		username := strings.ToLower(strings.TrimPrefix(user, "@"))
+		if username == "" || seen[username] {
+			return fmt.Errorf("%s users must be unique usernames, but received: %v", field, a.Users)
+		}
+		seen[username] = true
+	}
+	switch a.strategy() {
+	case assignFixed:
+		if a.Count != 0 {
+			return fmt.Errorf("%s count can't be used with the %s strategy, which picks every user", field, assignFixed)
+		}
+	case assignRoundRobin, assignLeastLoaded:
+		if a.Count < 0 || a.count() > len(a.Users) {
+			return fmt.Errorf("%s count must be between 1 and the number of users, but received: %d", field, a.Count)
+		}
+	default:
+		return fmt.Errorf("%s strategy allowed options are: `%s`, `%s`, `%s`. But received: %s", field, assignFixed, assignRoundRobin, assignLeastLoaded, a.Strategy)
+	}
+	return nil
+}
+
+// candidates looks up the id of each of the users, leaving out the excluded id
+func (a *Assign) candidates(exclude int, finder UserFinder) ([]candidate, error) {
+	var candidates []candidate
+	for i, user := range a.Users {
+		username := strings.TrimPrefix(user, "@")
+		id, err := finder.UserID(username)
+		if err != nil {
+			return nil, fmt.Errorf("%s couldn't be looked up: %w", username, err)
+		}
+		if id != exclude {
+			candidates = append(candidates, candidate{username: username, id: id, index: i})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("none of the users can be picked")
+	}
+	return candidates, nil
+}
+
+// pick chooses the users following the strategy. Reviewing is whether reviewers are being picked, which
+// leastLoaded counts the reviews of, and the excluded id is left out, such as a merge request's author.
+// The rotation isn't moved on during a dry run
+func (a *Assign) pick(field string, reviewing bool, exclude int, opts Options) (picked, error) {
+	if opts.Users == nil {
+		return picked{}, errors.New("users can't be looked up without a GitLab client")
+	}
+	candidates, err := a.candidates(exclude, opts.Users)
+	if err != nil {
+		return picked{}, err
+	}
+	count := a.count()
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+	switch a.strategy() {
+	case assignRoundRobin:
+		if opts.Rotations == nil {
+			return picked{}, errors.New("the rotation can't be followed without a rotation store")
+		}
+		step := count
+		if opts.DryRun {
+			step = 0
+		}
+		position, rotateErr := opts.Rotations.Rotate(a.rotationKey(field), step)
+		if rotateErr != nil {
+			return picked{}, fmt.Errorf("the rotation couldn't be moved on: %v", rotateErr)
+		}
+		// the position is of the Users, so leaving a user out doesn't shift the turns of the others.
+		// Candidates are taken from the position onwards, stepping past any user left out
+		start := position % len(a.Users)
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return (candidates[i].index-start+len(a.Users))%len(a.Users) < (candidates[j].index-start+len(a.Users))%len(a.Users)
+		})
+		candidates = candidates[:count]
+	case assignLeastLoaded:
+		load := map[int]int{}
+		for _, c := range candidates {
+			if load[c.id], err = opts.Users.OpenMergeRequests(c.id, reviewing); err != nil {
+				return picked{}, fmt.Errorf("the open merge requests of %s couldn't be looked up: %w", c.username, err)
+			}
+		}
+		// ties keep the order of the users
+		sort.SliceStable(candidates, func(i, j int) bool { return load[candidates[i].id] < load[candidates[j].id] })
+		candidates = candidates[:count]
+	}
+	var p picked
+	for _, c := range candidates {
+		p.ids = append(p.ids, c.id)
+		p.usernames = append(p.usernames, c.username)
+	}
+	return p, nil
+}
+
+// picker picks the users the first time it's called, so a retried update assigns the same users
+// and a rotation is only moved on once. The picked usernames are kept in assigned for the result
+func (a *Assign) picker(field string, reviewing bool, exclude int, opts Options, assigned *[]string) func() ([]int, error) {
+	var ids []int
+	return func() ([]int, error) {
+		if ids != nil {
+			return ids, nil
+		}
+		p, err := a.pick(field, reviewing, exclude, opts)
+		if err != nil {
+			return nil, err
+		}
+		ids, *assigned = p.ids, p.usernames
+		return ids, nil
+	}
+}
@@ -0,0 +1,180 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// memoryRotations is a RotationStore for tests
+type memoryRotations struct {
+	positions map[string]int
+	err       error
+}
+
+func (m *memoryRotations) Rotate(key string, step int) (int, error) {
+	position := m.positions[key]
+	m.positions[key] += step
+	return position, m.err
+}
+
+// stubUserFinder knows alice, bob and carol, with bob having the fewest open merge requests
+func stubUserFinder() *userFinder {
+	return &userFinder{usernames: map[int]string{1: "alice", 2: "bob", 3: "carol"}, open: map[int]int{1: 4, 2: 1, 3: 4}}
+}
+
+func TestAssignValidate(t *testing.T) {
+	issueNote, snippetNote, mergeRequestNote := NoteIssue, NoteSnippet, NoteMergeRequest
+	data := []struct {
+		name          string
+		actions       Action
+		eventType     gitlab.EventType
+		conditions    Condition
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "Fixed", actions: Action{Assign: &Assign{Users: []string{"alice", "bob"}}}, eventType: gitlab.EventTypeIssue, expectedIsNil: true, errMsg: "expected nil for a fixed list"},
+		{name: "Round Robin Reviewers", actions: Action{AssignReviewers: &Assign{Users: []string{"alice", "bob", "carol"}, Strategy: assignRoundRobin, Count: 2}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: true, errMsg: "expected nil for round-robin reviewers"},
+		{name: "No Users", actions: Action{Assign: &Assign{Strategy: assignLeastLoaded}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error without users to pick"},
+		{name: "Duplicate Users", actions: Action{Assign: &Assign{Users: []string{"alice", "@Alice"}}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as alice is listed twice"},
+		{name: "Unknown Strategy", actions: Action{Assign: &Assign{Users: []string{"alice"}, Strategy: "random"}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error for an unknown strategy"},
+		{name: "Count Above Users", actions: Action{Assign: &Assign{Users: []string{"alice"}, Strategy: assignRoundRobin, Count: 2}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as there aren't enough users"},
+		{name: "Fixed Count", actions: Action{Assign: &Assign{Users: []string{"alice", "bob"}, Count: 1}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as fixed picks every user"},
+		{name: "Issue Reviewers", actions: Action{AssignReviewers: &Assign{Users: []string{"alice"}}}, eventType: gitlab.EventTypeIssue, expectedIsNil: false, errMsg: "expected an error as issues don't have reviewers"},
+		{name: "Note Assign", actions: Action{Assign: &Assign{Users: []string{"alice"}}}, eventType: gitlab.EventTypeNote, expectedIsNil: false, errMsg: "expected an error as the note could be on a commit or snippet"},
+		{name: "Issue Note Assign", actions: Action{Assign: &Assign{Users: []string{"{{user}}"}}}, eventType: gitlab.EventTypeNote, conditions: Condition{Note: &Note{Type: &issueNote, Command: "@quetzal assign <user:user>"}}, expectedIsNil: true, errMsg: "expected nil as comments on issues can assign users"},
+		{name: "Snippet Note Assign", actions: Action{Assign: &Assign{Users: []string{"alice"}}}, eventType: gitlab.EventTypeNote, conditions: Condition{Note: &Note{Type: &snippetNote}}, expectedIsNil: false, errMsg: "expected an error as snippets can't be assigned"},
+		{name: "Note Reviewers", actions: Action{AssignReviewers: &Assign{Users: []string{"alice"}}}, eventType: gitlab.EventTypeNote, conditions: Condition{Note: &Note{Type: &mergeRequestNote}}, expectedIsNil: false, errMsg: "expected an error as only merge request policies can assign reviewers"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := Policy{Resource: Resource{d.eventType}, Conditions: d.conditions, Actions: d.actions}.Validate()
+			want := expectedIsNil(got)
+			if want != d.expectedIsNil {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestAssignPick(t *testing.T) {
+	users := []string{"alice", "bob", "carol"}
+	data := []struct {
+		name     string
+		assign   Assign
+		exclude  int
+		expected []string
+	}{
+		{name: "Fixed", assign: Assign{Users: users}, expected: users},
+		{name: "Fixed Without the Author", assign: Assign{Users: users}, exclude: 2, expected: []string{"alice", "carol"}},
+		{name: "Least Loaded", assign: Assign{Users: users, Strategy: assignLeastLoaded}, expected: []string{"bob"}},
+		{name: "Least Loaded Ties Keep Order", assign: Assign{Users: users, Strategy: assignLeastLoaded, Count: 2}, expected: []string{"bob", "alice"}},
+		{name: "Least Loaded Without the Author", assign: Assign{Users: users, Strategy: assignLeastLoaded}, exclude: 2, expected: []string{"alice"}},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got, err := d.assign.pick("assign", false, d.exclude, Options{Users: stubUserFinder()})
+			if err != nil || !reflect.DeepEqual(got.usernames, d.expected) {
+				t.Errorf("expected %v, got %v and error %v", d.expected, got.usernames, err)
+			}
+		})
+	}
+}
+
+func TestAssignRoundRobin(t *testing.T) {
+	assign := Assign{Users: []string{"alice", "bob", "carol"}, Strategy: assignRoundRobin, Count: 2}
+	rotations := &memoryRotations{positions: map[string]int{}}
+	opts := Options{Users: stubUserFinder(), Rotations: rotations}
+	for i, expected := range [][]string{{"alice", "bob"}, {"carol", "alice"}, {"bob", "carol"}} {
+		got, err := assign.pick("assign", false, 0, opts)
+		if err != nil || !reflect.DeepEqual(got.usernames, expected) {
+			t.Fatalf("expected pick %d to be %v, got %v and error %v", i+1, expected, got.usernames, err)
+		}
+	}
+	opts.DryRun = true
+	for i := 0; i < 2; i++ {
+		if got, _ := assign.pick("assign", false, 0, opts); !reflect.DeepEqual(got.usernames, []string{"alice", "bob"}) {
+			t.Errorf("expected a dry run not to move the rotation on, got %v", got.usernames)
+		}
+	}
+	if _, err := assign.pick("assign", false, 0, Options{Users: stubUserFinder()}); err == nil {
+		t.Errorf("expected an error without a rotation store")
+	}
+	// bob is left out as the author, so their turns are stepped past rather than shifting everyone else's
+	assign = Assign{Users: []string{"alice", "bob", "carol"}, Strategy: assignRoundRobin}
+	rotations = &memoryRotations{positions: map[string]int{}}
+	opts = Options{Users: stubUserFinder(), Rotations: rotations}
+	bob, _ := opts.Users.UserID("bob")
+	for i, expected := range []string{"alice", "carol", "carol", "alice"} {
+		got, err := assign.pick("assignReviewers", true, bob, opts)
+		if err != nil || !reflect.DeepEqual(got.usernames, []string{expected}) {
+			t.Fatalf("expected pick %d to be %s, got %v and error %v", i+1, expected, got.usernames, err)
+		}
+	}
+	rotations.err = errors.New("disk full")
+	if _, err := assign.pick("assign", false, 0, Options{Users: stubUserFinder(), Rotations: rotations}); err == nil {
+		t.Errorf("expected the rotation store's error")
+	}
+}
+
+func TestExecuteAssignReviewers(t *testing.T) {
+	mux, server, client := setup(t)
+	defer teardown(server)
+
+	me := stubMergeEventAdaptor()
+	me.ObjectAttributes.AuthorID = 1
+	var body map[string][]int
+	mux.HandleFunc(stubUpdatedMergeEventEndPoint(me), func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if err := json.NewEncoder(w).Encode(&gitlab.MergeRequest{}); err != nil {
+			t.Errorf("failed to encode response")
+		}
+	})
+
+	rotations := &memoryRotations{positions: map[string]int{}}
+	action := Action{AssignReviewers: &Assign{Users: []string{"alice", "bob", "carol"}, Strategy: assignRoundRobin}}
+	got := me.execute(action, client, Options{Users: stubUserFinder(), Rotations: rotations})
+	if len(got) != 1 || got[0].Error != "" || got[0].Update != updateKindReviewers {
+		t.Fatalf("expected the reviewers update to succeed, got %+v", got)
+	}
+	if !reflect.DeepEqual(body["reviewer_ids"], []int{2}) || !reflect.DeepEqual(got[0].Assigned, []string{"bob"}) {
+		t.Errorf("expected bob to review as alice is the author, got %v and %v", body, got[0].Assigned)
+	}
+	if rotations.positions["assignReviewers/alice,bob,carol"] != 1 {
+		t.Errorf("expected the rotation to move on once, got %v", rotations.positions)
+	}
+}
+
+func TestExecuteAssignRetriesSameUsers(t *testing.T) {
+	mux, server, client := setupWithoutRetries(t)
+	defer teardown(server)
+
+	ie := stubIssueEventAdaptor()
+	requests := 0
+	var body map[string][]int
+	mux.HandleFunc("/api/v4/projects/1/issues/12", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if err := json.NewEncoder(w).Encode(&gitlab.Issue{}); err != nil {
+			t.Errorf("failed to encode response")
+		}
+	})
+
+	rotations := &memoryRotations{positions: map[string]int{}}
+	action := Action{Assign: &Assign{Users: []string{"alice", "bob"}, Strategy: assignRoundRobin}, Retry: &Retry{MaxAttempts: 2}}
+	got := ie.execute(action, client, Options{Users: stubUserFinder(), Rotations: rotations, sleep: func(time.Duration) {}})
+	if len(got) != 1 || got[0].Error != "" || got[0].Attempts != 2 {
+		t.Fatalf("expected the assignees update to succeed when retried, got %+v", got)
+	}
+	if !reflect.DeepEqual(body["assignee_ids"], []int{1}) || rotations.positions["assign/alice,bob"] != 1 {
+		t.Errorf("expected the retry to assign alice again without moving the rotation on, got %v and %v", body, rotations.positions)
+	}
+}
@@ -0,0 +1,207 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// argumentType is the type of positional argument a Command accepts
+type argumentType string
+
+const (
+	// argumentString is a single word, and the default when no type is given
+	argumentString argumentType = "string"
+	// argumentInt is a single whole number
+	argumentInt argumentType = "int"
+	// argumentUser is a username, the leading `@` is removed so it can be used in a mention
+	argumentUser argumentType = "user"
+	// argumentText is the remainder of the line and must be the last argument
+	argumentText argumentType = "text"
+)
+
+// argument is a named positional argument declared in a Command as `<name>` or `<name:type>`
+type argument struct {
+	name string
+	kind argumentType
+}
+
+// commandToken is a single word of a Command, which is either a literal or an argument
+type commandToken struct {
+	literal  string
+	argument *argument
+}
+
+// tokens splits the Command into its literals and arguments
+func (c Command) tokens() ([]commandToken, error) {
+	var tokens []commandToken
+	fields := strings.Fields(string(c))
+	for i, field := range fields {
+		if !strings.HasPrefix(field, "<") && !strings.HasSuffix(field, ">") {
+			tokens = append(tokens, commandToken{literal: field})
+			continue
+		}
+		if !strings.HasPrefix(field, "<") || !strings.HasSuffix(field, ">") || len(field) < 3 {
+			return nil, fmt.Errorf("command `%s` has a malformed argument: %s", c, field)
+		}
+		name, kind := strings.TrimSuffix(strings.TrimPrefix(field, "<"), ">"), argumentString
+		if parts := strings.SplitN(name, ":", 2); len(parts) == 2 {
+			name, kind = parts[0], argumentType(parts[1])
+		}
+		switch kind {
+		case argumentString, argumentInt, argumentUser:
+		case argumentText:
+			if i != len(fields)-1 {
+				return nil, fmt.Errorf("command `%s` can only have a text argument at the end", c)
+			}
+		default:
+			return nil, fmt.Errorf("command `%s` has an argument with an unknown type `%s`, available types are `%s`, `%s`, `%s`, `%s`", c, kind, argumentString, argumentInt, argumentUser, argumentText)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("command `%s` has an argument without a name", c)
+		}
+		tokens = append(tokens, commandToken{argument: &argument{name: name, kind: kind}})
+	}
+	if len(tokens) == 0 || tokens[0].argument != nil {
+		return nil, fmt.Errorf("command `%s` must start with a word rather than an argument", c)
+	}
+	return tokens, nil
+}
+
+// validate ensures the Command can be parsed
+func (c Command) validate() error {
+	if c == "" {
+		return nil
+	}
+	_, err := c.tokens()
+	return err
+}
+
+// prefix returns the literals of the Command before its first argument,
+// these identify that a note is invoking the Command
+func (c Command) prefix() []string {
+	tokens, err := c.tokens()
+	if err != nil {
+		return nil
+	}
+	var prefix []string
+	for _, token := range tokens {
+		if token.argument != nil {
+			break
+		}
+		prefix = append(prefix, token.literal)
+	}
+	return prefix
+}
+
+// invokedIn reports whether any line of the body contains the Command's prefix
+func (c Command) invokedIn(body string) bool {
+	prefix := c.prefix()
+	if prefix == nil {
+		return false
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if indexOfPrefix(strings.Fields(line), prefix) != -1 {
+			return true
+		}
+	}
+	return false
+}
+
+// arguments parses the arguments given to the Command in the body. The first line that
+// invokes the Command with valid arguments is used, otherwise the first parsing error is returned
+func (c Command) arguments(body string) (map[string]string, error) {
+	tokens, err := c.tokens()
+	if err != nil {
+		return nil, err
+	}
+	prefix := c.prefix()
+	var firstErr error
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		i := indexOfPrefix(fields, prefix)
+		if i == -1 {
+			continue
+		}
+		args, parseErr := parseArguments(tokens[len(prefix):], fields[i+len(prefix):])
+		if parseErr == nil {
+			return args, nil
+		}
+		if firstErr == nil {
+			firstErr = parseErr
+		}
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("command `%s` was not found", c)
+	}
+	return nil, firstErr
+}
+
+// parseArguments walks the remaining tokens of a Command and the fields after its prefix
+func parseArguments(tokens []commandToken, fields []string) (map[string]string, error) {
+	args := map[string]string{}
+	for i, token := range tokens {
+		if token.argument != nil && token.argument.kind == argumentText {
+			if i >= len(fields) {
+				return nil, fmt.Errorf("missing argument `%s`", token.argument.name)
+			}
+			args[token.argument.name] = strings.Join(fields[i:], " ")
+			return args, nil
+		}
+		if i >= len(fields) {
+			if token.argument != nil {
+				return nil, fmt.Errorf("missing argument `%s`", token.argument.name)
+			}
+			return nil, fmt.Errorf("missing `%s`", token.literal)
+		}
+		if token.argument == nil {
+			if !strings.EqualFold(token.literal, fields[i]) {
+				return nil, fmt.Errorf("expected `%s` but got `%s`", token.literal, fields[i])
+			}
+			continue
+		}
+		value, err := token.argument.parse(fields[i])
+		if err != nil {
+			return nil, err
+		}
+		args[token.argument.name] = value
+	}
+	// a command without arguments is only looking for its literals, so anything after them is ignored
+	if len(args) > 0 && len(fields) > len(tokens) {
+		return nil, fmt.Errorf("unexpected argument `%s`", fields[len(tokens)])
+	}
+	return args, nil
+}
+
+// parse checks the value is of the argument's type and normalises it
+func (a argument) parse(value string) (string, error) {
+	switch a.kind {
+	case argumentInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return "", fmt.Errorf("argument `%s` must be a whole number but got `%s`", a.name, value)
+		}
+	case argumentUser:
+		value = strings.TrimPrefix(value, "@")
+		if value == "" {
+			return "", fmt.Errorf("argument `%s` must be a username", a.name)
+		}
+	}
+	return value, nil
+}
+
+// indexOfPrefix finds where the prefix starts in the fields, comparing case-insensitively
+func indexOfPrefix(fields, prefix []string) int {
+	for i := 0; i+len(prefix) <= len(fields); i++ {
+		matched := true
+		for j, p := range prefix {
+			if !strings.EqualFold(fields[i+j], p) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return i
+		}
+	}
+	return -1
+}
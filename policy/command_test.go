@@ -0,0 +1,92 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestCommandValidate(t *testing.T) {
+	data := []struct {
+		name          string
+		command       Command
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "No Command", command: "", expectedIsNil: true, errMsg: "expected nil as there is no command"},
+		{name: "Literal Command", command: "show -help", expectedIsNil: true, errMsg: "expected nil as commands can be literals only"},
+		{name: "Typed Arguments", command: "@quetzal assign <user:user> <weight:int>", expectedIsNil: true, errMsg: "expected nil as the arguments have known types"},
+		{name: "Text Argument Last", command: "@quetzal note <text:text>", expectedIsNil: true, errMsg: "expected nil as text is the last argument"},
+		{name: "Text Argument Not Last", command: "@quetzal note <text:text> <user>", expectedIsNil: false, errMsg: "expected an error as text must be the last argument"},
+		{name: "Unknown Type", command: "@quetzal assign <user:person>", expectedIsNil: false, errMsg: "expected an error as person is not a type"},
+		{name: "Malformed Argument", command: "@quetzal assign <user", expectedIsNil: false, errMsg: "expected an error as the argument isn't closed"},
+		{name: "Unnamed Argument", command: "@quetzal assign <:int>", expectedIsNil: false, errMsg: "expected an error as the argument has no name"},
+		{name: "Starts With Argument", command: "<user> assign", expectedIsNil: false, errMsg: "expected an error as commands must start with a word"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := d.command.validate()
+			want := expectedIsNil(got)
+			if want != d.expectedIsNil {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestCommandInvokedIn(t *testing.T) {
+	command := Command("@quetzal label add <name>")
+	data := []struct {
+		name     string
+		body     string
+		expected bool
+	}{
+		{name: "Invoked", body: "@quetzal label add bug", expected: true},
+		{name: "Invoked on a later line", body: "Looks broken\n@Quetzal LABEL add bug", expected: true},
+		{name: "Invoked without arguments", body: "@quetzal label add", expected: true},
+		{name: "Not invoked", body: "@quetzal label remove bug", expected: false},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if got := command.invokedIn(d.body); got != d.expected {
+				t.Errorf("expected %t but got %t", d.expected, got)
+			}
+		})
+	}
+}
+
+func TestCommandArguments(t *testing.T) {
+	data := []struct {
+		name     string
+		command  Command
+		body     string
+		expected map[string]string
+		isErr    bool
+	}{
+		{name: "String argument", command: "@quetzal label add <name>", body: "@quetzal label add bug", expected: map[string]string{"name": "bug"}},
+		{name: "User argument strips @", command: "@quetzal assign <who:user>", body: "please @quetzal assign @jonny7", expected: map[string]string{"who": "jonny7"}},
+		{name: "Int argument", command: "@quetzal weight <weight:int>", body: "@quetzal weight 3", expected: map[string]string{"weight": "3"}},
+		{name: "Invalid int argument", command: "@quetzal weight <weight:int>", body: "@quetzal weight heavy", isErr: true},
+		{name: "Text argument", command: "@quetzal say <words:text>", body: "@quetzal say hello there", expected: map[string]string{"words": "hello there"}},
+		{name: "Missing argument", command: "@quetzal assign <who:user>", body: "@quetzal assign", isErr: true},
+		{name: "Too many arguments", command: "@quetzal assign <who:user>", body: "@quetzal assign bob alice", isErr: true},
+		{name: "Literal after argument", command: "@quetzal move <from> to <to>", body: "@quetzal move todo to doing", expected: map[string]string{"from": "todo", "to": "doing"}},
+		{name: "Wrong literal after argument", command: "@quetzal move <from> to <to>", body: "@quetzal move todo from doing", isErr: true},
+		{name: "Literal command ignores trailing words", command: "show -help", body: "show -help please", expected: map[string]string{}},
+		{name: "Second line parses", command: "@quetzal assign <who:user>", body: "@quetzal assign\n@quetzal assign bob", expected: map[string]string{"who": "bob"}},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got, err := d.command.arguments(d.body)
+			if (err != nil) != d.isErr {
+				t.Fatalf("expected error to be %t but got %v", d.isErr, err)
+			}
+			if len(got) != len(d.expected) {
+				t.Errorf("expected %v but got %v", d.expected, got)
+			}
+			for k, v := range d.expected {
+				if got[k] != v {
+					t.Errorf("expected argument %s to be %s but got %s", k, v, got[k])
+				}
+			}
+		})
+	}
+}
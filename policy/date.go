@@ -0,0 +1,117 @@
+package policy
+
+import (
+	"fmt"
+	"time"
+)
+
+// Date is possible condition that can be used to allow or
+// disallow the behaviour of the Bot see `config.yaml`
+type Date struct {
+	// Attribute can be `created_at` or `updated_at`
+	Attribute DateAttribute `yaml:"attribute"`
+	// Condition can be `older_than` or `newer_than`
+	Condition DateCondition `yaml:"condition"`
+	// IntervalType can be `days`, `weeks`, `months`, `years`
+	IntervalType DateIntervalType `yaml:"intervalType"`
+	// Interval is a numeric representation of the `IntervalType`
+	Interval int `yaml:"interval"`
+}
+
+// DateAttribute is the updated or created property
+type DateAttribute string
+
+const (
+	createdAt DateAttribute = "created_at"
+	updatedAt DateAttribute = "updated_at"
+)
+
+// DateCondition is the greater than or less than [date] filter
+type DateCondition string
+
+const (
+	olderThan DateCondition = "older_than"
+	newerThan DateCondition = "newer_than"
+)
+
+// DateIntervalType is the type of available interval
+type DateIntervalType string
+
+const (
+	days   DateIntervalType = "days"
+	weeks  DateIntervalType = "weeks"
+	months DateIntervalType = "months"
+	years  DateIntervalType = "years"
+)
+
+// timestampLayouts are the formats GitLab uses for timestamps in its webhooks
+var timestampLayouts = []string{time.RFC3339, "2006-01-02 15:04:05 MST", "2006-01-02 15:04:05 -0700"}
+
+// Clock tells the time that conditions are evaluated at, so tests can fix "now"
+type Clock func() time.Time
+
+// parseTimestamp parses a webhook timestamp, the bool is false when it's missing or in an unknown format
+func parseTimestamp(timestamp string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, timestamp); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// threshold is the point in time the Date's interval goes back to from now
+func (d *Date) threshold(now time.Time) time.Time {
+	switch d.IntervalType {
+	case weeks:
+		return now.AddDate(0, 0, -7*d.Interval)
+	case months:
+		return now.AddDate(0, -d.Interval, 0)
+	case years:
+		return now.AddDate(-d.Interval, 0, 0)
+	}
+	return now.AddDate(0, 0, -d.Interval)
+}
+
+// matches checks the adaptor's timestamp is on the right side of the threshold
+func (d *Date) matches(adaptor Timestamper, now time.Time) bool {
+	timestamp, ok := parseTimestamp(adaptor.timestamp(d.Attribute))
+	if !ok {
+		return false
+	}
+	if d.Condition == olderThan {
+		return timestamp.Before(d.threshold(now))
+	}
+	return timestamp.After(d.threshold(now))
+}
+
+// String describes the Date condition, such as `created_at older_than 10 days`
+func (d *Date) String() string {
+	return fmt.Sprintf("%s %s %d %s", d.Attribute, d.Condition, d.Interval, d.IntervalType)
+}
+
+// validate ensures each of the Date's properties has one of its available options
+func (d *Date) validate() error {
+	if d == nil {
+		return nil
+	}
+	switch d.Attribute {
+	case createdAt, updatedAt:
+	default:
+		return fmt.Errorf("date attribute allowed options are: `%s`, `%s`. But received: %s", createdAt, updatedAt, d.Attribute)
+	}
+	switch d.Condition {
+	case olderThan, newerThan:
+	default:
+		return fmt.Errorf("date condition allowed options are: `%s`, `%s`. But received: %s", olderThan, newerThan, d.Condition)
+	}
+	switch d.IntervalType {
+	case days, weeks, months, years:
+	default:
+		return fmt.Errorf("date intervalType allowed options are: `%s`, `%s`, `%s`, `%s`. But received: %s", days, weeks, months, years, d.IntervalType)
+	}
+	if d.Interval < 1 {
+		return fmt.Errorf("date interval must be at least 1 but received: %d", d.Interval)
+	}
+	return nil
+}
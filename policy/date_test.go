@@ -0,0 +1,146 @@
+package policy
+
+import (
+	"github.com/xanzy/go-gitlab"
+	"gopkg.in/yaml.v3"
+	"testing"
+	"time"
+)
+
+var fixedNow = time.Date(2021, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+func fixedClock() time.Time {
+	return fixedNow
+}
+
+func TestDateValidate(t *testing.T) {
+	data := []struct {
+		name          string
+		date          *Date
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "No Date Listed", date: nil, expectedIsNil: true, errMsg: "expected nil as no date in policy is valid"},
+		{name: "Valid Date", date: &Date{Attribute: createdAt, Condition: olderThan, IntervalType: days, Interval: 10}, expectedIsNil: true, errMsg: "expected nil for a valid date"},
+		{name: "Invalid Attribute", date: &Date{Attribute: "merged_at", Condition: olderThan, IntervalType: days, Interval: 10}, expectedIsNil: false, errMsg: "expected an error as merged_at is not an attribute"},
+		{name: "Invalid Condition", date: &Date{Attribute: updatedAt, Condition: "before", IntervalType: days, Interval: 10}, expectedIsNil: false, errMsg: "expected an error as before is not a condition"},
+		{name: "Invalid IntervalType", date: &Date{Attribute: updatedAt, Condition: newerThan, IntervalType: "hours", Interval: 10}, expectedIsNil: false, errMsg: "expected an error as hours is not an interval type"},
+		{name: "Interval Below One", date: &Date{Attribute: updatedAt, Condition: newerThan, IntervalType: weeks}, expectedIsNil: false, errMsg: "expected an error as the interval is 0"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := d.date.validate()
+			want := expectedIsNil(got)
+			if want != d.expectedIsNil {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestDateThreshold(t *testing.T) {
+	data := []struct {
+		name     string
+		date     Date
+		expected time.Time
+	}{
+		{name: "Days", date: Date{IntervalType: days, Interval: 10}, expected: time.Date(2021, time.June, 5, 12, 0, 0, 0, time.UTC)},
+		{name: "Weeks", date: Date{IntervalType: weeks, Interval: 2}, expected: time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "Months", date: Date{IntervalType: months, Interval: 3}, expected: time.Date(2021, time.March, 15, 12, 0, 0, 0, time.UTC)},
+		{name: "Years", date: Date{IntervalType: years, Interval: 1}, expected: time.Date(2020, time.June, 15, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if got := d.date.threshold(fixedNow); !got.Equal(d.expected) {
+				t.Errorf("expected threshold %v, but got %v", d.expected, got)
+			}
+		})
+	}
+}
+
+func TestDateMatches(t *testing.T) {
+	adaptor := MergeEventAdaptor{}
+	// GitLab sends both of these formats depending on the version and hook
+	adaptor.ObjectAttributes.CreatedAt = "2021-05-01 09:30:00 UTC"
+	adaptor.ObjectAttributes.UpdatedAt = "2021-06-14T09:30:00Z"
+
+	data := []struct {
+		name     string
+		date     Date
+		adaptor  Timestamper
+		expected bool
+	}{
+		{name: "Created older than 10 days", date: Date{Attribute: createdAt, Condition: olderThan, IntervalType: days, Interval: 10}, adaptor: adaptor, expected: true},
+		{name: "Created newer than 10 days", date: Date{Attribute: createdAt, Condition: newerThan, IntervalType: days, Interval: 10}, adaptor: adaptor, expected: false},
+		{name: "Updated newer than 1 week", date: Date{Attribute: updatedAt, Condition: newerThan, IntervalType: weeks, Interval: 1}, adaptor: adaptor, expected: true},
+		{name: "Updated older than 1 week", date: Date{Attribute: updatedAt, Condition: olderThan, IntervalType: weeks, Interval: 1}, adaptor: adaptor, expected: false},
+		{name: "Missing timestamp", date: Date{Attribute: createdAt, Condition: olderThan, IntervalType: days, Interval: 1}, adaptor: MergeEventAdaptor{}, expected: false},
+		{name: "Issue comment uses the issue", date: Date{Attribute: createdAt, Condition: olderThan, IntervalType: months, Interval: 1}, adaptor: NoteEventAdaptor{CreatedAt: "2021-01-01 00:00:00 +0000"}, expected: true},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if got := d.date.matches(d.adaptor, fixedNow); got != d.expected {
+				t.Errorf("expected %s to be %t", d.date.String(), d.expected)
+			}
+		})
+	}
+}
+
+func TestDateUnmarshal(t *testing.T) {
+	body := []byte(`policies:
+  - name: stale
+    resource: Merge Request Hook
+    conditions:
+      date:
+        attribute: updated_at
+        condition: older_than
+        intervalType: weeks
+        interval: 2
+`)
+	var policies Policies
+	if err := yaml.Unmarshal(body, &policies); err != nil {
+		t.Fatalf("policies could not be unmarshalled: %v", err)
+	}
+	got := policies.Policies[0].Conditions.Date
+	expected := Date{Attribute: updatedAt, Condition: olderThan, IntervalType: weeks, Interval: 2}
+	if got == nil || *got != expected {
+		t.Errorf("expected date %+v, but got %+v", expected, got)
+	}
+	if errs := ValidateYAML(body); len(errs) != 0 {
+		t.Errorf("expected the date condition to be valid, but got %v", errs)
+	}
+}
+
+func TestFilterEventUsesClock(t *testing.T) {
+	event := &gitlab.MergeEvent{}
+	event.ObjectAttributes.UpdatedAt = "2021-06-01 12:00:00 UTC"
+	w := Webhook{EventType: gitlab.EventTypeMergeRequest, Event: event}
+	pol := Policy{
+		Name:       "stale",
+		Resource:   Resource{gitlab.EventTypeMergeRequest},
+		Conditions: Condition{Date: &Date{Attribute: updatedAt, Condition: olderThan, IntervalType: weeks, Interval: 1}},
+	}
+
+	data := []struct {
+		name     string
+		clock    Clock
+		expected bool
+	}{
+		{name: "Older than a week by the clock", clock: fixedClock, expected: true},
+		{name: "Not yet a week old", clock: func() time.Time { return fixedNow.AddDate(0, 0, -10) }, expected: false},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			in := make(chan Policy)
+			go func() {
+				in <- pol
+				close(in)
+			}()
+			for result := range w.FilterEvent(in, nil, Options{Clock: d.clock}) {
+				if result.Matched != d.expected {
+					t.Errorf("expected matched to be %t, but got %t: %+v", d.expected, result.Matched, result.Trace)
+				}
+			}
+		})
+	}
+}
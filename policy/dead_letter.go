@@ -0,0 +1,120 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"time"
+)
+
+// DeadLetter is an update to GitLab that still failed after being retried.
+// It keeps the webhook it was made for, so it can be replayed later
+type DeadLetter struct {
+	ID string `json:"id"`
+	// Policy is the name of the Policy that made the update
+	Policy    string           `json:"policy"`
+	EventType gitlab.EventType `json:"eventType"`
+	// Event is the webhook's event encoded as json
+	Event    json.RawMessage `json:"event"`
+	Action   Action          `json:"action"`
+	Update   updateKind      `json:"update"`
+	Endpoint string          `json:"endpoint"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	FailedAt time.Time       `json:"failedAt"`
+}
+
+// DeadLetterStore keeps DeadLetters until they are replayed or discarded
+type DeadLetterStore interface {
+	// Put saves the DeadLetter, assigning it an ID if it doesn't have one
+	Put(letter DeadLetter) (DeadLetter, error)
+	Get(id string) (DeadLetter, error)
+	List() ([]DeadLetter, error)
+	Delete(id string) error
+}
+
+// deadLetters stores the updates from the results that used up their Retry. Updates that failed with an
+// error that can't be retried, such as a 404, or that had no Retry, would only fail the same way on replay
+func (w *Webhook) deadLetters(pol Policy, results []GitLabUpdateResult, store DeadLetterStore) error {
+	if store == nil {
+		return nil
+	}
+	var event json.RawMessage
+	for _, result := range results {
+		if result.Error == "" || result.DryRun || result.Action.Retry == nil || !result.exhausted {
+			continue
+		}
+		if event == nil {
+			encoded, err := json.Marshal(w.Event)
+			if err != nil {
+				return err
+			}
+			event = encoded
+		}
+		letter := DeadLetter{
+			Policy:    pol.Name,
+			EventType: w.EventType,
+			Event:     event,
+			Action:    result.Action,
+			Update:    result.Update,
+			Endpoint:  result.Endpoint,
+			Error:     result.Error,
+			Attempts:  result.Attempts,
+			FailedAt:  time.Now().UTC(),
+		}
+		if _, err := store.Put(letter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckReplay reports why the DeadLetter can't be replayed, such as its event no longer decoding,
+// so it can be refused before the replay is left to run in the background
+func CheckReplay(letter DeadLetter, opts Options) error {
+	_, err := letter.updates(opts)
+	return err
+}
+
+// updates prepares the failed update of the DeadLetter from its webhook
+func (letter DeadLetter) updates(opts Options) ([]update, error) {
+	event, err := ParseWebhook(letter.EventType, letter.Event)
+	if err != nil {
+		return nil, fmt.Errorf("dead letter event could not be decoded: %v", err)
+	}
+	adaptor, ok := newAdaptor(event)
+	if !ok {
+		return nil, fmt.Errorf("dead letter event type %s is not supported", letter.EventType)
+	}
+	var updates []update
+	for _, u := range adaptor.prepareUpdates(letter.Action, opts) {
+		if u.kind == letter.Update {
+			updates = append(updates, u)
+		}
+	}
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("dead letter action has no %s update to replay", letter.Update)
+	}
+	return updates, nil
+}
+
+// Replay runs the failed update of the DeadLetter again, following the Action's Retry.
+// The returned DeadLetter is updated with the outcome, and the bool reports whether the replay succeeded
+func Replay(letter DeadLetter, client *gitlab.Client, opts Options) (DeadLetter, bool, error) {
+	opts.DryRun = false
+	updates, err := letter.updates(opts)
+	if err != nil {
+		return letter, false, err
+	}
+	for _, result := range executeUpdates(updates, letter.Action, client, opts) {
+		letter.Attempts += result.Attempts
+		letter.Endpoint = result.Endpoint
+		if result.Error != "" {
+			letter.Error = result.Error
+			letter.FailedAt = time.Now().UTC()
+			return letter, false, nil
+		}
+	}
+	letter.Error = ""
+	return letter, true, nil
+}
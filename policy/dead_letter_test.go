@@ -0,0 +1,141 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// memoryDeadLetters is a DeadLetterStore for tests
+type memoryDeadLetters struct {
+	letters []DeadLetter
+}
+
+func (m *memoryDeadLetters) Put(letter DeadLetter) (DeadLetter, error) {
+	if letter.ID == "" {
+		letter.ID = fmt.Sprintf("%d", len(m.letters)+1)
+	}
+	m.letters = append(m.letters, letter)
+	return letter, nil
+}
+
+func (m *memoryDeadLetters) Get(id string) (DeadLetter, error) {
+	for _, letter := range m.letters {
+		if letter.ID == id {
+			return letter, nil
+		}
+	}
+	return DeadLetter{}, fmt.Errorf("not found")
+}
+
+func (m *memoryDeadLetters) List() ([]DeadLetter, error) {
+	return m.letters, nil
+}
+
+func (m *memoryDeadLetters) Delete(id string) error {
+	return nil
+}
+
+func TestDeadLetters(t *testing.T) {
+	mux, server, client := setupWithoutRetries(t)
+	defer teardown(server)
+
+	me := stubMergeEventAdaptor()
+	failing := true
+	mux.HandleFunc(stubUpdatedMergeEventEndPoint(me)+"/notes", func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 1}`))
+	})
+
+	w := Webhook{EventType: gitlab.EventTypeMergeRequest, Event: &me.MergeEvent}
+	pol := Policy{Name: "comment", Resource: Resource{gitlab.EventTypeMergeRequest}, Actions: Action{Comment: "hello", Retry: &Retry{MaxAttempts: 2, Backoff: time.Millisecond}}}
+	store := &memoryDeadLetters{}
+	opts := Options{DeadLetters: store, sleep: func(time.Duration) {}}
+
+	ch := make(chan Policy)
+	go func() {
+		defer close(ch)
+		ch <- pol
+	}()
+	var results []WebhookResult
+	for result := range w.FilterEvent(ch, client, opts) {
+		results = append(results, result)
+	}
+
+	if len(results) != 1 || len(results[0].Actions) != 1 || results[0].Actions[0].Error == "" {
+		t.Fatalf("expected a single failed action but got %+v", results)
+	}
+	if len(store.letters) != 1 {
+		t.Fatalf("expected 1 dead letter but got %d", len(store.letters))
+	}
+	letter := store.letters[0]
+	if letter.Policy != "comment" || letter.Update != updateKindNote || letter.Attempts != 2 {
+		t.Errorf("expected the dead letter to record the policy, update and attempts but got %+v", letter)
+	}
+
+	t.Run("Replay fails again", func(t *testing.T) {
+		replayed, ok, err := Replay(letter, client, opts)
+		if err != nil || ok {
+			t.Fatalf("expected replay to fail without an error, got ok %v and error %v", ok, err)
+		}
+		if replayed.Attempts != 4 {
+			t.Errorf("expected replay attempts to be added to the dead letter, got %d", replayed.Attempts)
+		}
+	})
+
+	t.Run("Replay succeeds", func(t *testing.T) {
+		failing = false
+		replayed, ok, err := Replay(letter, client, opts)
+		if err != nil || !ok {
+			t.Fatalf("expected replay to succeed, got ok %v and error %v", ok, err)
+		}
+		if replayed.Error != "" {
+			t.Errorf("expected the error to be cleared but got %s", replayed.Error)
+		}
+	})
+}
+
+func TestDeadLettersOnlyExhaustedRetries(t *testing.T) {
+	mux, server, client := setupWithoutRetries(t)
+	defer teardown(server)
+
+	me := stubMergeEventAdaptor()
+	status := http.StatusNotFound
+	mux.HandleFunc(stubUpdatedMergeEventEndPoint(me)+"/notes", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+	w := Webhook{EventType: gitlab.EventTypeMergeRequest, Event: &me.MergeEvent}
+
+	data := []struct {
+		name   string
+		status int
+		retry  *Retry
+	}{
+		{name: "Not found isn't retried", status: http.StatusNotFound, retry: &Retry{MaxAttempts: 3, Backoff: time.Millisecond}},
+		{name: "Without a retry", status: http.StatusBadGateway, retry: nil},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			status = d.status
+			store := &memoryDeadLetters{}
+			opts := Options{DeadLetters: store, sleep: func(time.Duration) {}}
+			ch := make(chan Policy, 1)
+			ch <- Policy{Name: "comment", Resource: Resource{gitlab.EventTypeMergeRequest}, Actions: Action{Comment: "hello", Retry: d.retry}}
+			close(ch)
+			for result := range w.FilterEvent(ch, client, opts) {
+				if len(result.Actions) != 1 || result.Actions[0].Error == "" {
+					t.Fatalf("expected a single failed action but got %+v", result)
+				}
+			}
+			if len(store.letters) != 0 {
+				t.Errorf("expected the failure not to be dead lettered, got %+v", store.letters)
+			}
+		})
+	}
+}
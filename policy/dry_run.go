@@ -0,0 +1,40 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// errDryRun stops a request from being sent to GitLab once it has been recorded
+var errDryRun = errors.New("dry run: request was not sent")
+
+// Request is a request the bot would have sent to GitLab
+type Request struct {
+	Method   string          `json:"method"`
+	Endpoint string          `json:"endpoint"`
+	Body     json.RawMessage `json:"body,omitempty"`
+}
+
+// dryRunRecorder captures the request built by the gitlab.Client
+type dryRunRecorder struct {
+	request *Request
+}
+
+// record is a gitlab.RequestOptionFunc, it is run once the request has been built
+// and returns errDryRun so the gitlab.Client never sends it
+func (d *dryRunRecorder) record(req *retryablehttp.Request) error {
+	body, err := req.BodyBytes()
+	if err != nil {
+		return err
+	}
+	endpoint := req.URL.Path
+	if req.URL.RawQuery != "" {
+		endpoint += "?" + req.URL.RawQuery
+	}
+	d.request = &Request{Method: req.Method, Endpoint: endpoint}
+	if len(body) > 0 {
+		d.request.Body = body
+	}
+	return errDryRun
+}
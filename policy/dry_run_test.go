@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"testing"
+)
+
+func TestDryRunExecute(t *testing.T) {
+	mux, server, client := setup(t)
+	defer teardown(server)
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected no request to reach GitLab during a dry run, got %s %s", r.Method, r.URL.Path)
+	})
+
+	me := stubMergeEventAdaptor()
+	action := Action{Labels: Labels{[]string{"approved"}}, Status: ActionStatus(mergeRequestStateApproved), Comment: "dry run"}
+
+	got := me.execute(action, client, Options{DryRun: true})
+	if len(got) != 3 {
+		t.Fatalf("expected %d results but got %d", 3, len(got))
+	}
+
+	data := []struct {
+		name     string
+		result   GitLabUpdateResult
+		method   string
+		endpoint string
+		body     string
+	}{
+		{name: "Labels", result: got[0], method: http.MethodPut, endpoint: stubUpdatedMergeEventEndPoint(me), body: `{"add_labels":"approved"}`},
+		{name: "Approval", result: got[1], method: http.MethodPost, endpoint: fmt.Sprintf("%s/approve", stubUpdatedMergeEventEndPoint(me)), body: `{"sha":""}`},
+		{name: "Note", result: got[2], method: http.MethodPost, endpoint: fmt.Sprintf("%s/notes", stubUpdatedMergeEventEndPoint(me)), body: `{"body":"dry run"}`},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if !d.result.DryRun || d.result.Request == nil {
+				t.Fatalf("expected the result to be a dry run with a request")
+			}
+			if d.result.Error != "" {
+				t.Errorf("expected no error but got %s", d.result.Error)
+			}
+			if d.result.Request.Method != d.method {
+				t.Errorf("expected method %s but got %s", d.method, d.result.Request.Method)
+			}
+			if d.result.Endpoint != d.endpoint || d.result.Request.Endpoint != d.endpoint {
+				t.Errorf("expected endpoint %s but got %s", d.endpoint, d.result.Endpoint)
+			}
+			if string(d.result.Request.Body) != d.body {
+				t.Errorf("expected body %s but got %s", d.body, d.result.Request.Body)
+			}
+		})
+	}
+
+	t.Run("Results encode the request", func(t *testing.T) {
+		encoded, err := json.Marshal(got[2])
+		if err != nil {
+			t.Fatalf("expected result to encode: %v", err)
+		}
+		var decoded struct {
+			Request struct {
+				Body struct {
+					Body string `json:"body"`
+				} `json:"body"`
+			} `json:"request"`
+		}
+		if err = json.Unmarshal(encoded, &decoded); err != nil || decoded.Request.Body.Body != "dry run" {
+			t.Errorf("expected the request body to be encoded as json, got %s", encoded)
+		}
+	})
+}
+
+func TestExecuteWithoutResponse(t *testing.T) {
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL("http://127.0.0.1:0"), gitlab.WithoutRetries())
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	got := stubMergeEventAdaptor().execute(Action{Comment: "unreachable"}, client, Options{})
+	if len(got) != 1 || got[0].Error == "" {
+		t.Errorf("expected an error to be reported rather than a panic, got %v", got)
+	}
+}
@@ -0,0 +1,613 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Expression is an `expr` condition, a small expression evaluated against the webhook's payload such as
+// `object_attributes.target_branch == "main" && user.username != "renovate"`. Fields are the json keys of
+// the payload, a field of a list gives the list of that field, so `"bug" in labels.name` checks a label.
+// It's sandboxed, it can only read the payload and call the functions in exprFunctions
+type Expression struct {
+	Source string
+	root   exprNode
+	// err is the syntax error of the Source, it's reported by validate so every error is found at once
+	err error
+}
+
+// newExpression parses the source into an Expression
+func newExpression(source string) *Expression {
+	e := &Expression{Source: source}
+	e.root, e.err = parseExpr(source)
+	return e
+}
+
+// UnmarshalYAML parses the expression, a syntax error is kept until the Expression is validated
+func (e *Expression) UnmarshalYAML(value *yaml.Node) error {
+	var source string
+	if err := value.Decode(&source); err != nil {
+		return err
+	}
+	*e = *newExpression(source)
+	return nil
+}
+
+// MarshalYAML writes the Expression as its source
+func (e Expression) MarshalYAML() (interface{}, error) {
+	return e.Source, nil
+}
+
+// MarshalJSON writes the Expression as its source
+func (e Expression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.Source)
+}
+
+// String is the source of the Expression
+func (e *Expression) String() string {
+	return e.Source
+}
+
+// validate checks the Expression's syntax, then type checks it against the payload of the event type.
+// Every field must exist in the payload, and the whole expression must be a bool
+func (e *Expression) validate(eventType gitlab.EventType) error {
+	if e == nil {
+		return nil
+	}
+	if e.err != nil {
+		return fmt.Errorf("expr %q is invalid: %v", e.Source, e.err)
+	}
+	kind, err := e.root.check(exprPayloadTypes[eventType])
+	if err != nil {
+		return fmt.Errorf("expr %q is invalid for %s: %v", e.Source, eventType, err)
+	}
+	if !kindAccepts(kindBool, kind) {
+		return fmt.Errorf("expr %q must be a bool, but is a %s", e.Source, kind)
+	}
+	return nil
+}
+
+// evaluate runs the Expression against the payload, decoded as json so fields are its json keys
+func (e *Expression) evaluate(payload interface{}) (interface{}, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("payload could not be encoded: %v", err)
+	}
+	var decoded interface{}
+	if err = json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, fmt.Errorf("payload could not be decoded: %v", err)
+	}
+	return e.root.eval(decoded)
+}
+
+// exprPayloadTypes are the payloads an Expression is type checked against for each resource. Comments
+// can be any of four payloads, so their fields need only be in one of them. Expressions for resources
+// without a payload type aren't type checked
+var exprPayloadTypes = map[gitlab.EventType][]reflect.Type{
+	gitlab.EventTypeBuild:         {reflect.TypeOf(gitlab.BuildEvent{})},
+	gitlab.EventTypeDeployment:    {reflect.TypeOf(gitlab.DeploymentEvent{})},
+	gitlab.EventTypeIssue:         {reflect.TypeOf(gitlab.IssueEvent{})},
+	gitlab.EventConfidentialIssue: {reflect.TypeOf(gitlab.IssueEvent{})},
+	gitlab.EventTypeJob:           {reflect.TypeOf(gitlab.JobEvent{})},
+	gitlab.EventTypeMergeRequest:  {reflect.TypeOf(gitlab.MergeEvent{})},
+	gitlab.EventTypeNote:          noteEventTypes,
+	gitlab.EventConfidentialNote:  noteEventTypes,
+	gitlab.EventTypePipeline:      {reflect.TypeOf(gitlab.PipelineEvent{})},
+	gitlab.EventTypePush:          {reflect.TypeOf(gitlab.PushEvent{})},
+	gitlab.EventTypeRelease:       {reflect.TypeOf(gitlab.ReleaseEvent{})},
+	gitlab.EventTypeTagPush:       {reflect.TypeOf(gitlab.TagEvent{})},
+	gitlab.EventTypeWikiPage:      {reflect.TypeOf(gitlab.WikiPageEvent{})},
+}
+
+var noteEventTypes = []reflect.Type{
+	reflect.TypeOf(gitlab.IssueCommentEvent{}),
+	reflect.TypeOf(gitlab.MergeCommentEvent{}),
+	reflect.TypeOf(gitlab.CommitCommentEvent{}),
+	reflect.TypeOf(gitlab.SnippetCommentEvent{}),
+}
+
+// exprKind is the type of a value in an Expression
+type exprKind string
+
+const (
+	// kindAny is a value whose type isn't known until it's evaluated
+	kindAny    exprKind = "any"
+	kindNull   exprKind = "null"
+	kindBool   exprKind = "bool"
+	kindNumber exprKind = "number"
+	kindString exprKind = "string"
+	kindList   exprKind = "list"
+	kindObject exprKind = "object"
+)
+
+// kindAccepts reports whether a value of the actual kind can be used where the expected kind is.
+// Values that aren't known until evaluation, and missing values, are accepted anywhere
+func kindAccepts(expected, actual exprKind) bool {
+	return expected == kindAny || actual == expected || actual == kindAny || actual == kindNull
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// kindOf is the kind of the json a Go type is encoded as
+func kindOf(t reflect.Type) exprKind {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return kindString
+	}
+	if t.Kind() == reflect.Struct && (t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType)) {
+		return kindAny
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return kindBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
+		reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return kindNumber
+	case reflect.String:
+		return kindString
+	case reflect.Slice, reflect.Array:
+		return kindList
+	case reflect.Struct, reflect.Map:
+		return kindObject
+	}
+	return kindAny
+}
+
+// resolveField finds the type of the field path in the Go type, following json keys.
+// A field of a list is resolved on its items, giving a list of that field
+func resolveField(t reflect.Type, segments []string) (reflect.Type, bool) {
+	if len(segments) == 0 {
+		return t, true
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		field, ok := jsonField(t, segments[0])
+		if !ok {
+			return nil, false
+		}
+		return resolveField(field, segments[1:])
+	case reflect.Slice, reflect.Array:
+		item, ok := resolveField(t.Elem(), segments)
+		if !ok {
+			return nil, false
+		}
+		return reflect.SliceOf(item), true
+	case reflect.Map:
+		return resolveField(t.Elem(), segments[1:])
+	case reflect.Interface:
+		return t, true
+	}
+	return nil, false
+}
+
+// jsonField finds the type of the struct's field with the json key, including those of embedded structs
+func jsonField(t reflect.Type, key string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if found, ok := jsonField(embedded, key); ok {
+					return found, true
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = field.Name
+		}
+		if name == key {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
+
+// exprNode is a node of a parsed Expression
+type exprNode interface {
+	// check type checks the node against the payload types, it returns the kind of value the node evaluates to
+	check(payloads []reflect.Type) (exprKind, error)
+	eval(payload interface{}) (interface{}, error)
+}
+
+// literalNode is a string, number, bool or null
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) check([]reflect.Type) (exprKind, error) {
+	return kindOfValue(n.value), nil
+}
+
+func (n *literalNode) eval(interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+// kindOfValue is the kind of an evaluated value
+func kindOfValue(value interface{}) exprKind {
+	switch value.(type) {
+	case nil:
+		return kindNull
+	case bool:
+		return kindBool
+	case float64:
+		return kindNumber
+	case string:
+		return kindString
+	case []interface{}:
+		return kindList
+	case map[string]interface{}:
+		return kindObject
+	}
+	return kindAny
+}
+
+// pathNode is a field of the payload, such as `object_attributes.target_branch`
+type pathNode struct {
+	segments []string
+}
+
+func (n *pathNode) check(payloads []reflect.Type) (exprKind, error) {
+	if len(payloads) == 0 {
+		return kindAny, nil
+	}
+	var kinds []exprKind
+	for _, payload := range payloads {
+		if field, ok := resolveField(payload, n.segments); ok {
+			kinds = append(kinds, kindOf(field))
+		}
+	}
+	if len(kinds) == 0 {
+		return "", fmt.Errorf("unknown field %s", strings.Join(n.segments, "."))
+	}
+	for _, kind := range kinds[1:] {
+		if kind != kinds[0] {
+			return kindAny, nil
+		}
+	}
+	return kinds[0], nil
+}
+
+func (n *pathNode) eval(payload interface{}) (interface{}, error) {
+	return lookup(payload, n.segments), nil
+}
+
+// lookup finds the field path in the decoded payload, a missing field is null
+func lookup(value interface{}, segments []string) interface{} {
+	if len(segments) == 0 {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return lookup(v[segments[0]], segments[1:])
+	case []interface{}:
+		items := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			items = append(items, lookup(item, segments))
+		}
+		return items
+	}
+	return nil
+}
+
+// listNode is a list literal, such as `["main", "master"]`
+type listNode struct {
+	items []exprNode
+}
+
+func (n *listNode) check(payloads []reflect.Type) (exprKind, error) {
+	for _, item := range n.items {
+		if _, err := item.check(payloads); err != nil {
+			return "", err
+		}
+	}
+	return kindList, nil
+}
+
+func (n *listNode) eval(payload interface{}) (interface{}, error) {
+	items := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(payload)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+	}
+	return items, nil
+}
+
+// notNode negates a bool
+type notNode struct {
+	operand exprNode
+}
+
+func (n *notNode) check(payloads []reflect.Type) (exprKind, error) {
+	kind, err := n.operand.check(payloads)
+	if err != nil {
+		return "", err
+	}
+	if !kindAccepts(kindBool, kind) {
+		return "", fmt.Errorf("! needs a bool, but was given a %s", kind)
+	}
+	return kindBool, nil
+}
+
+func (n *notNode) eval(payload interface{}) (interface{}, error) {
+	value, err := n.operand.eval(payload)
+	if err != nil {
+		return nil, err
+	}
+	b, err := truthy("!", value)
+	return !b, err
+}
+
+// truthy converts a value to a bool for the operator, a missing value is false
+func truthy(op string, value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	}
+	return false, fmt.Errorf("%s needs a bool, but was given a %s", op, kindOfValue(value))
+}
+
+// binaryNode is a logical operator, a comparison or `in`
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) check(payloads []reflect.Type) (exprKind, error) {
+	left, err := n.left.check(payloads)
+	if err != nil {
+		return "", err
+	}
+	right, err := n.right.check(payloads)
+	if err != nil {
+		return "", err
+	}
+	switch n.op {
+	case "&&", "||":
+		if !kindAccepts(kindBool, left) || !kindAccepts(kindBool, right) {
+			return "", fmt.Errorf("%s needs bools, but was given a %s and a %s", n.op, left, right)
+		}
+	case "==", "!=":
+		if !kindAccepts(left, right) && !kindAccepts(right, left) {
+			return "", fmt.Errorf("a %s can't be compared with a %s", left, right)
+		}
+	case "<", "<=", ">", ">=":
+		if !(kindAccepts(kindNumber, left) && kindAccepts(kindNumber, right)) && !(kindAccepts(kindString, left) && kindAccepts(kindString, right)) {
+			return "", fmt.Errorf("%s needs two numbers or two strings, but was given a %s and a %s", n.op, left, right)
+		}
+	case "in":
+		if !kindAccepts(kindList, right) && !kindAccepts(kindString, right) {
+			return "", fmt.Errorf("in needs a list or a string, but was given a %s", right)
+		}
+		if right == kindString && !kindAccepts(kindString, left) {
+			return "", fmt.Errorf("only a string can be in a string, but was given a %s", left)
+		}
+	}
+	return kindBool, nil
+}
+
+func (n *binaryNode) eval(payload interface{}) (interface{}, error) {
+	left, err := n.left.eval(payload)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" || n.op == "||" {
+		b, truthyErr := truthy(n.op, left)
+		if truthyErr != nil {
+			return nil, truthyErr
+		}
+		// the right side isn't evaluated when the left decides the outcome
+		if (n.op == "&&" && !b) || (n.op == "||" && b) {
+			return b, nil
+		}
+		right, rightErr := n.right.eval(payload)
+		if rightErr != nil {
+			return nil, rightErr
+		}
+		return truthy(n.op, right)
+	}
+	right, err := n.right.eval(payload)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	case "in":
+		return contains(right, left)
+	}
+	return compare(n.op, left, right)
+}
+
+// compare orders two numbers or two strings, a missing value isn't ordered with anything
+func compare(op string, left, right interface{}) (bool, error) {
+	if left == nil || right == nil {
+		return false, nil
+	}
+	var order int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false, fmt.Errorf("%s needs two numbers or two strings, but was given a number and a %s", op, kindOfValue(right))
+		}
+		if l < r {
+			order = -1
+		} else if l > r {
+			order = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false, fmt.Errorf("%s needs two numbers or two strings, but was given a string and a %s", op, kindOfValue(right))
+		}
+		order = strings.Compare(l, r)
+	default:
+		return false, fmt.Errorf("%s needs two numbers or two strings, but was given a %s", op, kindOfValue(left))
+	}
+	switch op {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	}
+	return order >= 0, nil
+}
+
+// contains reports whether the value is an item of the list, or a substring of the string
+func contains(container, value interface{}) (bool, error) {
+	switch c := container.(type) {
+	case nil:
+		return false, nil
+	case []interface{}:
+		for _, item := range c {
+			if reflect.DeepEqual(item, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case string:
+		s, ok := value.(string)
+		if !ok {
+			return false, fmt.Errorf("only a string can be in a string, but was given a %s", kindOfValue(value))
+		}
+		return strings.Contains(c, s), nil
+	}
+	return false, fmt.Errorf("in needs a list or a string, but was given a %s", kindOfValue(container))
+}
+
+// exprFunction is a function that can be called in an Expression
+type exprFunction struct {
+	// args are the kinds each argument accepts
+	args   [][]exprKind
+	result exprKind
+	fn     func(args []interface{}) (interface{}, error)
+}
+
+// exprFunctions are the functions available to an Expression. A missing string is treated as empty
+var exprFunctions = map[string]exprFunction{
+	"contains": {args: [][]exprKind{{kindList, kindString}, {kindAny}}, result: kindBool, fn: func(args []interface{}) (interface{}, error) {
+		return contains(args[0], args[1])
+	}},
+	"startsWith": {args: [][]exprKind{{kindString}, {kindString}}, result: kindBool, fn: func(args []interface{}) (interface{}, error) {
+		return strings.HasPrefix(asString(args[0]), asString(args[1])), nil
+	}},
+	"endsWith": {args: [][]exprKind{{kindString}, {kindString}}, result: kindBool, fn: func(args []interface{}) (interface{}, error) {
+		return strings.HasSuffix(asString(args[0]), asString(args[1])), nil
+	}},
+	"matches": {args: [][]exprKind{{kindString}, {kindString}}, result: kindBool, fn: func(args []interface{}) (interface{}, error) {
+		pattern, err := regexp.Compile(asString(args[1]))
+		if err != nil {
+			return nil, fmt.Errorf("matches was given an invalid pattern: %v", err)
+		}
+		return pattern.MatchString(asString(args[0])), nil
+	}},
+	"lower": {args: [][]exprKind{{kindString}}, result: kindString, fn: func(args []interface{}) (interface{}, error) {
+		return strings.ToLower(asString(args[0])), nil
+	}},
+	"len": {args: [][]exprKind{{kindList, kindString}}, result: kindNumber, fn: func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case []interface{}:
+			return float64(len(v)), nil
+		case string:
+			return float64(len(v)), nil
+		case nil:
+			return float64(0), nil
+		}
+		return nil, fmt.Errorf("len needs a list or a string, but was given a %s", kindOfValue(args[0]))
+	}},
+}
+
+// asString is the string value, or empty if the value isn't a string
+func asString(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+// callNode calls one of the exprFunctions
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+func (n *callNode) check(payloads []reflect.Type) (exprKind, error) {
+	function := exprFunctions[n.name]
+	if len(n.args) != len(function.args) {
+		return "", fmt.Errorf("%s needs %d arguments, but was given %d", n.name, len(function.args), len(n.args))
+	}
+	for i, arg := range n.args {
+		kind, err := arg.check(payloads)
+		if err != nil {
+			return "", err
+		}
+		accepted := false
+		for _, expected := range function.args[i] {
+			accepted = accepted || kindAccepts(expected, kind)
+		}
+		if !accepted {
+			return "", fmt.Errorf("argument %d of %s can't be a %s", i+1, n.name, kind)
+		}
+	}
+	if n.name == "matches" {
+		if pattern, ok := n.args[1].(*literalNode); ok {
+			if _, err := regexp.Compile(asString(pattern.value)); err != nil {
+				return "", fmt.Errorf("matches was given an invalid pattern: %v", err)
+			}
+		}
+	}
+	return function.result, nil
+}
+
+func (n *callNode) eval(payload interface{}) (interface{}, error) {
+	// an Expression that hasn't been checked could call a function with the wrong number of arguments
+	function := exprFunctions[n.name]
+	if len(n.args) != len(function.args) {
+		return nil, fmt.Errorf("%s needs %d arguments, but was given %d", n.name, len(function.args), len(n.args))
+	}
+	args := make([]interface{}, 0, len(n.args))
+	for _, arg := range n.args {
+		value, err := arg.eval(payload)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	return function.fn(args)
+}
@@ -0,0 +1,294 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// exprTokenKind is the kind of a lexed token of an expression
+type exprTokenKind int
+
+const (
+	tokenEOF exprTokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+// exprToken is a lexed token, pos is its offset in the expression
+type exprToken struct {
+	kind  exprTokenKind
+	value string
+	pos   int
+}
+
+// exprOperators are the operators and punctuation of the language, longest first so `==` isn't lexed as `=`
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ","}
+
+// lexExpr splits the expression into its tokens
+func lexExpr(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(src) && src[end] != src[i] {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			quoted := src[i : end+1]
+			if c == '\'' {
+				quoted = strconv.Quote(strings.ReplaceAll(src[i+1:end], `\'`, `'`))
+			}
+			value, err := strconv.Unquote(quoted)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d: %v", i, err)
+			}
+			tokens = append(tokens, exprToken{kind: tokenString, value: value, pos: i})
+			i = end + 1
+		case unicode.IsDigit(c):
+			end := i
+			for end < len(src) && (unicode.IsDigit(rune(src[end])) || src[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, exprToken{kind: tokenNumber, value: src[i:end], pos: i})
+			i = end
+		case unicode.IsLetter(c) || c == '_':
+			end := i
+			for end < len(src) && (unicode.IsLetter(rune(src[end])) || unicode.IsDigit(rune(src[end])) || src[end] == '_' || src[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, exprToken{kind: tokenIdent, value: src[i:end], pos: i})
+			i = end
+		default:
+			operator := ""
+			for _, op := range exprOperators {
+				if strings.HasPrefix(src[i:], op) {
+					operator = op
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, exprToken{kind: tokenOperator, value: operator, pos: i})
+			i += len(operator)
+		}
+	}
+	return append(tokens, exprToken{kind: tokenEOF, pos: len(src)}), nil
+}
+
+// exprParser is a recursive descent parser, from the lowest precedence:
+//
+//	or         = and { "||" and }
+//	and        = comparison { "&&" comparison }
+//	comparison = unary [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" | "in" ) unary ]
+//	unary      = "!" unary | primary
+//	primary    = literal | path | call | list | "(" or ")"
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// parseExpr parses the expression into the tree that's checked and evaluated
+func parseExpr(src string) (exprNode, error) {
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", next.value, next.pos)
+	}
+	return node, nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	token := p.tokens[p.pos]
+	if token.kind != tokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+// accept consumes the next token if it's one of the operators
+func (p *exprParser) accept(operators ...string) (string, bool) {
+	token := p.peek()
+	if token.kind != tokenOperator && !(token.kind == tokenIdent && token.value == "in") {
+		return "", false
+	}
+	for _, op := range operators {
+		if token.value == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(operator string) error {
+	if _, ok := p.accept(operator); !ok {
+		token := p.peek()
+		if token.kind == tokenEOF {
+			return fmt.Errorf("expected %q at the end of the expression", operator)
+		}
+		return fmt.Errorf("expected %q but found %q at %d", operator, token.value, token.pos)
+	}
+	return nil
+}
+
+func (p *exprParser) or() (exprNode, error) {
+	left, err := p.and()
+	for err == nil {
+		if _, ok := p.accept("||"); !ok {
+			return left, nil
+		}
+		var right exprNode
+		right, err = p.and()
+		left = &binaryNode{op: "||", left: left, right: right}
+	}
+	return nil, err
+}
+
+func (p *exprParser) and() (exprNode, error) {
+	left, err := p.comparison()
+	for err == nil {
+		if _, ok := p.accept("&&"); !ok {
+			return left, nil
+		}
+		var right exprNode
+		right, err = p.comparison()
+		left = &binaryNode{op: "&&", left: left, right: right}
+	}
+	return nil, err
+}
+
+func (p *exprParser) comparison() (exprNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "in")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryNode{op: op, left: left, right: right}, nil
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	if _, ok := p.accept("!"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (exprNode, error) {
+	token := p.next()
+	switch token.kind {
+	case tokenString:
+		return &literalNode{value: token.value}, nil
+	case tokenNumber:
+		number, err := strconv.ParseFloat(token.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", token.value, token.pos)
+		}
+		return &literalNode{value: number}, nil
+	case tokenIdent:
+		switch token.value {
+		case "true", "false":
+			return &literalNode{value: token.value == "true"}, nil
+		case "null":
+			return &literalNode{}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			return p.call(token)
+		}
+		segments := strings.Split(token.value, ".")
+		for _, segment := range segments {
+			if segment == "" {
+				return nil, fmt.Errorf("invalid field %q at %d", token.value, token.pos)
+			}
+		}
+		return &pathNode{segments: segments}, nil
+	case tokenOperator:
+		switch token.value {
+		case "(":
+			node, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			return p.list()
+		}
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of the expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", token.value, token.pos)
+}
+
+// call parses the arguments of a function, its name and opening bracket have already been consumed
+func (p *exprParser) call(name exprToken) (exprNode, error) {
+	if _, ok := exprFunctions[name.value]; !ok {
+		return nil, fmt.Errorf("unknown function %q at %d", name.value, name.pos)
+	}
+	node := &callNode{name: name.value}
+	if _, ok := p.accept(")"); ok {
+		return node, nil
+	}
+	for {
+		arg, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		node.args = append(node.args, arg)
+		if _, ok := p.accept(","); !ok {
+			return node, p.expect(")")
+		}
+	}
+}
+
+// list parses the items of a list literal, its opening bracket has already been consumed
+func (p *exprParser) list() (exprNode, error) {
+	node := &listNode{}
+	if _, ok := p.accept("]"); ok {
+		return node, nil
+	}
+	for {
+		item, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		node.items = append(node.items, item)
+		if _, ok := p.accept(","); !ok {
+			return node, p.expect("]")
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"github.com/xanzy/go-gitlab"
+	"testing"
+)
+
+func TestExpressionValidate(t *testing.T) {
+	data := []struct {
+		name          string
+		expr          string
+		eventType     gitlab.EventType
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "Valid Merge Request", expr: `object_attributes.target_branch == "main" && user.username != "renovate"`, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: true, errMsg: "expected nil for a valid expression"},
+		{name: "Labels of a list", expr: `"bug" in labels.name || len(labels) > 2`, eventType: gitlab.EventTypeIssue, expectedIsNil: true, errMsg: "expected nil as labels.name is a list of strings"},
+		{name: "Field of any comment", expr: `merge_request.source_branch == "dev" || contains(lower(object_attributes.note), "lgtm")`, eventType: gitlab.EventTypeNote, expectedIsNil: true, errMsg: "expected nil as merge_request is in the merge request comment payload"},
+		{name: "Unchecked resource", expr: `anything.goes == 1`, eventType: gitlab.EventTypeSystemHook, expectedIsNil: true, errMsg: "expected nil as system hooks aren't type checked"},
+		{name: "Syntax error", expr: `object_attributes.iid ==`, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error for an incomplete expression"},
+		{name: "Unknown field", expr: `object_attributes.nope == 1`, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as nope isn't in the payload"},
+		{name: "Field of another resource", expr: `merge_request.iid == 1`, eventType: gitlab.EventTypeIssue, expectedIsNil: false, errMsg: "expected an error as issues don't have a merge_request"},
+		{name: "Mismatched comparison", expr: `object_attributes.iid == "1"`, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as iid is a number"},
+		{name: "Not a bool", expr: `object_attributes.title`, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as the expression is a string"},
+		{name: "Unknown function", expr: `shell("ls")`, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as shell isn't a function"},
+		{name: "Invalid pattern", expr: `matches(object_attributes.title, "(")`, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as the pattern doesn't compile"},
+		{name: "Wrong argument", expr: `startsWith(object_attributes.iid, "1")`, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as iid isn't a string"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := newExpression(d.expr).validate(d.eventType)
+			want := expectedIsNil(got)
+			if want != d.expectedIsNil {
+				t.Errorf("%s: %v", d.errMsg, got)
+			}
+		})
+	}
+}
+
+func TestExpressionEvaluate(t *testing.T) {
+	event := gitlab.MergeEvent{}
+	event.User = &gitlab.EventUser{Username: "renovate"}
+	event.ObjectAttributes.IID = 7
+	event.ObjectAttributes.TargetBranch = "main"
+	event.ObjectAttributes.Title = "Draft: Update dependency"
+	event.Labels = []*gitlab.Label{{Name: "bug"}, {Name: "severity::low"}}
+
+	data := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{name: "Equal", expr: `object_attributes.target_branch == "main"`, expected: true},
+		{name: "And", expr: `object_attributes.target_branch == "main" && user.username != "renovate"`, expected: false},
+		{name: "Or with grouping", expr: `!(user.username == "renovate") || (object_attributes.iid >= 7 && object_attributes.iid < 8)`, expected: true},
+		{name: "In a list field", expr: `"bug" in labels.name`, expected: true},
+		{name: "In a list literal", expr: `object_attributes.target_branch in ["main", 'master']`, expected: true},
+		{name: "Substring", expr: `"Draft" in object_attributes.title`, expected: true},
+		{name: "Functions", expr: `startsWith(lower(object_attributes.title), "draft:") && matches(object_attributes.title, "dependency$") && len(labels) == 2`, expected: true},
+		{name: "Missing field is null", expr: `object_attributes.source.name == null && !object_attributes.work_in_progress`, expected: true},
+		{name: "Short circuit", expr: `false && object_attributes.title`, expected: false},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got, err := newExpression(d.expr).evaluate(event)
+			if err != nil {
+				t.Fatalf("expected %s to be evaluated, but got %v", d.expr, err)
+			}
+			if got != d.expected {
+				t.Errorf("expected %s to be %v, but got %v", d.expr, d.expected, got)
+			}
+		})
+	}
+
+	if _, err := newExpression(`object_attributes.title && true`).evaluate(event); err == nil {
+		t.Errorf("expected an error when && is given a string")
+	}
+	if _, err := newExpression(`contains()`).evaluate(event); err == nil {
+		t.Errorf("expected an error rather than a panic when a function is missing its arguments")
+	}
+}
+
+func TestExplainExpression(t *testing.T) {
+	event := &gitlab.MergeCommentEvent{}
+	event.ObjectAttributes.Note = "LGTM"
+	event.MergeRequest.TargetBranch = "main"
+	adaptor, _ := newNoteEventAdaptor(event)
+	policy := Policy{Resource: Resource{gitlab.EventTypeNote}, Conditions: Condition{Expr: newExpression(`merge_request.target_branch == "main" && lower(object_attributes.note) == "lgtm"`)}}
+
+	trace := explain(policy, adaptor, gitlab.EventTypeNote, Options{Clock: fixedClock})
+	if !trace.Matched() || trace[1].Condition != "expr" || trace[1].Actual != true {
+		t.Errorf("expected the expression to be met by the comment, got %+v", trace)
+	}
+}
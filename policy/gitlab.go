@@ -1,10 +1,38 @@
 package policy
 
-import "github.com/xanzy/go-gitlab"
+import (
+	"errors"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"time"
+)
 
 // gitLabUpdateFn is allows for possible multiple action requests to
-// be stacked up and executed as part of an array
-type gitLabUpdateFn func(action Action, client *gitlab.Client) (string, error)
+// be stacked up and executed as part of an array. Any options are passed
+// on to the gitlab.Client request
+type gitLabUpdateFn func(action Action, client *gitlab.Client, options ...gitlab.RequestOptionFunc) (string, error)
+
+// updateKind identifies the part of an Action that a gitLabUpdateFn carries out
+type updateKind string
+
+const (
+	updateKindLabels updateKind = "labels"
+	updateKindStatus updateKind = "status"
+	updateKindNote   updateKind = "note"
+	// updateKindAssignees and updateKindReviewers set who's assigned to or reviews an issue or merge request
+	updateKindAssignees updateKind = "assignees"
+	updateKindReviewers updateKind = "reviewers"
+)
+
+// update is a prepared gitLabUpdateFn along with the kind of update it makes
+type update struct {
+	kind updateKind
+	fn   gitLabUpdateFn
+	// labels is the change a labels update makes
+	labels *labelChange
+	// assigned are the usernames an assignees or reviewers update picked, once it's run
+	assigned *[]string
+}
 
 // GitLabUpdateResult reports back to the caller the series of events taken
 // by the bot to update Gitlab
@@ -14,6 +42,70 @@ type GitLabUpdateResult struct {
 	// more info, without using reflection on a func to get the func name
 	Endpoint string `json:"endpoint"`
 	Error    string `json:"error"`
+	// Update is the kind of update made: labels, status or note
+	Update updateKind `json:"update"`
+	// Attempts is how many times the update was tried
+	Attempts int `json:"attempts,omitempty"`
+	// LabelsAdded and LabelsRemoved are the labels a labels update changed, including
+	// the labels removed because a scoped label replaced them
+	LabelsAdded   []string `json:"labelsAdded,omitempty"`
+	LabelsRemoved []string `json:"labelsRemoved,omitempty"`
+	// Assigned are the users an assignees or reviewers update picked
+	Assigned []string `json:"assigned,omitempty"`
+	// DryRun reports that the update wasn't sent to GitLab
+	DryRun bool `json:"dryRun,omitempty"`
+	// Request is the request that would have been sent to GitLab during a dry run
+	Request *Request `json:"request,omitempty"`
+	// exhausted is set when the update failed with an error that could be retried, but won't be tried again
+	exhausted bool
+}
+
+// Options control how the actions of a matched Policy are executed
+type Options struct {
+	// DryRun records the requests that would be made to GitLab without sending them
+	DryRun bool
+	// DeadLetters stores any updates that still failed after being retried, if set
+	DeadLetters DeadLetterStore
+	// Limits counts the firings of Policies that have a Limit, without it Limits aren't enforced
+	Limits LimitStore
+	// Milestones looks up the milestones that milestone conditions compare by title or state,
+	// without it those conditions aren't met
+	Milestones MilestoneFinder
+	// Changes looks up the files merge requests change for paths conditions, without it those conditions aren't met
+	Changes ChangeFinder
+	// Users looks up authors, group memberships and reviewers for the conditions on people,
+	// without it those conditions aren't met when the webhook doesn't include what they need
+	Users UserFinder
+	// Rotations keeps the turns of round-robin assignments, without it they can't be made
+	Rotations RotationStore
+	// Self is the bot's username, when it's set webhooks triggered by the bot itself don't match any Policy
+	Self string
+	// Loop halts a Policy that fires on the same resource too often, usually because of its own actions
+	Loop *Loop
+	// Clock tells the time that date conditions are compared with, time.Now is used when it isn't set
+	Clock Clock
+	// skipLookups is set once a condition has failed, so the conditions that look things up
+	// in GitLab aren't evaluated for a policy that can't match
+	skipLookups bool
+	// sleep waits between retries, tests replace it to avoid waiting
+	sleep func(time.Duration)
+}
+
+// wait pauses before the next retry
+func (o Options) wait(d time.Duration) {
+	if o.sleep != nil {
+		o.sleep(d)
+		return
+	}
+	time.Sleep(d)
+}
+
+// now is the time from the Options' Clock
+func (o Options) now() time.Time {
+	if o.Clock != nil {
+		return o.Clock()
+	}
+	return time.Now()
 }
 
 // GitLabAdaptor wraps the incoming hook so additional methods can be added
@@ -22,18 +114,96 @@ type GitLabAdaptor interface {
 	Stater
 	Labeler
 	Milestoner
+	Timestamper
+	Identifier
+	Triggerer
+	Payloader
 }
 
 // Preparer provides functionality that the GitLabAdaptor needs to determine what functionality
 // is available to that type
 type Preparer interface {
 	updateLabels() bool
+	labelChange(current []string) labelChange
+	sizeLabels() *Size
 	updateState() bool
 	addNote() bool
+	assign() *Assign
+	assignReviewers() *Assign
 }
 
 // Executor is how the updates to GitLab are done on a per-type basis
 type Executor interface {
-	prepareUpdates(action Preparer) []gitLabUpdateFn
-	execute(action Action, client *gitlab.Client) []GitLabUpdateResult
+	prepareUpdates(action Preparer, opts Options) []update
+	execute(action Action, client *gitlab.Client, opts Options) []GitLabUpdateResult
+}
+
+// executeUpdates runs each of the prepared updates and collects their results.
+// Failed updates are retried according to the Action's Retry
+func executeUpdates(updates []update, action Action, client *gitlab.Client, opts Options) []GitLabUpdateResult {
+	var updateResults []GitLabUpdateResult
+	for _, u := range updates {
+		result := GitLabUpdateResult{Action: action, Update: u.kind, DryRun: opts.DryRun}
+		var err error
+		if opts.DryRun {
+			recorder := &dryRunRecorder{}
+			_, err = u.fn(action, client, recorder.record)
+			result.Attempts = 1
+			if errors.Is(err, errDryRun) {
+				err = nil
+				result.Request = recorder.request
+				result.Endpoint = recorder.request.Endpoint
+			}
+		} else {
+			result.Endpoint, result.Attempts, result.exhausted, err = executeWithRetry(u.fn, action, client, opts)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		} else if u.labels != nil {
+			result.LabelsAdded, result.LabelsRemoved = u.labels.added, u.labels.removed
+		}
+		if u.assigned != nil {
+			result.Assigned = *u.assigned
+		}
+		updateResults = append(updateResults, result)
+	}
+	return updateResults
+}
+
+// executeWithRetry runs the update until it succeeds, fails with an error that can't be retried,
+// or uses up the Action's attempts. The number of attempts made is returned, and whether the update
+// failed with an error that could be retried but won't be, either as the attempts are used up or as
+// GitLab asked for a longer wait than the max backoff
+func executeWithRetry(fn gitLabUpdateFn, action Action, client *gitlab.Client, opts Options) (string, int, bool, error) {
+	for attempt := 1; ; attempt++ {
+		endpoint, err := fn(action, client)
+		if err == nil {
+			return endpoint, attempt, false, nil
+		}
+		retryAfter, ok := action.Retry.retryable(err)
+		if !ok {
+			return endpoint, attempt, false, err
+		}
+		if attempt >= action.Retry.attempts() {
+			return endpoint, attempt, true, err
+		}
+		// a worker, or the webhook's request, would be held up for as long as GitLab asks
+		if retryAfter > action.Retry.maxBackoff() {
+			return endpoint, attempt, true, fmt.Errorf("%w, GitLab asked to retry after %s which is longer than the max backoff", err, retryAfter.Round(time.Second))
+		}
+		wait := action.Retry.backoff(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		opts.wait(wait)
+	}
+}
+
+// endpoint returns the path that was requested, the response is nil
+// when the request failed before it could be sent
+func endpoint(resp *gitlab.Response) string {
+	if resp == nil || resp.Response == nil || resp.Response.Request == nil {
+		return ""
+	}
+	return resp.Response.Request.URL.Path
 }
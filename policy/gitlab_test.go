@@ -19,7 +19,7 @@ func TestEventTypePrepareUpdate(t *testing.T) {
 	}
 	for _, d := range data {
 		t.Run(d.name, func(t *testing.T) {
-			got := d.event.prepareUpdates(d.action)
+			got := d.event.prepareUpdates(d.action, Options{})
 			if len(got) != d.expected {
 				t.Errorf(d.errMsg, d.expected, len(got))
 			}
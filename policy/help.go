@@ -0,0 +1,52 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"strings"
+)
+
+// helpCommand is the built-in command that lists every command declared by the policies
+const helpCommand Command = "help"
+
+// helpPolicyName is the name reported in the WebhookResult of a help reply
+const helpPolicyName = "help"
+
+// Help replies to a note asking the bot user for help with every command declared by the policies.
+// The bool reports whether the Webhook was asking for help, in which case no other policy should be run.
+// The bot's own notes never ask for help when Options.Self is set, as the help text includes the command
+func (w *Webhook) Help(user string, policies []Policy, client *gitlab.Client, opts Options) (WebhookResult, bool) {
+	ne, ok := newNoteEventAdaptor(w.Event)
+	if !ok || user == "" {
+		return WebhookResult{}, false
+	}
+	if self := explainSelf(ne, opts); !self.Matched() {
+		return WebhookResult{}, false
+	}
+	command := Command(fmt.Sprintf("@%s %s", strings.TrimPrefix(user, "@"), helpCommand))
+	if !command.invokedIn(ne.Body) {
+		return WebhookResult{}, false
+	}
+	action := Action{Comment: helpText(command, policies)}
+	return WebhookResult{
+		Policy:  Policy{Name: helpPolicyName, Resource: Resource{w.EventType}},
+		Matched: true,
+		Actions: ne.execute(action, client, opts),
+	}, true
+}
+
+// helpText builds a markdown table of every command declared by the policies
+func helpText(help Command, policies []Policy) string {
+	var sb strings.Builder
+	sb.WriteString("The following commands are available:\n\n")
+	sb.WriteString("| Command | Policy |\n")
+	sb.WriteString("| ------- | ------ |\n")
+	for _, p := range policies {
+		if p.Conditions.Note == nil || p.Conditions.Note.Command == "" {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("| `%s` | %s |\n", p.Conditions.Note.Command, p.Name))
+	}
+	sb.WriteString(fmt.Sprintf("| `%s` | list the available commands |\n", help))
+	return sb.String()
+}
@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHelpText(t *testing.T) {
+	policies := []Policy{
+		{Name: "Assign MR", Resource: Resource{gitlab.EventTypeNote}, Conditions: Condition{Note: &Note{Command: "@quetzal assign <who:user>"}}},
+		{Name: "Label MR", Resource: Resource{gitlab.EventTypeMergeRequest}},
+	}
+	got := helpText("@quetzal help", policies)
+	if !strings.Contains(got, "| `@quetzal assign <who:user>` | Assign MR |") {
+		t.Errorf("expected help to list the assign command, got %s", got)
+	}
+	if strings.Contains(got, "Label MR") {
+		t.Errorf("expected help to skip policies without a command, got %s", got)
+	}
+	if !strings.Contains(got, "`@quetzal help`") {
+		t.Errorf("expected help to list itself, got %s", got)
+	}
+}
+
+func TestWebhookHelp(t *testing.T) {
+	mux, server, client := setup(t)
+	defer teardown(server)
+
+	var body string
+	mux.HandleFunc(fmt.Sprintf("/api/v4/projects/%d/issues/%d/notes", 1, 3), func(w http.ResponseWriter, r *http.Request) {
+		var opt gitlab.CreateIssueNoteOptions
+		_ = json.NewDecoder(r.Body).Decode(&opt)
+		body = *opt.Body
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(&gitlab.Note{})
+	})
+
+	helpNote := &gitlab.IssueCommentEvent{ProjectID: 1}
+	helpNote.Issue.IID = 3
+	helpNote.ObjectAttributes.Note = "@quetzal help"
+	otherNote := &gitlab.IssueCommentEvent{ProjectID: 1}
+	otherNote.ObjectAttributes.Note = "@quetzal assign bob"
+
+	data := []struct {
+		name     string
+		user     string
+		hook     Webhook
+		expected bool
+	}{
+		{name: "Help requested", user: "quetzal", hook: Webhook{EventType: gitlab.EventTypeNote, Event: helpNote}, expected: true},
+		{name: "Help requested of someone else", user: "other", hook: Webhook{EventType: gitlab.EventTypeNote, Event: helpNote}, expected: false},
+		{name: "No bot user", user: "", hook: Webhook{EventType: gitlab.EventTypeNote, Event: helpNote}, expected: false},
+		{name: "Not a help request", user: "quetzal", hook: Webhook{EventType: gitlab.EventTypeNote, Event: otherNote}, expected: false},
+		{name: "Not a note", user: "quetzal", hook: Webhook{EventType: gitlab.EventTypeMergeRequest, Event: &gitlab.MergeEvent{}}, expected: false},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got, ok := d.hook.Help(d.user, nil, client, Options{})
+			if ok != d.expected {
+				t.Fatalf("expected %t but got %t", d.expected, ok)
+			}
+			if ok && len(got.Actions) != 1 {
+				t.Errorf("expected a single reply but got %d", len(got.Actions))
+			}
+		})
+	}
+	if !strings.Contains(body, "The following commands are available") {
+		t.Errorf("expected the help text to be posted, got %s", body)
+	}
+}
@@ -0,0 +1,153 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"strings"
+)
+
+// IssueEventAdaptor wraps the gitlab.IssueEvent
+type IssueEventAdaptor struct {
+	gitlab.IssueEvent
+}
+
+func (i IssueEventAdaptor) state() []string {
+	return []string{i.ObjectAttributes.Action}
+}
+
+func (i IssueEventAdaptor) labels() []string {
+	return sliceLower(i.labelNames())
+}
+
+// labelNames are the names of the labels as they're written in GitLab
+func (i IssueEventAdaptor) labelNames() []string {
+	var labels []string
+	for _, label := range i.Labels {
+		labels = append(labels, label.Name)
+	}
+	return labels
+}
+
+func (i IssueEventAdaptor) timestamp(attribute DateAttribute) string {
+	if attribute == updatedAt {
+		return i.ObjectAttributes.UpdatedAt
+	}
+	return i.ObjectAttributes.CreatedAt
+}
+
+func (i IssueEventAdaptor) payload() interface{} {
+	return i.IssueEvent
+}
+
+func (i IssueEventAdaptor) project() int {
+	return i.Project.ID
+}
+
+func (i IssueEventAdaptor) resourceKey() string {
+	return fmt.Sprintf("issue/%d", i.ObjectAttributes.IID)
+}
+
+func (i IssueEventAdaptor) milestone() int {
+	return i.ObjectAttributes.MilestoneID
+}
+
+func (i IssueEventAdaptor) triggeredBy() string {
+	if i.User == nil {
+		return ""
+	}
+	return i.User.Username
+}
+
+func (i IssueEventAdaptor) authorID() int {
+	return i.ObjectAttributes.AuthorID
+}
+
+// knownAuthor is the user who triggered the webhook, when they're the author
+func (i IssueEventAdaptor) knownAuthor() (string, bool) {
+	if i.User == nil || i.ObjectAttributes.AuthorID == 0 || i.User.ID != i.ObjectAttributes.AuthorID {
+		return "", false
+	}
+	return i.User.Username, true
+}
+
+func (i IssueEventAdaptor) assignees() []string {
+	var assignees []string
+	if i.Assignees != nil {
+		for _, assignee := range *i.Assignees {
+			assignees = append(assignees, assignee.Username)
+		}
+	}
+	if len(assignees) == 0 && i.Assignee != nil {
+		assignees = append(assignees, i.Assignee.Username)
+	}
+	return assignees
+}
+
+// prepare updates goes through the action list and determines what update requests are required.
+func (i IssueEventAdaptor) prepareUpdates(action Preparer, opts Options) []update {
+	var executables []update
+	if action.updateLabels() {
+		change := action.labelChange(i.labelNames())
+		executables = append(executables, update{kind: updateKindLabels, fn: i.executeLabels, labels: &change})
+	}
+	if action.updateState() {
+		executables = append(executables, update{kind: updateKindStatus, fn: i.executeStatus})
+	}
+	if action.addNote() {
+		executables = append(executables, update{kind: updateKindNote, fn: i.executeNote})
+	}
+	if assign := action.assign(); assign != nil {
+		var assigned []string
+		fn := i.assigner(assign.picker("assign", false, 0, opts, &assigned))
+		executables = append(executables, update{kind: updateKindAssignees, fn: fn, assigned: &assigned})
+	}
+	return executables
+}
+
+func (i IssueEventAdaptor) execute(action Action, client *gitlab.Client, opts Options) []GitLabUpdateResult {
+	return executeUpdates(i.prepareUpdates(action, opts), action, client, opts)
+}
+
+// executeLabels adds and removes the labels in one request, so a scoped label and the label it replaces change together
+func (i IssueEventAdaptor) executeLabels(action Action, client *gitlab.Client, options ...gitlab.RequestOptionFunc) (string, error) {
+	change := action.labelChange(i.labelNames())
+	opt := gitlab.UpdateIssueOptions{
+		AddLabels:    change.add,
+		RemoveLabels: change.remove,
+	}
+	_, resp, err := client.Issues.UpdateIssue(i.Project.ID, i.ObjectAttributes.IID, &opt, options...)
+	return endpoint(resp), err
+}
+
+// executeStatus closes or reopens the issue. GitLab only accepts `close` and `reopen`
+// as state events for issues, so `open` is treated as a reopen
+func (i IssueEventAdaptor) executeStatus(action Action, client *gitlab.Client, options ...gitlab.RequestOptionFunc) (string, error) {
+	stateEvent := string(issueStateReopen)
+	if strings.ToLower(string(action.Status)) == string(issueStateClose) {
+		stateEvent = string(issueStateClose)
+	}
+	opt := gitlab.UpdateIssueOptions{
+		StateEvent: &stateEvent,
+	}
+	_, resp, err := client.Issues.UpdateIssue(i.Project.ID, i.ObjectAttributes.IID, &opt, options...)
+	return endpoint(resp), err
+}
+
+// assigner sets the picked users as the issue's assignees
+func (i IssueEventAdaptor) assigner(pick func() ([]int, error)) gitLabUpdateFn {
+	return func(action Action, client *gitlab.Client, options ...gitlab.RequestOptionFunc) (string, error) {
+		ids, err := pick()
+		if err != nil {
+			return "", err
+		}
+		opt := gitlab.UpdateIssueOptions{AssigneeIDs: ids}
+		_, resp, err := client.Issues.UpdateIssue(i.Project.ID, i.ObjectAttributes.IID, &opt, options...)
+		return endpoint(resp), err
+	}
+}
+
+func (i IssueEventAdaptor) executeNote(action Action, client *gitlab.Client, options ...gitlab.RequestOptionFunc) (string, error) {
+	note := action.commentate()
+	_, resp, err := client.Notes.CreateIssueNote(i.Project.ID, i.ObjectAttributes.IID, &gitlab.CreateIssueNoteOptions{Body: &note}, options...)
+	return endpoint(resp), err
+}
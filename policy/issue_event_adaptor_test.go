@@ -0,0 +1,134 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"testing"
+)
+
+func stubIssueEventAdaptor() IssueEventAdaptor {
+	ie := IssueEventAdaptor{}
+	ie.Project.ID = 1
+	ie.ObjectAttributes.IID = 12
+	return ie
+}
+
+func TestIssueEventPrepareUpdate(t *testing.T) {
+	data := []struct {
+		name     string
+		action   Action
+		expected int
+		errMsg   string
+	}{
+		{name: "0 prepared fn()", action: Action{}, expected: 0, errMsg: "expected %d funcs to be stacked as action has nothing, but got %d"},
+		{name: "1 prepared fn()", action: Action{Status: ActionStatus(issueStateClose)}, expected: 1, errMsg: "expected %d funcs to be stacked as action has content, but got %d"},
+		{name: "3 prepared fn()", action: Action{Labels: Labels{[]string{"added"}}, Status: ActionStatus(issueStateClose), Comment: "closing"}, expected: 3, errMsg: "expected %d funcs to be stacked as action has content, but got %d"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := IssueEventAdaptor{}.prepareUpdates(d.action, Options{})
+			if len(got) != d.expected {
+				t.Errorf(d.errMsg, d.expected, len(got))
+			}
+		})
+	}
+}
+
+func TestIssueEventMatcher(t *testing.T) {
+	adaptor := IssueEventAdaptor{}
+	adaptor.ObjectAttributes.Action = string(issueStateOpen)
+	adaptor.ObjectAttributes.MilestoneID = 3
+	adaptor.Labels = append(adaptor.Labels, gitlab.Label{Name: "Bug"})
+	resource := Resource{gitlab.EventTypeIssue}
+
+	data := []struct {
+		name     string
+		policy   Policy
+		expected bool
+		errMsg   string
+	}{
+		{name: "Matching state", policy: Policy{Resource: resource, Conditions: Condition{State: &State{[]string{string(issueStateOpen)}}}}, expected: true, errMsg: "expected true as the issue was opened"},
+		{name: "Unmatched state", policy: Policy{Resource: resource, Conditions: Condition{State: &State{[]string{string(issueStateClose)}}}}, expected: false, errMsg: "expected false as the issue was not closed"},
+		{name: "Matching labels", policy: Policy{Resource: resource, Conditions: Condition{Labels: Labels{[]string{"bug"}}}}, expected: true, errMsg: "expected true as labels are case-insensitive"},
+		{name: "Forbidden label present", policy: Policy{Resource: resource, Conditions: Condition{ForbiddenLabels: ForbiddenLabels{[]string{"bug"}}}}, expected: false, errMsg: "expected false as the issue has a forbidden label"},
+		{name: "Matching milestone", policy: Policy{Resource: resource, Conditions: Condition{Milestone: &Milestone{ID: 3}}}, expected: true, errMsg: "expected true as milestones match"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := matcher(d.policy, adaptor, gitlab.EventTypeIssue)
+			if got != d.expected {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestIssueExecuteMethods(t *testing.T) {
+	mux, server, client := setup(t)
+	defer teardown(server)
+
+	ie := stubIssueEventAdaptor()
+	endpoint := fmt.Sprintf("/api/v4/projects/%d/issues/%d", ie.Project.ID, ie.ObjectAttributes.IID)
+	noteEndpoint := fmt.Sprintf("%s/notes", endpoint)
+	action := Action{Status: ActionStatus(issueStateClose), Labels: Labels{[]string{"closed"}}, Comment: "closing this issue"}
+
+	var stateEvent string
+	mux.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		var opt gitlab.UpdateIssueOptions
+		_ = json.NewDecoder(r.Body).Decode(&opt)
+		if opt.StateEvent != nil {
+			stateEvent = *opt.StateEvent
+		}
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(&gitlab.Issue{}); err != nil {
+			t.Errorf("failed to encode response")
+		}
+	})
+	mux.HandleFunc(noteEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(&gitlab.Note{Body: action.commentate()}); err != nil {
+			t.Errorf("failed to encode response")
+		}
+	})
+
+	data := []struct {
+		name     string
+		updateFn gitLabUpdateFn
+		expected string
+		errMsg   string
+	}{
+		{name: "Execute Labels", updateFn: ie.executeLabels, expected: endpoint, errMsg: "expected endpoint to be %s but got %s"},
+		{name: "Execute Notes", updateFn: ie.executeNote, expected: noteEndpoint, errMsg: "expected endpoint to be %s but got %s"},
+		{name: "Execute Status", updateFn: ie.executeStatus, expected: endpoint, errMsg: "expected endpoint to be %s but got %s"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got, err := d.updateFn(action, client)
+			if err != nil {
+				t.Errorf("expected no error to occur in mock request")
+			}
+			if got != d.expected {
+				t.Errorf(d.errMsg, d.expected, got)
+			}
+		})
+	}
+
+	t.Run("Open status is sent as reopen", func(t *testing.T) {
+		_, err := ie.executeStatus(Action{Status: ActionStatus(issueStateOpen)}, client)
+		if err != nil {
+			t.Errorf("expected no error to occur in mock request")
+		}
+		if stateEvent != string(issueStateReopen) {
+			t.Errorf("expected state event to be %s but got %s", issueStateReopen, stateEvent)
+		}
+	})
+
+	t.Run("Execute all updates", func(t *testing.T) {
+		got := ie.execute(action, client, Options{})
+		if len(got) != 3 {
+			t.Errorf("expected %d updates to occur, but got %d", 3, len(got))
+		}
+	})
+}
@@ -0,0 +1,281 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LabelMatch is how a Labels condition compares its labels with the webhook's
+type LabelMatch string
+
+const (
+	// labelMatchExact needs every webhook label to match one of the condition's, and every one of the
+	// condition's to match a webhook label
+	labelMatchExact LabelMatch = "exact"
+	// labelMatchAll needs every one of the condition's labels to match a webhook label, other labels are ignored
+	labelMatchAll LabelMatch = "all"
+	// labelMatchAny needs at least one of the condition's labels to match a webhook label
+	labelMatchAny LabelMatch = "any"
+)
+
+// scopeSeparator separates the scope of a GitLab scoped label from its value, such as `priority::high`
+const scopeSeparator = "::"
+
+// labelPattern is a label from a Labels or ForbiddenLabels condition. It's either a label name,
+// a glob such as `priority::*`, a regular expression between slashes such as `/^v\d+$/`,
+// or a scope ending in `::` such as `priority::` which matches every label in that scope.
+// A `*` or `?` preceded by a backslash is literal, so `needs-info\?` is the label `needs-info?`
+type labelPattern struct {
+	source string
+	// name is the lower cased label, without its escapes, for patterns matching a single label
+	name string
+	// scope is set for patterns matching a whole scope
+	scope string
+	// pattern is set for globs and regular expressions
+	pattern *regexp.Regexp
+}
+
+// parseLabelPattern compiles the label, labels are matched case-insensitively
+func parseLabelPattern(label string) (labelPattern, error) {
+	lp := labelPattern{source: label}
+	lowered := strings.ToLower(label)
+	switch {
+	case len(label) > 1 && strings.HasPrefix(label, "/") && strings.HasSuffix(label, "/"):
+		pattern, err := regexp.Compile("(?i)" + label[1:len(label)-1])
+		if err != nil {
+			return lp, fmt.Errorf("label pattern %s is not a valid regular expression: %v", label, err)
+		}
+		lp.pattern = pattern
+	case strings.HasSuffix(lowered, scopeSeparator):
+		lp.scope = strings.TrimSuffix(lowered, scopeSeparator)
+		if lp.scope == "" {
+			return lp, fmt.Errorf("label scope %s is missing its name", label)
+		}
+	default:
+		lp.pattern, lp.name = parseGlob(lowered)
+	}
+	return lp, nil
+}
+
+// parseGlob turns a glob into a regular expression, where `*` is any text and `?` any single character.
+// A backslash makes the character after it literal. When there are no wildcards the regular expression is
+// nil and the label, without its escapes, is returned instead
+func parseGlob(label string) (*regexp.Regexp, string) {
+	var glob, name strings.Builder
+	wildcard, escaped := false, false
+	for _, r := range label {
+		switch {
+		case escaped:
+			escaped = false
+			glob.WriteString(regexp.QuoteMeta(string(r)))
+			name.WriteRune(r)
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			wildcard = true
+			glob.WriteString(".*")
+		case r == '?':
+			wildcard = true
+			glob.WriteString(".")
+		default:
+			glob.WriteString(regexp.QuoteMeta(string(r)))
+			name.WriteRune(r)
+		}
+	}
+	if escaped {
+		glob.WriteString(`\\`)
+		name.WriteRune('\\')
+	}
+	if !wildcard {
+		return nil, name.String()
+	}
+	return regexp.MustCompile("^" + glob.String() + "$"), ""
+}
+
+// matches reports whether the lower cased label matches the pattern
+func (lp labelPattern) matches(label string) bool {
+	switch {
+	case lp.pattern != nil:
+		return lp.pattern.MatchString(label)
+	case lp.scope != "":
+		scope, ok := labelScope(label)
+		return ok && scope == lp.scope
+	}
+	return lp.name == label
+}
+
+// labelScope is the scope of a scoped label, the bool is false when the label isn't scoped.
+// Labels can have nested scopes, such as `team::backend::api`, the scope is everything before the last `::`
+func labelScope(label string) (string, bool) {
+	i := strings.LastIndex(label, scopeSeparator)
+	if i < 1 {
+		return "", false
+	}
+	return label[:i], true
+}
+
+// parseLabelPatterns compiles each of the labels, stopping at the first that isn't valid
+func parseLabelPatterns(labels []string) ([]labelPattern, error) {
+	patterns := make([]labelPattern, 0, len(labels))
+	for _, label := range labels {
+		lp, err := parseLabelPattern(label)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, lp)
+	}
+	return patterns, nil
+}
+
+// validateLabelPatterns ensures each label pattern compiles
+func validateLabelPatterns(labels []string) error {
+	_, err := parseLabelPatterns(labels)
+	return err
+}
+
+// validate ensures the LabelMatch is one of its options, it defaults to exact
+func (m LabelMatch) validate() error {
+	switch m {
+	case "", labelMatchExact, labelMatchAll, labelMatchAny:
+		return nil
+	}
+	return fmt.Errorf("labelMatch allowed options are: `%s`, `%s`, `%s`. But received: %s", labelMatchExact, labelMatchAll, labelMatchAny, m)
+}
+
+// matchesAny reports whether any of the lower cased labels match the pattern
+func (lp labelPattern) matchesAny(labels []string) bool {
+	for _, label := range labels {
+		if lp.matches(label) {
+			return true
+		}
+	}
+	return false
+}
+
+// labelsMatch compares the condition's labels with the webhook's lower cased labels using the LabelMatch.
+// When they don't match, the reason explains which label didn't
+func labelsMatch(mode LabelMatch, labels, webhookLabels []string) (bool, string) {
+	patterns, err := parseLabelPatterns(labels)
+	if err != nil {
+		return false, err.Error()
+	}
+	switch mode {
+	case labelMatchAny:
+		for _, lp := range patterns {
+			if lp.matchesAny(webhookLabels) {
+				return true, ""
+			}
+		}
+		return false, "none of the labels are present"
+	case labelMatchAll:
+		for _, lp := range patterns {
+			if !lp.matchesAny(webhookLabels) {
+				return false, fmt.Sprintf("the label %s is missing", lp.source)
+			}
+		}
+		return true, ""
+	}
+	for _, lp := range patterns {
+		if !lp.matchesAny(webhookLabels) {
+			return false, fmt.Sprintf("the label %s is missing", lp.source)
+		}
+	}
+	for _, label := range webhookLabels {
+		matched := false
+		for _, lp := range patterns {
+			matched = matched || lp.matches(label)
+		}
+		if !matched {
+			return false, fmt.Sprintf("the label %s isn't one of the labels", label)
+		}
+	}
+	return true, ""
+}
+
+// forbiddenLabelPresent reports whether any webhook label matches one of the forbidden labels,
+// the reason explains which label was present
+func forbiddenLabelPresent(forbidden, webhookLabels []string) (bool, string) {
+	patterns, err := parseLabelPatterns(forbidden)
+	if err != nil {
+		return true, err.Error()
+	}
+	for _, lp := range patterns {
+		for _, label := range webhookLabels {
+			if lp.matches(label) {
+				return true, "the forbidden label " + label + " is present"
+			}
+		}
+	}
+	return false, ""
+}
+
+// labelChange is the labels an Action adds and removes from an issue or merge request
+type labelChange struct {
+	// add and remove are the labels sent to GitLab
+	add    []string
+	remove []string
+	// added and removed are the labels that change, those added that weren't already
+	// present and those removed that were
+	added   []string
+	removed []string
+}
+
+// labelChange works out the labels to add and remove from the current labels. As GitLab does in its UI,
+// adding a scoped label such as `status::review` replaces any other label in the `status` scope, so
+// they're removed in the same request
+func (a Action) labelChange(current []string) labelChange {
+	change := labelChange{add: a.Labels.Labels, remove: a.RemoveLabels}
+	for _, label := range a.Labels.Labels {
+		scope, ok := labelScope(strings.ToLower(label))
+		if !ok {
+			continue
+		}
+		for _, existing := range current {
+			existingScope, scoped := labelScope(strings.ToLower(existing))
+			if scoped && existingScope == scope && !strings.EqualFold(existing, label) && !containsFold(change.remove, existing) {
+				change.remove = append(change.remove, existing)
+			}
+		}
+	}
+	for _, label := range change.add {
+		if !containsFold(current, label) && !containsFold(change.added, label) {
+			change.added = append(change.added, label)
+		}
+	}
+	for _, label := range change.remove {
+		if containsFold(current, label) && !containsFold(change.add, label) && !containsFold(change.removed, label) {
+			change.removed = append(change.removed, label)
+		}
+	}
+	return change
+}
+
+// validateScopes ensures the Action doesn't add two labels in the same scope, as only one of them could be kept
+func (a Action) validateScopes() error {
+	scopes := map[string]string{}
+	for _, label := range a.Labels.Labels {
+		scope, ok := labelScope(strings.ToLower(label))
+		if !ok {
+			continue
+		}
+		if a.Size != nil && scope == sizeScope {
+			return fmt.Errorf("label %s can't be added alongside size, which adds the size label", label)
+		}
+		if other, exists := scopes[scope]; exists {
+			return fmt.Errorf("labels %s and %s are both in the %s scope, only one label of a scope can be added", other, label, scope)
+		}
+		scopes[scope] = label
+	}
+	return nil
+}
+
+// containsFold reports whether the labels contain the label, ignoring case
+func containsFold(labels []string, label string) bool {
+	for _, l := range labels {
+		if strings.EqualFold(l, label) {
+			return true
+		}
+	}
+	return false
+}
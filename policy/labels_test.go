@@ -0,0 +1,170 @@
+package policy
+
+import (
+	"encoding/json"
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestLabelPatternMatches(t *testing.T) {
+	data := []struct {
+		name     string
+		pattern  string
+		label    string
+		expected bool
+	}{
+		{name: "Name", pattern: "Bug", label: "bug", expected: true},
+		{name: "Different name", pattern: "bug", label: "bugs", expected: false},
+		{name: "Glob", pattern: "priority::*", label: "priority::high", expected: true},
+		{name: "Glob with single character", pattern: "v?", label: "v2", expected: true},
+		{name: "Glob doesn't match", pattern: "priority::*", label: "severity::high", expected: false},
+		{name: "Escaped question mark", pattern: `Needs-Info\?`, label: "needs-info?", expected: true},
+		{name: "Escaped question mark is literal", pattern: `needs-info\?`, label: "needs-infox", expected: false},
+		{name: "Escaped star is literal", pattern: `\*starred`, label: "very starred", expected: false},
+		{name: "Escaped star with a glob", pattern: `\*-*`, label: "*-important", expected: true},
+		{name: "Escaped backslash", pattern: `a\\b`, label: `a\b`, expected: true},
+		{name: "Regular expression", pattern: `/^V\d+$/`, label: "v12", expected: true},
+		{name: "Regular expression doesn't match", pattern: `/^v\d+$/`, label: "v1.2", expected: false},
+		{name: "Scope", pattern: "Severity::", label: "severity::high", expected: true},
+		{name: "Nested scope", pattern: "team::backend::", label: "team::backend::api", expected: true},
+		{name: "Scope doesn't match a nested scope", pattern: "team::", label: "team::backend::api", expected: false},
+		{name: "Scope doesn't match an unscoped label", pattern: "severity::", label: "severity", expected: false},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			lp, err := parseLabelPattern(d.pattern)
+			if err != nil {
+				t.Fatalf("failed to parse pattern: %v", err)
+			}
+			if got := lp.matches(d.label); got != d.expected {
+				t.Errorf("expected %s matching %s to be %v", d.pattern, d.label, d.expected)
+			}
+		})
+	}
+}
+
+func TestLabelsMatch(t *testing.T) {
+	webhookLabels := []string{"backend", "bug", "priority::high"}
+	data := []struct {
+		name     string
+		mode     LabelMatch
+		labels   []string
+		expected bool
+	}{
+		{name: "Exact by default", labels: []string{"bug"}, expected: false},
+		{name: "Exact with patterns", mode: labelMatchExact, labels: []string{"bug", "backend", "priority::"}, expected: true},
+		{name: "All as a subset", mode: labelMatchAll, labels: []string{"bug"}, expected: true},
+		{name: "All missing one", mode: labelMatchAll, labels: []string{"bug", "frontend"}, expected: false},
+		{name: "Any", mode: labelMatchAny, labels: []string{"frontend", "priority::*"}, expected: true},
+		{name: "Any missing all", mode: labelMatchAny, labels: []string{"frontend", "severity::"}, expected: false},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if got, reason := labelsMatch(d.mode, d.labels, webhookLabels); got != d.expected {
+				t.Errorf("expected %v to match %v, got %v: %s", d.labels, d.expected, got, reason)
+			}
+		})
+	}
+}
+
+func TestLabelConditionsValidate(t *testing.T) {
+	data := []struct {
+		name          string
+		condition     Condition
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "Valid patterns", condition: Condition{Labels: Labels{[]string{"bug", "priority::*", `/^v\d+$/`}}, ForbiddenLabels: ForbiddenLabels{[]string{"severity::"}}, LabelMatch: labelMatchAll}, expectedIsNil: true, errMsg: "expected nil for valid patterns"},
+		{name: "Invalid regular expression", condition: Condition{Labels: Labels{[]string{"/(/"}}}, expectedIsNil: false, errMsg: "expected an error as the regular expression doesn't compile"},
+		{name: "Scope without a name", condition: Condition{ForbiddenLabels: ForbiddenLabels{[]string{"::"}}}, expectedIsNil: false, errMsg: "expected an error as the scope has no name"},
+		{name: "Invalid label match", condition: Condition{LabelMatch: "some"}, expectedIsNil: false, errMsg: "expected an error as some isn't a label match"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			pol := Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: d.condition}
+			if got := expectedIsNil(pol.Validate()); got != d.expectedIsNil {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestForbiddenScopedLabels(t *testing.T) {
+	adaptor := MergeEventAdaptor{}
+	adaptor.Labels = []*gitlab.Label{{Name: "Severity::High"}}
+	pol := Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{ForbiddenLabels: ForbiddenLabels{[]string{"severity::"}}}}
+	if matcher(pol, adaptor, gitlab.EventTypeMergeRequest) {
+		t.Errorf("expected a label in a forbidden scope to stop the policy matching")
+	}
+	adaptor.Labels = []*gitlab.Label{{Name: "priority::high"}}
+	if !matcher(pol, adaptor, gitlab.EventTypeMergeRequest) {
+		t.Errorf("expected a label in another scope to be allowed")
+	}
+}
+
+func TestActionLabelChange(t *testing.T) {
+	current := []string{"Status::Doing", "bug", "priority::low", "team::backend::api"}
+	data := []struct {
+		name            string
+		action          Action
+		expectedRemove  []string
+		expectedAdded   []string
+		expectedRemoved []string
+	}{
+		{name: "Unscoped label", action: Action{Labels: Labels{[]string{"backend"}}}, expectedAdded: []string{"backend"}},
+		{name: "Scoped label replaces its scope", action: Action{Labels: Labels{[]string{"status::review"}}}, expectedRemove: []string{"Status::Doing"}, expectedAdded: []string{"status::review"}, expectedRemoved: []string{"Status::Doing"}},
+		{name: "Label already present", action: Action{Labels: Labels{[]string{"status::doing"}}}},
+		{name: "Nested scope", action: Action{Labels: Labels{[]string{"team::backend::db"}}}, expectedRemove: []string{"team::backend::api"}, expectedAdded: []string{"team::backend::db"}, expectedRemoved: []string{"team::backend::api"}},
+		{name: "Removed alongside", action: Action{Labels: Labels{[]string{"priority::high"}}, RemoveLabels: []string{"bug", "missing"}}, expectedRemove: []string{"bug", "missing", "priority::low"}, expectedAdded: []string{"priority::high"}, expectedRemoved: []string{"bug", "priority::low"}},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := d.action.labelChange(current)
+			if !reflect.DeepEqual(got.remove, d.expectedRemove) {
+				t.Errorf("expected %v to be removed, but got %v", d.expectedRemove, got.remove)
+			}
+			if !reflect.DeepEqual(got.added, d.expectedAdded) || !reflect.DeepEqual(got.removed, d.expectedRemoved) {
+				t.Errorf("expected %v added and %v removed, but got %v and %v", d.expectedAdded, d.expectedRemoved, got.added, got.removed)
+			}
+		})
+	}
+}
+
+func TestActionValidateScopes(t *testing.T) {
+	pol := Policy{Resource: Resource{gitlab.EventTypeIssue}, Actions: Action{Labels: Labels{[]string{"status::review", "Status::Done"}}}}
+	if pol.Validate() == nil {
+		t.Errorf("expected an error as two labels in the status scope can't both be added")
+	}
+	pol.Actions.Labels = Labels{[]string{"status::review", "priority::high", "bug"}}
+	if err := pol.Validate(); err != nil {
+		t.Errorf("expected labels in different scopes to be valid, got %v", err)
+	}
+}
+
+func TestExecuteScopedLabels(t *testing.T) {
+	mux, server, client := setup(t)
+	defer teardown(server)
+
+	me := stubMergeEventAdaptor()
+	me.Labels = []*gitlab.Label{{Name: "status::doing"}, {Name: "bug"}}
+	var body map[string]string
+	mux.HandleFunc(stubUpdatedMergeEventEndPoint(me), func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if err := json.NewEncoder(w).Encode(&gitlab.MergeRequest{}); err != nil {
+			t.Errorf("failed to encode response")
+		}
+	})
+
+	got := me.execute(Action{Labels: Labels{[]string{"status::review"}}}, client, Options{})
+	if len(got) != 1 || got[0].Error != "" {
+		t.Fatalf("expected the labels update to succeed, got %+v", got)
+	}
+	if body["add_labels"] != "status::review" || body["remove_labels"] != "status::doing" {
+		t.Errorf("expected the scoped label to be replaced in one request, got %v", body)
+	}
+	if !reflect.DeepEqual(got[0].LabelsAdded, []string{"status::review"}) || !reflect.DeepEqual(got[0].LabelsRemoved, []string{"status::doing"}) {
+		t.Errorf("expected the result to report the changed labels, got %+v", got[0])
+	}
+}
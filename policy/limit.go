@@ -0,0 +1,121 @@
+package policy
+
+import (
+	"fmt"
+	"time"
+)
+
+// LimitScope is what a Limit counts the firings of a Policy against
+type LimitScope string
+
+const (
+	// limitScopeGlobal counts every firing of the Policy
+	limitScopeGlobal LimitScope = "global"
+	// limitScopeProject counts the firings for each project
+	limitScopeProject LimitScope = "project"
+	// limitScopeResource counts the firings for each issue, merge request, commit or snippet
+	limitScopeResource LimitScope = "resource"
+)
+
+// Limit caps how many times a Policy's actions can be taken, such as once per merge request
+// or 20 times a day. A Policy without a Limit can fire any number of times
+type Limit struct {
+	// Max is how many times the Policy can fire
+	Max int `yaml:"max"`
+	// Per is what the firings are counted against: `global`, `project` or `resource`, `global` by default
+	Per LimitScope `yaml:"per,omitempty"`
+	// Window is the period the firings are counted over, such as 24h.
+	// Without a Window the limit never resets
+	Window time.Duration `yaml:"window,omitempty"`
+}
+
+// LimitStore counts the firings of limited Policies
+type LimitStore interface {
+	// Take records a firing against the key, unless max firings have already been recorded
+	// within the window before now. The bool reports whether the firing was recorded
+	Take(key string, max int, window time.Duration, now time.Time) (bool, error)
+}
+
+// Identifier identifies what a webhook is about, so a Limit can count firings against it
+type Identifier interface {
+	project() int
+	// resourceKey identifies the issue, merge request, commit or snippet within the project
+	resourceKey() string
+}
+
+// scope is the Limit's LimitScope, defaulting to global
+func (l *Limit) scope() LimitScope {
+	if l.Per == "" {
+		return limitScopeGlobal
+	}
+	return l.Per
+}
+
+// key is what the Policy's firings are counted against for the webhook
+func (l *Limit) key(policy string, adaptor Identifier) string {
+	switch l.scope() {
+	case limitScopeProject:
+		return fmt.Sprintf("%s/project/%d", policy, adaptor.project())
+	case limitScopeResource:
+		return fmt.Sprintf("%s/project/%d/%s", policy, adaptor.project(), adaptor.resourceKey())
+	}
+	return policy
+}
+
+// String describes the Limit, such as `at most 20 per project every 24h0m0s`
+func (l *Limit) String() string {
+	description := fmt.Sprintf("at most %d", l.Max)
+	if l.scope() != limitScopeGlobal {
+		description = fmt.Sprintf("%s per %s", description, l.scope())
+	}
+	if l.Window > 0 {
+		description = fmt.Sprintf("%s every %s", description, l.Window)
+	}
+	return description
+}
+
+// validate ensures the Limit can be counted
+func (l *Limit) validate() error {
+	if l == nil {
+		return nil
+	}
+	if l.Max < 1 {
+		return fmt.Errorf("limit max must be at least 1 but received: %d", l.Max)
+	}
+	switch l.Per {
+	case "", limitScopeGlobal, limitScopeProject, limitScopeResource:
+	default:
+		return fmt.Errorf("limit per allowed options are: `%s`, `%s`, `%s`. But received: %s", limitScopeGlobal, limitScopeProject, limitScopeResource, l.Per)
+	}
+	if l.Window < 0 {
+		return fmt.Errorf("limit window can't be negative but received: %s", l.Window)
+	}
+	return nil
+}
+
+// limit checks the Policy's Limit once its conditions have been met, recording the firing if it's allowed.
+// The returned ConditionTrace is nil when the Policy has no Limit. Limits aren't counted during a dry run
+// or without a LimitStore
+func (w *Webhook) limit(pol Policy, adaptor GitLabAdaptor, opts Options) *ConditionTrace {
+	if pol.Limit == nil {
+		return nil
+	}
+	condition := &ConditionTrace{Condition: "limit", Expected: pol.Limit.String(), Passed: true}
+	if opts.Limits == nil || opts.DryRun {
+		condition.Reason = "limits aren't counted without a limit store or during a dry run"
+		return condition
+	}
+	key := pol.Limit.key(pol.Name, adaptor)
+	condition.Actual = key
+	taken, err := opts.Limits.Take(key, pol.Limit.Max, pol.Limit.Window, opts.now())
+	if err != nil {
+		condition.Passed = false
+		condition.Reason = fmt.Sprintf("the limit couldn't be counted: %v", err)
+		return condition
+	}
+	if !taken {
+		condition.Passed = false
+		condition.Reason = "the policy has reached its limit"
+	}
+	return condition
+}
@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"github.com/xanzy/go-gitlab"
+	"testing"
+	"time"
+)
+
+// memoryLimits is a LimitStore for tests
+type memoryLimits struct {
+	fired map[string]int
+}
+
+func (m *memoryLimits) Take(key string, max int, window time.Duration, now time.Time) (bool, error) {
+	if m.fired[key] >= max {
+		return false, nil
+	}
+	m.fired[key]++
+	return true, nil
+}
+
+func TestLimitValidate(t *testing.T) {
+	data := []struct {
+		name          string
+		limit         *Limit
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "No Limit Listed", limit: nil, expectedIsNil: true, errMsg: "expected nil as no limit in policy is valid"},
+		{name: "Valid Limit", limit: &Limit{Max: 20, Window: 24 * time.Hour}, expectedIsNil: true, errMsg: "expected nil for a valid limit"},
+		{name: "Valid Per Resource", limit: &Limit{Max: 1, Per: limitScopeResource}, expectedIsNil: true, errMsg: "expected nil for a limit per resource"},
+		{name: "Max Below One", limit: &Limit{}, expectedIsNil: false, errMsg: "expected an error as the max is 0"},
+		{name: "Invalid Per", limit: &Limit{Max: 1, Per: "user"}, expectedIsNil: false, errMsg: "expected an error as user is not a scope"},
+		{name: "Negative Window", limit: &Limit{Max: 1, Window: -time.Hour}, expectedIsNil: false, errMsg: "expected an error as the window is negative"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := d.limit.validate()
+			want := expectedIsNil(got)
+			if want != d.expectedIsNil {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestLimitKey(t *testing.T) {
+	me := stubMergeEventAdaptor()
+	data := []struct {
+		name     string
+		limit    Limit
+		adaptor  Identifier
+		expected string
+	}{
+		{name: "Global", limit: Limit{Max: 1}, adaptor: me, expected: "welcome"},
+		{name: "Project", limit: Limit{Max: 1, Per: limitScopeProject}, adaptor: me, expected: "welcome/project/1"},
+		{name: "Merge Request", limit: Limit{Max: 1, Per: limitScopeResource}, adaptor: me, expected: "welcome/project/1/merge_request/234"},
+		{name: "Comment on an Issue", limit: Limit{Max: 1, Per: limitScopeResource}, adaptor: NoteEventAdaptor{Type: NoteIssue, ProjectID: 3, IID: 9}, expected: "welcome/project/3/issue/9"},
+		{name: "Comment on a Commit", limit: Limit{Max: 1, Per: limitScopeResource}, adaptor: NoteEventAdaptor{Type: NoteCommit, ProjectID: 3, CommitSHA: "abc"}, expected: "welcome/project/3/commit/abc"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if got := d.limit.key("welcome", d.adaptor); got != d.expected {
+				t.Errorf("expected key %s, but got %s", d.expected, got)
+			}
+		})
+	}
+}
+
+func TestFilterEventLimit(t *testing.T) {
+	event := &gitlab.MergeEvent{}
+	event.Project.ID = 1
+	event.ObjectAttributes.IID = 7
+	w := Webhook{EventType: gitlab.EventTypeMergeRequest, Event: event}
+	limited := Policy{Name: "welcome", Resource: Resource{gitlab.EventTypeMergeRequest}, Limit: &Limit{Max: 1, Per: limitScopeResource}}
+	unmatched := Policy{Name: "merged", Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{State: &State{[]string{"merge"}}}, Limit: &Limit{Max: 1}}
+
+	store := &memoryLimits{fired: map[string]int{}}
+	filter := func(pol Policy, opts Options) WebhookResult {
+		in := make(chan Policy)
+		go func() {
+			in <- pol
+			close(in)
+		}()
+		return <-w.FilterEvent(in, nil, opts)
+	}
+
+	if result := filter(limited, Options{Limits: store}); !result.Matched {
+		t.Fatalf("expected the first firing to match: %+v", result.Trace)
+	}
+	result := filter(limited, Options{Limits: store})
+	if result.Matched {
+		t.Errorf("expected the second firing to be limited")
+	}
+	if last := result.Trace[len(result.Trace)-1]; last.Condition != "limit" || last.Passed {
+		t.Errorf("expected a failed limit condition in the trace, got %+v", last)
+	}
+	if result = filter(limited, Options{Limits: store, DryRun: true}); !result.Matched {
+		t.Errorf("expected limits not to be counted during a dry run")
+	}
+	if filter(unmatched, Options{Limits: store}); store.fired["merged"] != 0 {
+		t.Errorf("expected a policy whose conditions weren't met not to be counted")
+	}
+}
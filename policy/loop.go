@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// loopKeyPrefix keeps the firings counted by the loop detector apart from those of a Policy's own Limit
+const loopKeyPrefix = "loop/"
+
+// Triggerer provides the user who triggered the webhook
+type Triggerer interface {
+	// triggeredBy is the username of the user whose change sent the webhook, empty when the webhook doesn't say
+	triggeredBy() string
+}
+
+// Loop halts a Policy that keeps firing on the same issue, merge request, commit or snippet,
+// as that's usually the Policy's own actions sending webhooks that it matches again
+type Loop struct {
+	// Max is how many times a Policy can fire on the same resource within the Window
+	Max int
+	// Window is the period the firings are counted over
+	Window time.Duration
+}
+
+// limit is the Limit the Loop is counted as, per resource
+func (l *Loop) limit() *Limit {
+	return &Limit{Max: l.Max, Per: limitScopeResource, Window: l.Window}
+}
+
+// explainSelf traces whether the webhook was triggered by the bot's own user, Options.Self.
+// Nothing is traced when Options.Self isn't set
+func explainSelf(adaptor GitLabAdaptor, opts Options) Trace {
+	self := strings.TrimPrefix(opts.Self, "@")
+	if self == "" {
+		return nil
+	}
+	actual := adaptor.triggeredBy()
+	condition := ConditionTrace{Condition: "self", Expected: "not triggered by @" + self, Actual: actual, Passed: true}
+	if strings.EqualFold(actual, self) {
+		condition.Passed = false
+		condition.Reason = "the webhook was triggered by the bot's own changes"
+	}
+	return Trace{condition}
+}
+
+// loop counts the Policy's firing against Options.Loop once its conditions have been met.
+// The returned ConditionTrace is nil without a Loop, and like limits it isn't counted
+// during a dry run or without a LimitStore
+func (w *Webhook) loop(pol Policy, adaptor GitLabAdaptor, opts Options) *ConditionTrace {
+	if opts.Loop == nil {
+		return nil
+	}
+	limit := opts.Loop.limit()
+	condition := &ConditionTrace{Condition: "loop", Expected: limit.String(), Passed: true}
+	if opts.Limits == nil || opts.DryRun {
+		condition.Reason = "loops aren't counted without a limit store or during a dry run"
+		return condition
+	}
+	key := loopKeyPrefix + limit.key(pol.Name, adaptor)
+	condition.Actual = key
+	taken, err := opts.Limits.Take(key, limit.Max, limit.Window, opts.now())
+	if err != nil {
+		condition.Passed = false
+		condition.Reason = fmt.Sprintf("the loop couldn't be counted: %v", err)
+		return condition
+	}
+	if !taken {
+		condition.Passed = false
+		condition.Reason = fmt.Sprintf("the policy fired %d times on the %s within %s, so it's halted as it may be in a loop", limit.Max, adaptor.resourceKey(), limit.Window)
+	}
+	return condition
+}
@@ -0,0 +1,80 @@
+package policy
+
+import (
+	"github.com/xanzy/go-gitlab"
+	"testing"
+	"time"
+)
+
+func TestExplainSelf(t *testing.T) {
+	me := stubMergeEventAdaptor()
+	me.User = &gitlab.EventUser{Username: "Quetzal"}
+	data := []struct {
+		name     string
+		adaptor  GitLabAdaptor
+		self     string
+		expected bool
+	}{
+		{name: "Not Ignoring Self", adaptor: me, self: "", expected: true},
+		{name: "Triggered by the Bot", adaptor: me, self: "@quetzal", expected: false},
+		{name: "Triggered by Someone Else", adaptor: me, self: "other-bot", expected: true},
+		{name: "Bot's Own Note", adaptor: NoteEventAdaptor{Type: NoteIssue, Author: "quetzal"}, self: "quetzal", expected: false},
+		{name: "Unknown Trigger", adaptor: stubIssueEventAdaptor(), self: "quetzal", expected: true},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			pol := Policy{Resource: Resource{gitlab.EventTypeMergeRequest}}
+			if got := explain(pol, d.adaptor, gitlab.EventTypeMergeRequest, Options{Self: d.self}); got.Matched() != d.expected {
+				t.Errorf("expected %v, got %+v", d.expected, got)
+			}
+		})
+	}
+}
+
+func TestHelpIgnoresSelf(t *testing.T) {
+	event := &gitlab.IssueCommentEvent{}
+	event.User = &gitlab.User{Username: "quetzal"}
+	event.ObjectAttributes.Note = "@quetzal help"
+	w := Webhook{EventType: gitlab.EventTypeNote, Event: event}
+	if _, ok := w.Help("quetzal", nil, nil, Options{Self: "quetzal", DryRun: true}); ok {
+		t.Errorf("expected the bot's own note not to ask for help")
+	}
+}
+
+func TestFilterEventLoop(t *testing.T) {
+	event := &gitlab.MergeEvent{}
+	event.Project.ID = 1
+	event.ObjectAttributes.IID = 7
+	w := Webhook{EventType: gitlab.EventTypeMergeRequest, Event: event}
+	pol := Policy{Name: "label", Resource: Resource{gitlab.EventTypeMergeRequest}, Limit: &Limit{Max: 10}}
+
+	store := &memoryLimits{fired: map[string]int{}}
+	opts := Options{Limits: store, Loop: &Loop{Max: 2, Window: time.Minute}}
+	filter := func() WebhookResult {
+		in := make(chan Policy)
+		go func() {
+			in <- pol
+			close(in)
+		}()
+		return <-w.FilterEvent(in, nil, opts)
+	}
+
+	for i := 0; i < 2; i++ {
+		if result := filter(); !result.Matched {
+			t.Fatalf("expected firing %d to match: %+v", i+1, result.Trace)
+		}
+	}
+	result := filter()
+	if result.Matched {
+		t.Errorf("expected the third firing to be halted as a loop")
+	}
+	if last := result.Trace[len(result.Trace)-1]; last.Condition != "loop" || last.Passed || last.Reason == "" {
+		t.Errorf("expected a failed loop condition in the trace, got %+v", last)
+	}
+	if store.fired["loop/label/project/1/merge_request/7"] != 2 {
+		t.Errorf("expected the loop to be counted per resource, got %v", store.fired)
+	}
+	if store.fired["label"] != 2 {
+		t.Errorf("expected the halted firing not to use up the policy's limit, got %v", store.fired)
+	}
+}
@@ -5,11 +5,29 @@ import "github.com/xanzy/go-gitlab"
 // Matcher ensures that a Policy provides the required functionality
 // to enable comparing a Webhook to a Policy
 type Matcher interface {
-	Stater
 	Resourcer
+	Conditioner
+}
+
+// Conditioner provides the conditions of a Policy, or of a Condition nested within a group
+type Conditioner interface {
+	Stater
 	Labeler
-	Milestoner
+	MilestoneMatcher
 	ForbiddenLabeler
+	LabelMatcher
+	Noter
+	DateMatcher
+	MergeRequestMatcher
+	PathMatcher
+	PeopleMatcher
+	Expressioner
+	Grouper
+}
+
+// Grouper provides the all, any and not groups of nested conditions
+type Grouper interface {
+	groups() ConditionGroups
 }
 
 // Stater provides a method to get the state from an object
@@ -32,7 +50,63 @@ type Milestoner interface {
 	milestone() int
 }
 
+// MilestoneMatcher provides the Milestone condition from a Policy
+type MilestoneMatcher interface {
+	milestone() *Milestone
+}
+
 // ForbiddenLabeler provides a list of labels that must be absent
 type ForbiddenLabeler interface {
 	forbiddenLabels() []string
 }
+
+// LabelMatcher provides how a Policy's labels are compared with the webhook's
+type LabelMatcher interface {
+	labelMatch() LabelMatch
+}
+
+// Noter provides the Note condition from a Policy
+type Noter interface {
+	note() *Note
+}
+
+// DateMatcher provides the Date condition from a Policy
+type DateMatcher interface {
+	date() *Date
+}
+
+// MergeRequestMatcher provides the conditions that only merge requests have
+type MergeRequestMatcher interface {
+	mergeRequestConditions() MergeRequestConditions
+}
+
+// PathMatcher provides the Paths condition from a Policy
+type PathMatcher interface {
+	paths() *Paths
+}
+
+// PeopleMatcher provides the conditions on who is involved
+type PeopleMatcher interface {
+	peopleConditions() PeopleConditions
+}
+
+// Expressioner provides the expr condition
+type Expressioner interface {
+	expr() *Expression
+}
+
+// Payloader provides the webhook's event, which expr conditions are evaluated against
+type Payloader interface {
+	payload() interface{}
+}
+
+// Timestamper provides the created_at or updated_at timestamp of a webhook's object
+type Timestamper interface {
+	timestamp(attribute DateAttribute) string
+}
+
+// Commenter provides the details of a comment made on a noteable
+type Commenter interface {
+	noteType() NoteType
+	noteBody() string
+}
@@ -9,7 +9,7 @@ func TestMatcherMilestones(t *testing.T) {
 	//: 20
 	baseAdaptor := MergeEventAdaptor{gitlab.MergeEvent{}}
 	basePolicy := Policy{Resource: Resource{gitlab.EventTypeMergeRequest}}
-	milestonePolicy := Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{Milestone: &Milestone{123}}}
+	milestonePolicy := Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{Milestone: &Milestone{ID: 123}}}
 	milestoneAdaptor := baseAdaptor
 	milestoneAdaptor.ObjectAttributes.MilestoneID = 123
 
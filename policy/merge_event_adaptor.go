@@ -1,6 +1,10 @@
 package policy
 
-import "github.com/xanzy/go-gitlab"
+import (
+	"errors"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+)
 
 // MergeEventAdaptor wraps the gitlab.MergeEvent
 type MergeEventAdaptor struct {
@@ -12,82 +16,197 @@ func (m MergeEventAdaptor) state() []string {
 }
 
 func (m MergeEventAdaptor) labels() []string {
+	return sliceLower(m.labelNames())
+}
+
+// labelNames are the names of the labels as they're written in GitLab
+func (m MergeEventAdaptor) labelNames() []string {
 	var labels []string
 	for _, label := range m.Labels {
 		labels = append(labels, label.Name)
 	}
-	return sliceLower(labels)
+	return labels
+}
+
+func (m MergeEventAdaptor) timestamp(attribute DateAttribute) string {
+	if attribute == updatedAt {
+		return m.ObjectAttributes.UpdatedAt
+	}
+	return m.ObjectAttributes.CreatedAt
+}
+
+func (m MergeEventAdaptor) payload() interface{} {
+	return m.MergeEvent
+}
+
+func (m MergeEventAdaptor) project() int {
+	return m.Project.ID
+}
+
+func (m MergeEventAdaptor) resourceKey() string {
+	return fmt.Sprintf("merge_request/%d", m.ObjectAttributes.IID)
 }
 
 func (m MergeEventAdaptor) milestone() int {
 	return m.ObjectAttributes.MilestoneID
 }
 
+// mergeRequest is a draft when GitLab reports it as a work in progress, and from a fork
+// when its source and target projects differ
+func (m MergeEventAdaptor) mergeRequest() mergeRequestAttributes {
+	return mergeRequestAttributes{
+		sourceBranch: m.ObjectAttributes.SourceBranch,
+		targetBranch: m.ObjectAttributes.TargetBranch,
+		title:        m.ObjectAttributes.Title,
+		description:  m.ObjectAttributes.Description,
+		draft:        m.ObjectAttributes.WorkInProgress,
+		mergeStatus:  m.ObjectAttributes.MergeStatus,
+		fork:         m.ObjectAttributes.SourceProjectID != 0 && m.ObjectAttributes.SourceProjectID != m.ObjectAttributes.TargetProjectID,
+	}
+}
+
+func (m MergeEventAdaptor) triggeredBy() string {
+	if m.User == nil {
+		return ""
+	}
+	return m.User.Username
+}
+
+func (m MergeEventAdaptor) authorID() int {
+	return m.ObjectAttributes.AuthorID
+}
+
+// knownAuthor is the user who triggered the webhook, when they're the author
+func (m MergeEventAdaptor) knownAuthor() (string, bool) {
+	if m.User == nil || m.ObjectAttributes.AuthorID == 0 || m.User.ID != m.ObjectAttributes.AuthorID {
+		return "", false
+	}
+	return m.User.Username, true
+}
+
+func (m MergeEventAdaptor) assignees() []string {
+	var assignees []string
+	for _, assignee := range m.Assignees {
+		assignees = append(assignees, assignee.Username)
+	}
+	if len(assignees) == 0 && m.ObjectAttributes.Assignee != nil {
+		assignees = append(assignees, m.ObjectAttributes.Assignee.Username)
+	}
+	return assignees
+}
+
+// reviewers are looked up, as go-gitlab doesn't decode them from the webhook
+func (m MergeEventAdaptor) reviewers(finder UserFinder) ([]string, error) {
+	return finder.Reviewers(m.Project.ID, m.ObjectAttributes.IID)
+}
+
+// changedPaths are the files changed as of the merge request's latest commit
+func (m MergeEventAdaptor) changedPaths(finder ChangeFinder) ([]string, error) {
+	return finder.ChangedPaths(m.Project.ID, m.ObjectAttributes.IID, m.ObjectAttributes.LastCommit.ID)
+}
+
+// sizeLabel looks up the changes of the merge request and works out its size label
+func (m MergeEventAdaptor) sizeLabel(size *Size, finder ChangeFinder) (string, error) {
+	if finder == nil {
+		return "", errors.New("the merge request's changes can't be looked up for its size without a GitLab client")
+	}
+	mr, err := finder.Diffs(m.Project.ID, m.ObjectAttributes.IID)
+	if err != nil {
+		return "", fmt.Errorf("the merge request's changes couldn't be looked up for its size: %w", err)
+	}
+	stats, err := countDiffStats(mr, size.Ignore)
+	if err != nil {
+		return "", err
+	}
+	return size.label(stats), nil
+}
+
 // prepare updates goes through the action list and determines what update requests are required.
-func (m MergeEventAdaptor) prepareUpdates(action Preparer) []gitLabUpdateFn {
-	var executables []gitLabUpdateFn
+func (m MergeEventAdaptor) prepareUpdates(action Preparer, opts Options) []update {
+	var executables []update
 	if action.updateLabels() {
-		executables = append(executables, m.executeLabels)
+		change := action.labelChange(m.labelNames())
+		fn := m.executeLabels
+		if size := action.sizeLabels(); size != nil {
+			// the size label is added alongside the Action's labels, replacing any previous size label
+			fn = func(action Action, client *gitlab.Client, options ...gitlab.RequestOptionFunc) (string, error) {
+				label, err := m.sizeLabel(size, opts.Changes)
+				if err != nil {
+					return "", err
+				}
+				action.Labels = Labels{append(append([]string{}, action.Labels.Labels...), label)}
+				change = action.labelChange(m.labelNames())
+				return m.executeLabels(action, client, options...)
+			}
+		}
+		executables = append(executables, update{kind: updateKindLabels, fn: fn, labels: &change})
 	}
 	if action.updateState() {
-		executables = append(executables, m.executeStatus)
+		executables = append(executables, update{kind: updateKindStatus, fn: m.executeStatus})
 	}
 	if action.addNote() {
-		executables = append(executables, m.executeNote)
+		executables = append(executables, update{kind: updateKindNote, fn: m.executeNote})
+	}
+	if assign := action.assign(); assign != nil {
+		var assigned []string
+		fn := m.assigner(assign.picker("assign", false, 0, opts, &assigned), false)
+		executables = append(executables, update{kind: updateKindAssignees, fn: fn, assigned: &assigned})
+	}
+	if reviewers := action.assignReviewers(); reviewers != nil {
+		// the author can't review their own merge request
+		var assigned []string
+		fn := m.assigner(reviewers.picker("assignReviewers", true, m.authorID(), opts, &assigned), true)
+		executables = append(executables, update{kind: updateKindReviewers, fn: fn, assigned: &assigned})
 	}
 	return executables
 }
 
-func (m MergeEventAdaptor) execute(action Action, client *gitlab.Client) []GitLabUpdateResult {
-	updates := m.prepareUpdates(action)
-	var updateResults []GitLabUpdateResult
-	for _, update := range updates {
-		endpoint, err := update(action, client)
-		result := GitLabUpdateResult{Action: action, Endpoint: endpoint}
-		if err != nil {
-			result.Error = err.Error()
-		}
-		updateResults = append(updateResults, result)
-	}
-	return updateResults
+func (m MergeEventAdaptor) execute(action Action, client *gitlab.Client, opts Options) []GitLabUpdateResult {
+	return executeUpdates(m.prepareUpdates(action, opts), action, client, opts)
 }
 
-func (m MergeEventAdaptor) executeLabels(action Action, client *gitlab.Client) (string, error) {
+// executeLabels adds and removes the labels in one request, so a scoped label and the label it replaces change together
+func (m MergeEventAdaptor) executeLabels(action Action, client *gitlab.Client, options ...gitlab.RequestOptionFunc) (string, error) {
+	change := action.labelChange(m.labelNames())
 	opt := gitlab.UpdateMergeRequestOptions{
-		AddLabels:    action.Labels.Labels,
-		RemoveLabels: action.RemoveLabels,
-	}
-	_, resp, err := client.MergeRequests.UpdateMergeRequest(m.Project.ID, m.ObjectAttributes.IID, &opt)
-	if err != nil {
-		return resp.Response.Request.URL.Path, err
+		AddLabels:    change.add,
+		RemoveLabels: change.remove,
 	}
-	return resp.Response.Request.URL.Path, nil
+	_, resp, err := client.MergeRequests.UpdateMergeRequest(m.Project.ID, m.ObjectAttributes.IID, &opt, options...)
+	return endpoint(resp), err
 }
 
-func (m MergeEventAdaptor) executeStatus(action Action, client *gitlab.Client) (string, error) {
+func (m MergeEventAdaptor) executeStatus(action Action, client *gitlab.Client, options ...gitlab.RequestOptionFunc) (string, error) {
 	if string(action.Status) == string(mergeRequestStateApproved) {
 		opt := gitlab.ApproveMergeRequestOptions{SHA: &m.ObjectAttributes.LastCommit.ID}
-		_, resp, err := client.MergeRequestApprovals.ApproveMergeRequest(m.Project.ID, m.ObjectAttributes.IID, &opt)
-		if err != nil {
-			return resp.Response.Request.URL.Path, err
-		}
-		return resp.Response.Request.URL.Path, nil
+		_, resp, err := client.MergeRequestApprovals.ApproveMergeRequest(m.Project.ID, m.ObjectAttributes.IID, &opt, options...)
+		return endpoint(resp), err
 	}
 	opt := gitlab.UpdateMergeRequestOptions{
 		StateEvent: (*string)(&action.Status),
 	}
-	_, resp, err := client.MergeRequests.UpdateMergeRequest(m.Project.ID, m.ObjectAttributes.IID, &opt)
-	if err != nil {
-		return resp.Response.Request.URL.Path, err
+	_, resp, err := client.MergeRequests.UpdateMergeRequest(m.Project.ID, m.ObjectAttributes.IID, &opt, options...)
+	return endpoint(resp), err
+}
+
+// assigner sets the picked users as the merge request's assignees, or its reviewers
+func (m MergeEventAdaptor) assigner(pick func() ([]int, error), reviewers bool) gitLabUpdateFn {
+	return func(action Action, client *gitlab.Client, options ...gitlab.RequestOptionFunc) (string, error) {
+		ids, err := pick()
+		if err != nil {
+			return "", err
+		}
+		opt := gitlab.UpdateMergeRequestOptions{AssigneeIDs: ids}
+		if reviewers {
+			opt = gitlab.UpdateMergeRequestOptions{ReviewerIDs: ids}
+		}
+		_, resp, err := client.MergeRequests.UpdateMergeRequest(m.Project.ID, m.ObjectAttributes.IID, &opt, options...)
+		return endpoint(resp), err
 	}
-	return resp.Response.Request.URL.Path, nil
 }
 
-func (m MergeEventAdaptor) executeNote(action Action, client *gitlab.Client) (string, error) {
+func (m MergeEventAdaptor) executeNote(action Action, client *gitlab.Client, options ...gitlab.RequestOptionFunc) (string, error) {
 	note := action.commentate()
-	_, resp, err := client.Notes.CreateMergeRequestNote(m.Project.ID, m.ObjectAttributes.IID, &gitlab.CreateMergeRequestNoteOptions{Body: &note})
-	if err != nil {
-		return resp.Response.Request.URL.Path, err
-	}
-	return resp.Response.Request.URL.Path, nil
+	_, resp, err := client.Notes.CreateMergeRequestNote(m.Project.ID, m.ObjectAttributes.IID, &gitlab.CreateMergeRequestNoteOptions{Body: &note}, options...)
+	return endpoint(resp), err
 }
@@ -122,7 +122,7 @@ func TestExecuteMethods(t *testing.T) {
 	}
 	for _, e := range execute {
 		t.Run(e.name, func(t *testing.T) {
-			got := me.execute(e.action, e.client)
+			got := me.execute(e.action, e.client, Options{})
 			if len(got) != e.expected {
 				t.Errorf(e.errMsg)
 			}
@@ -0,0 +1,191 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"regexp"
+	"strings"
+)
+
+// MergeRequestConditions are the conditions only a merge request has, they can only be used
+// by policies with the Merge Request Hook resource
+type MergeRequestConditions struct {
+	// SourceBranch is the branch being merged, a name, a glob such as `feature/*` or a regular expression between slashes
+	SourceBranch string `yaml:"sourceBranch,omitempty"`
+	// TargetBranch is the branch being merged into, in the same form as the SourceBranch
+	TargetBranch string `yaml:"targetBranch,omitempty"`
+	// Title is a regular expression the merge request's title must match
+	Title string `yaml:"title,omitempty"`
+	// Description is a regular expression the merge request's description must match
+	Description string `yaml:"description,omitempty"`
+	// Draft is whether the merge request must be, or must not be, a draft
+	Draft *bool `yaml:"draft,omitempty"`
+	// MergeStatus is GitLab's merge status of the merge request, such as `cannot_be_merged` when it has conflicts
+	MergeStatus MergeStatus `yaml:"mergeStatus,omitempty"`
+	// Fork is whether the merge request must be, or must not be, from a fork
+	Fork *bool `yaml:"fork,omitempty"`
+}
+
+// MergeStatus is whether GitLab can merge a merge request
+type MergeStatus string
+
+const (
+	mergeStatusCanBeMerged    MergeStatus = "can_be_merged"
+	mergeStatusCannotBeMerged MergeStatus = "cannot_be_merged"
+	mergeStatusUnchecked      MergeStatus = "unchecked"
+	mergeStatusChecking       MergeStatus = "checking"
+	mergeStatusRecheck        MergeStatus = "cannot_be_merged_recheck"
+)
+
+// MergeRequester provides the attributes of a merge request that MergeRequestConditions compare
+type MergeRequester interface {
+	mergeRequest() mergeRequestAttributes
+}
+
+// mergeRequestAttributes are the attributes of the webhook's merge request
+type mergeRequestAttributes struct {
+	sourceBranch string
+	targetBranch string
+	title        string
+	description  string
+	draft        bool
+	mergeStatus  string
+	fork         bool
+}
+
+// branchPattern compiles a branch name, glob or regular expression between slashes.
+// Unlike labels, branches are case-sensitive
+func branchPattern(branch string) (*regexp.Regexp, error) {
+	if len(branch) > 1 && strings.HasPrefix(branch, "/") && strings.HasSuffix(branch, "/") {
+		pattern, err := regexp.Compile(branch[1 : len(branch)-1])
+		if err != nil {
+			return nil, fmt.Errorf("branch pattern %s is not a valid regular expression: %v", branch, err)
+		}
+		return pattern, nil
+	}
+	glob := regexp.QuoteMeta(branch)
+	glob = strings.ReplaceAll(glob, `\*`, ".*")
+	glob = strings.ReplaceAll(glob, `\?`, ".")
+	return regexp.MustCompile("^" + glob + "$"), nil
+}
+
+// fields are the yaml keys of the conditions that are set
+func (mr MergeRequestConditions) fields() []string {
+	var fields []string
+	for _, field := range []struct {
+		key string
+		set bool
+	}{
+		{"sourceBranch", mr.SourceBranch != ""},
+		{"targetBranch", mr.TargetBranch != ""},
+		{"title", mr.Title != ""},
+		{"description", mr.Description != ""},
+		{"draft", mr.Draft != nil},
+		{"mergeStatus", mr.MergeStatus != ""},
+		{"fork", mr.Fork != nil},
+	} {
+		if field.set {
+			fields = append(fields, field.key)
+		}
+	}
+	return fields
+}
+
+// fieldValidator ensures the conditions are only used with merge requests
+func (mr MergeRequestConditions) fieldValidator(eventType gitlab.EventType) error {
+	if fields := mr.fields(); len(fields) > 0 && eventType != gitlab.EventTypeMergeRequest {
+		return fmt.Errorf("%s can only be used with the %s resource, not %s", strings.Join(fields, ", "), gitlab.EventTypeMergeRequest, eventType)
+	}
+	return nil
+}
+
+// fieldErrors validates each of the conditions, path is where the conditions are in the policy
+func (mr MergeRequestConditions) fieldErrors(eventType gitlab.EventType, path string) []fieldError {
+	validRegexp := func(field, expr string) error {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("%s is not a valid regular expression: %v", field, err)
+		}
+		return nil
+	}
+	validBranch := func(branch string) error {
+		_, err := branchPattern(branch)
+		return err
+	}
+	errs := []fieldError{
+		{field: path + ".sourceBranch", err: validBranch(mr.SourceBranch)},
+		{field: path + ".targetBranch", err: validBranch(mr.TargetBranch)},
+		{field: path + ".title", err: validRegexp("title", mr.Title)},
+		{field: path + ".description", err: validRegexp("description", mr.Description)},
+		{field: path + ".mergeStatus", err: mr.MergeStatus.validate()},
+	}
+	if fields := mr.fields(); len(fields) > 0 {
+		errs = append(errs, fieldError{field: path + "." + fields[0], err: mr.fieldValidator(eventType)})
+	}
+	return errs
+}
+
+// validate ensures the MergeStatus is one of GitLab's
+func (s MergeStatus) validate() error {
+	switch s {
+	case "", mergeStatusCanBeMerged, mergeStatusCannotBeMerged, mergeStatusUnchecked, mergeStatusChecking, mergeStatusRecheck:
+		return nil
+	}
+	return fmt.Errorf("mergeStatus allowed options are: `%s`, `%s`, `%s`, `%s`, `%s`. But received: %s",
+		mergeStatusCanBeMerged, mergeStatusCannotBeMerged, mergeStatusUnchecked, mergeStatusChecking, mergeStatusRecheck, s)
+}
+
+// explain traces each of the conditions that are set against the webhook's merge request
+func (mr MergeRequestConditions) explain(adaptor GitLabAdaptor) Trace {
+	fields := mr.fields()
+	if len(fields) == 0 {
+		return nil
+	}
+	requester, ok := adaptor.(MergeRequester)
+	if !ok {
+		var trace Trace
+		for _, field := range fields {
+			trace = append(trace, ConditionTrace{Condition: field, Reason: "the webhook is not a merge request"})
+		}
+		return trace
+	}
+	attributes := requester.mergeRequest()
+	var trace Trace
+	branch := func(condition, expected, actual string) {
+		pattern, err := branchPattern(expected)
+		trace = append(trace, ConditionTrace{Condition: condition, Expected: expected, Actual: actual, Passed: err == nil && pattern.MatchString(actual)})
+	}
+	text := func(condition, expected, actual string) {
+		pattern, err := regexp.Compile(expected)
+		trace = append(trace, ConditionTrace{Condition: condition, Expected: expected, Actual: actual, Passed: err == nil && pattern.MatchString(actual)})
+	}
+	flag := func(condition string, expected *bool, actual bool) {
+		trace = append(trace, ConditionTrace{Condition: condition, Expected: *expected, Actual: actual, Passed: *expected == actual})
+	}
+	if mr.SourceBranch != "" {
+		branch("sourceBranch", mr.SourceBranch, attributes.sourceBranch)
+	}
+	if mr.TargetBranch != "" {
+		branch("targetBranch", mr.TargetBranch, attributes.targetBranch)
+	}
+	if mr.Title != "" {
+		text("title", mr.Title, attributes.title)
+	}
+	if mr.Description != "" {
+		text("description", mr.Description, attributes.description)
+	}
+	if mr.Draft != nil {
+		flag("draft", mr.Draft, attributes.draft)
+	}
+	if mr.MergeStatus != "" {
+		trace = append(trace, ConditionTrace{
+			Condition: "mergeStatus",
+			Expected:  mr.MergeStatus,
+			Actual:    attributes.mergeStatus,
+			Passed:    string(mr.MergeStatus) == attributes.mergeStatus,
+		})
+	}
+	if mr.Fork != nil {
+		flag("fork", mr.Fork, attributes.fork)
+	}
+	return trace
+}
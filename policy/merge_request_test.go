@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"github.com/xanzy/go-gitlab"
+	"testing"
+)
+
+func TestMergeRequestConditionsValidate(t *testing.T) {
+	yes := true
+	mergeRequest := Resource{gitlab.EventTypeMergeRequest}
+	data := []struct {
+		name          string
+		policy        Policy
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "Branches", policy: Policy{Resource: mergeRequest, Conditions: Condition{MergeRequest: MergeRequestConditions{SourceBranch: "feature/*", TargetBranch: "/^(main|release-.+)$/"}}}, expectedIsNil: true, errMsg: "expected nil for a glob and a regular expression"},
+		{name: "Status", policy: Policy{Resource: mergeRequest, Conditions: Condition{MergeRequest: MergeRequestConditions{Draft: &yes, MergeStatus: mergeStatusCannotBeMerged, Fork: &yes}}}, expectedIsNil: true, errMsg: "expected nil for draft, merge status and fork"},
+		{name: "Invalid Branch Regex", policy: Policy{Resource: mergeRequest, Conditions: Condition{MergeRequest: MergeRequestConditions{SourceBranch: "/feature/(/"}}}, expectedIsNil: false, errMsg: "expected an error as the branch pattern doesn't compile"},
+		{name: "Invalid Title Regex", policy: Policy{Resource: mergeRequest, Conditions: Condition{MergeRequest: MergeRequestConditions{Title: "^Draft:("}}}, expectedIsNil: false, errMsg: "expected an error as the title doesn't compile"},
+		{name: "Invalid Merge Status", policy: Policy{Resource: mergeRequest, Conditions: Condition{MergeRequest: MergeRequestConditions{MergeStatus: "conflicts"}}}, expectedIsNil: false, errMsg: "expected an error as conflicts is not a merge status"},
+		{name: "Issue Hook", policy: Policy{Resource: Resource{gitlab.EventTypeIssue}, Conditions: Condition{MergeRequest: MergeRequestConditions{Title: "^Bug"}}}, expectedIsNil: false, errMsg: "expected an error as issues don't have merge request conditions"},
+		{name: "Nested in a group", policy: Policy{Resource: Resource{gitlab.EventTypeNote}, Conditions: Condition{ConditionGroups: ConditionGroups{Not: &Condition{MergeRequest: MergeRequestConditions{Draft: &yes}}}}}, expectedIsNil: false, errMsg: "expected an error as notes don't have merge request conditions"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := d.policy.Validate()
+			want := expectedIsNil(got)
+			if want != d.expectedIsNil {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestMergeRequestConditionsMatch(t *testing.T) {
+	yes, no := true, false
+	adaptor := stubMergeEventAdaptor()
+	adaptor.ObjectAttributes.SourceBranch = "feature/login"
+	adaptor.ObjectAttributes.TargetBranch = "main"
+	adaptor.ObjectAttributes.Title = "Draft: Add login"
+	adaptor.ObjectAttributes.Description = "Closes #12"
+	adaptor.ObjectAttributes.WorkInProgress = true
+	adaptor.ObjectAttributes.MergeStatus = string(mergeStatusCannotBeMerged)
+	adaptor.ObjectAttributes.SourceProjectID = 4
+	adaptor.ObjectAttributes.TargetProjectID = 1
+
+	data := []struct {
+		name       string
+		conditions MergeRequestConditions
+		expected   bool
+		errMsg     string
+	}{
+		{name: "Source Branch Glob", conditions: MergeRequestConditions{SourceBranch: "feature/*"}, expected: true, errMsg: "expected the source branch to match the glob"},
+		{name: "Branches are case-sensitive", conditions: MergeRequestConditions{SourceBranch: "Feature/*"}, expected: false, errMsg: "expected branches to be case-sensitive"},
+		{name: "Target Branch Regex", conditions: MergeRequestConditions{TargetBranch: "/^(main|master)$/"}, expected: true, errMsg: "expected the target branch to match the regular expression"},
+		{name: "Target Branch Name", conditions: MergeRequestConditions{TargetBranch: "develop"}, expected: false, errMsg: "expected develop not to match main"},
+		{name: "Title and Description", conditions: MergeRequestConditions{Title: "^Draft:", Description: `Closes #\d+`}, expected: true, errMsg: "expected the title and description to match"},
+		{name: "Draft", conditions: MergeRequestConditions{Draft: &yes}, expected: true, errMsg: "expected the merge request to be a draft"},
+		{name: "Not a Draft", conditions: MergeRequestConditions{Draft: &no}, expected: false, errMsg: "expected the draft not to match"},
+		{name: "Conflicts", conditions: MergeRequestConditions{MergeStatus: mergeStatusCannotBeMerged}, expected: true, errMsg: "expected the merge status to match"},
+		{name: "Fork", conditions: MergeRequestConditions{Fork: &yes}, expected: true, errMsg: "expected the merge request to be from a fork"},
+		{name: "Not from a Fork", conditions: MergeRequestConditions{Fork: &no, SourceBranch: "feature/*"}, expected: false, errMsg: "expected every condition to be needed"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			pol := Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{MergeRequest: d.conditions}}
+			if got := matcher(pol, adaptor, gitlab.EventTypeMergeRequest); got != d.expected {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+
+	trace := MergeRequestConditions{Draft: &yes}.explain(stubIssueEventAdaptor())
+	if len(trace) != 1 || trace.Matched() || trace[0].Reason == "" {
+		t.Errorf("expected the draft condition to fail on an issue, got %+v", trace)
+	}
+}
@@ -1,13 +1,204 @@
 package policy
 
-// Milestone represents the id of the milestone from GitLab
+import (
+	"errors"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"gopkg.in/yaml.v3"
+	"strings"
+	"time"
+)
+
+// Milestone is the milestone condition. It's written as the milestone's id, its title, or one of the
+// MilestoneStates, such as `milestone: current`. Or as a mapping of a title and state
 type Milestone struct {
-	Milestone int `yaml:"milestone"`
+	// ID is the id of the milestone, which differs between projects
+	ID int `yaml:"id,omitempty"`
+	// Title is the milestone's title, matched case-insensitively. It can also be a glob
+	// such as `v1.*` or a regular expression between slashes, as labels can
+	Title string `yaml:"title,omitempty"`
+	// State is whether the webhook has a milestone at all, or the state of its milestone
+	State MilestoneState `yaml:"state,omitempty"`
+}
+
+// MilestoneState is what's required of the webhook's milestone
+type MilestoneState string
+
+const (
+	// milestoneStateAny is met by any milestone
+	milestoneStateAny MilestoneState = "any"
+	// milestoneStateNone is met when there's no milestone
+	milestoneStateNone MilestoneState = "none"
+	// milestoneStateActive is met by a milestone that's still open
+	milestoneStateActive MilestoneState = "active"
+	// milestoneStateClosed is met by a milestone that's been closed
+	milestoneStateClosed MilestoneState = "closed"
+	// milestoneStateCurrent is met by an active milestone that has started and isn't yet due,
+	// a milestone without a start or due date hasn't got that limit
+	milestoneStateCurrent MilestoneState = "current"
+	// milestoneStateUpcoming is met by an active milestone with a start date that's still to come
+	milestoneStateUpcoming MilestoneState = "upcoming"
+)
+
+// MilestoneFinder looks up a milestone, so a Milestone condition can compare the title, state
+// and dates that a webhook doesn't include
+type MilestoneFinder interface {
+	// FindMilestone returns the milestone with the id, which belongs to the project or one of its groups
+	FindMilestone(project, id int) (*gitlab.Milestone, error)
 }
 
-func (m *Milestone) milestone() int {
-	if m == nil {
-		return 0
+// milestoneCondition is the alias used to decode the mapping form of a Milestone
+type milestoneCondition Milestone
+
+// UnmarshalYAML decodes the id, title, state or mapping form of the Milestone
+func (m *Milestone) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			switch key := value.Content[i].Value; key {
+			case "id", "title", "state":
+			default:
+				return fmt.Errorf("line %d: unknown milestone field %q", value.Content[i].Line, key)
+			}
+		}
+		return value.Decode((*milestoneCondition)(m))
 	}
-	return m.Milestone
+	if value.Tag == "!!int" {
+		return value.Decode(&m.ID)
+	}
+	var title string
+	if err := value.Decode(&title); err != nil {
+		return err
+	}
+	switch state := MilestoneState(title); state {
+	case milestoneStateAny, milestoneStateNone, milestoneStateActive, milestoneStateClosed, milestoneStateCurrent, milestoneStateUpcoming:
+		m.State = state
+	default:
+		m.Title = title
+	}
+	return nil
+}
+
+// MarshalYAML writes the Milestone in the shortest form that's read back the same way
+func (m Milestone) MarshalYAML() (interface{}, error) {
+	switch {
+	case m.Title == "" && m.State == "":
+		return m.ID, nil
+	case m.ID == 0 && m.Title == "":
+		return string(m.State), nil
+	}
+	return milestoneCondition(m), nil
+}
+
+// milestone is nil unless the Milestone sets something to compare, a milestone of 0 was
+// always treated as not caring about the webhook's milestone
+func (m *Milestone) milestone() *Milestone {
+	if m == nil || *m == (Milestone{}) {
+		return nil
+	}
+	return m
+}
+
+// String describes the Milestone, such as `title v1.* and current`
+func (m *Milestone) String() string {
+	if m.ID > 0 {
+		return fmt.Sprintf("id %d", m.ID)
+	}
+	description := ""
+	if m.Title != "" {
+		description = "title " + m.Title
+	}
+	if m.State != "" && description != "" {
+		description += " and "
+	}
+	return description + string(m.State)
+}
+
+// validate ensures the Milestone can be compared
+func (m *Milestone) validate() error {
+	if m.milestone() == nil {
+		return nil
+	}
+	if m.ID < 0 {
+		return fmt.Errorf("milestone id can't be negative but received: %d", m.ID)
+	}
+	switch m.State {
+	case "", milestoneStateAny, milestoneStateNone, milestoneStateActive, milestoneStateClosed, milestoneStateCurrent, milestoneStateUpcoming:
+	default:
+		return fmt.Errorf("milestone state allowed options are: `%s`, `%s`, `%s`, `%s`, `%s`, `%s`. But received: %s",
+			milestoneStateAny, milestoneStateNone, milestoneStateActive, milestoneStateClosed, milestoneStateCurrent, milestoneStateUpcoming, m.State)
+	}
+	if m.ID > 0 && (m.Title != "" || m.State != "") {
+		return errors.New("milestone id can't be combined with a title or state")
+	}
+	if m.Title != "" && (m.State == milestoneStateAny || m.State == milestoneStateNone) {
+		return fmt.Errorf("milestone title can't be combined with the %s state", m.State)
+	}
+	if _, err := parseLabelPattern(m.Title); err != nil {
+		return fmt.Errorf("milestone title: %v", err)
+	}
+	return nil
+}
+
+// needsLookup reports whether the milestone has to be looked up in GitLab to be matched, which is when
+// it's matched by its title or a state other than `any` or `none`
+func (m *Milestone) needsLookup() bool {
+	return m.ID == 0 && m.State != milestoneStateAny && m.State != milestoneStateNone
+}
+
+// matches compares the Milestone with the webhook's milestone, looking it up with the finder when
+// its title or dates are needed. actual is what was compared, and reason explains a failure
+func (m *Milestone) matches(adaptor GitLabAdaptor, finder MilestoneFinder, now time.Time) (passed bool, actual interface{}, reason string) {
+	id := adaptor.milestone()
+	switch {
+	case m.ID > 0:
+		return m.ID == id, id, ""
+	case m.State == milestoneStateAny:
+		return id > 0, id, ""
+	case m.State == milestoneStateNone:
+		return id == 0, id, ""
+	case id == 0:
+		return false, id, "the webhook has no milestone"
+	case finder == nil:
+		return false, id, "the milestone can't be looked up without a GitLab client"
+	}
+	found, err := finder.FindMilestone(adaptor.project(), id)
+	if err != nil {
+		return false, id, fmt.Sprintf("the milestone couldn't be looked up: %v", err)
+	}
+	actual = milestoneTrace{ID: found.ID, Title: found.Title, State: found.State, StartDate: found.StartDate, DueDate: found.DueDate}
+	if m.Title != "" {
+		lp, _ := parseLabelPattern(m.Title)
+		if !lp.matches(strings.ToLower(found.Title)) {
+			return false, actual, "the milestone's title is " + found.Title
+		}
+	}
+	if m.State != "" && !m.stateMatches(found, now) {
+		return false, actual, fmt.Sprintf("the milestone isn't %s", m.State)
+	}
+	return true, actual, ""
+}
+
+// stateMatches compares the milestone's state and its dates with the day of now
+func (m *Milestone) stateMatches(found *gitlab.Milestone, now time.Time) bool {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch m.State {
+	case milestoneStateClosed:
+		return found.State == string(milestoneStateClosed)
+	case milestoneStateCurrent:
+		started := found.StartDate == nil || !time.Time(*found.StartDate).After(today)
+		due := found.DueDate == nil || !time.Time(*found.DueDate).Before(today)
+		return found.State == string(milestoneStateActive) && started && due
+	case milestoneStateUpcoming:
+		return found.State == string(milestoneStateActive) && found.StartDate != nil && time.Time(*found.StartDate).After(today)
+	}
+	return found.State == string(milestoneStateActive)
+}
+
+// milestoneTrace is the part of a looked up milestone that's compared
+type milestoneTrace struct {
+	ID        int             `json:"id"`
+	Title     string          `json:"title"`
+	State     string          `json:"state"`
+	StartDate *gitlab.ISOTime `json:"startDate,omitempty"`
+	DueDate   *gitlab.ISOTime `json:"dueDate,omitempty"`
 }
@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"errors"
+	"github.com/xanzy/go-gitlab"
+	"gopkg.in/yaml.v3"
+	"testing"
+	"time"
+)
+
+// milestoneFinder is a MilestoneFinder for tests
+type milestoneFinder struct {
+	milestones map[int]*gitlab.Milestone
+	lookups    int
+}
+
+func (f *milestoneFinder) FindMilestone(project, id int) (*gitlab.Milestone, error) {
+	f.lookups++
+	if milestone, ok := f.milestones[id]; ok {
+		return milestone, nil
+	}
+	return nil, errors.New("404 Not Found")
+}
+
+func isoDate(year int, month time.Month, day int) *gitlab.ISOTime {
+	date := gitlab.ISOTime(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+	return &date
+}
+
+func TestMilestoneUnmarshalYAML(t *testing.T) {
+	data := []struct {
+		name     string
+		yaml     string
+		expected Milestone
+	}{
+		{name: "ID", yaml: "milestone: 5", expected: Milestone{ID: 5}},
+		{name: "Title", yaml: "milestone: v1.2", expected: Milestone{Title: "v1.2"}},
+		{name: "Quoted number as a title", yaml: `milestone: "2021"`, expected: Milestone{Title: "2021"}},
+		{name: "State", yaml: "milestone: current", expected: Milestone{State: milestoneStateCurrent}},
+		{name: "Mapping", yaml: "milestone:\n  title: v2.*\n  state: upcoming", expected: Milestone{Title: "v2.*", State: milestoneStateUpcoming}},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			var condition Condition
+			if err := yaml.Unmarshal([]byte(d.yaml), &condition); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+			if condition.Milestone == nil || *condition.Milestone != d.expected {
+				t.Errorf("expected %+v, got %+v", d.expected, condition.Milestone)
+			}
+			out, err := yaml.Marshal(condition)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+			var again Condition
+			if err = yaml.Unmarshal(out, &again); err != nil || *again.Milestone != d.expected {
+				t.Errorf("expected %s to be read back as %+v, got %+v", out, d.expected, again.Milestone)
+			}
+		})
+	}
+
+	var condition Condition
+	if err := yaml.Unmarshal([]byte("milestone:\n  titel: v1"), &condition); err == nil {
+		t.Errorf("expected an error for an unknown milestone field")
+	}
+}
+
+func TestMilestoneValidate(t *testing.T) {
+	data := []struct {
+		name          string
+		milestone     *Milestone
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "No Milestone Listed", milestone: nil, expectedIsNil: true, errMsg: "expected nil as no milestone in policy is valid"},
+		{name: "Milestone of 0", milestone: &Milestone{}, expectedIsNil: true, errMsg: "expected nil as a milestone of 0 is ignored"},
+		{name: "Title and State", milestone: &Milestone{Title: "/^v\\d+$/", State: milestoneStateClosed}, expectedIsNil: true, errMsg: "expected nil for a title with a state"},
+		{name: "Negative ID", milestone: &Milestone{ID: -1}, expectedIsNil: false, errMsg: "expected an error as the id is negative"},
+		{name: "Invalid State", milestone: &Milestone{State: "due"}, expectedIsNil: false, errMsg: "expected an error as due is not a state"},
+		{name: "ID and Title", milestone: &Milestone{ID: 2, Title: "v1"}, expectedIsNil: false, errMsg: "expected an error as the id can't be combined with a title"},
+		{name: "Title and None", milestone: &Milestone{Title: "v1", State: milestoneStateNone}, expectedIsNil: false, errMsg: "expected an error as a title can't be combined with none"},
+		{name: "Invalid Regex", milestone: &Milestone{Title: "/v(1/"}, expectedIsNil: false, errMsg: "expected an error as the title pattern doesn't compile"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := d.milestone.validate()
+			want := expectedIsNil(got)
+			if want != d.expectedIsNil {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestMilestoneMatches(t *testing.T) {
+	finder := &milestoneFinder{milestones: map[int]*gitlab.Milestone{
+		// fixedNow is 15th June 2021
+		1: {ID: 1, Title: "V1.2", State: "active", StartDate: isoDate(2021, time.June, 1), DueDate: isoDate(2021, time.June, 15)},
+		2: {ID: 2, Title: "v2.0", State: "active", StartDate: isoDate(2021, time.July, 1), DueDate: isoDate(2021, time.July, 31)},
+		3: {ID: 3, Title: "v0.9", State: "closed", DueDate: isoDate(2021, time.May, 1)},
+		4: {ID: 4, Title: "Backlog", State: "active"},
+	}}
+	withMilestone := func(id int) GitLabAdaptor {
+		adaptor := stubMergeEventAdaptor()
+		adaptor.ObjectAttributes.MilestoneID = id
+		return adaptor
+	}
+	data := []struct {
+		name      string
+		milestone Milestone
+		adaptor   GitLabAdaptor
+		finder    MilestoneFinder
+		expected  bool
+		errMsg    string
+	}{
+		{name: "Any", milestone: Milestone{State: milestoneStateAny}, adaptor: withMilestone(1), expected: true, errMsg: "expected any milestone to match"},
+		{name: "None", milestone: Milestone{State: milestoneStateNone}, adaptor: withMilestone(1), expected: false, errMsg: "expected none not to match a milestone"},
+		{name: "Title", milestone: Milestone{Title: "v1.2"}, adaptor: withMilestone(1), finder: finder, expected: true, errMsg: "expected the title to match case-insensitively"},
+		{name: "Title Glob", milestone: Milestone{Title: "v1.*"}, adaptor: withMilestone(2), finder: finder, expected: false, errMsg: "expected v2.0 not to match v1.*"},
+		{name: "Title Regex", milestone: Milestone{Title: `/^v\d\.\d$/`}, adaptor: withMilestone(3), finder: finder, expected: true, errMsg: "expected the title to match the regular expression"},
+		{name: "Current on its due date", milestone: Milestone{State: milestoneStateCurrent}, adaptor: withMilestone(1), finder: finder, expected: true, errMsg: "expected the milestone to be current on its due date"},
+		{name: "Current without dates", milestone: Milestone{State: milestoneStateCurrent}, adaptor: withMilestone(4), finder: finder, expected: true, errMsg: "expected an active milestone without dates to be current"},
+		{name: "Not yet current", milestone: Milestone{State: milestoneStateCurrent}, adaptor: withMilestone(2), finder: finder, expected: false, errMsg: "expected a milestone that hasn't started not to be current"},
+		{name: "Upcoming", milestone: Milestone{Title: "v2.*", State: milestoneStateUpcoming}, adaptor: withMilestone(2), finder: finder, expected: true, errMsg: "expected the milestone to be upcoming"},
+		{name: "Closed", milestone: Milestone{State: milestoneStateClosed}, adaptor: withMilestone(3), finder: finder, expected: true, errMsg: "expected the milestone to be closed"},
+		{name: "Without a milestone", milestone: Milestone{Title: "v1.2"}, adaptor: withMilestone(0), finder: finder, expected: false, errMsg: "expected no match without a milestone"},
+		{name: "Without a finder", milestone: Milestone{Title: "v1.2"}, adaptor: withMilestone(1), expected: false, errMsg: "expected no match when the milestone can't be looked up"},
+		{name: "Lookup fails", milestone: Milestone{Title: "v1.2"}, adaptor: withMilestone(9), finder: finder, expected: false, errMsg: "expected no match when the lookup fails"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got, _, reason := d.milestone.matches(d.adaptor, d.finder, fixedNow)
+			if got != d.expected {
+				t.Errorf(d.errMsg)
+			}
+			if !got && d.milestone.Title != "" && reason == "" {
+				t.Errorf("expected a reason for the failed lookup or title")
+			}
+		})
+	}
+}
+
+func TestExplainMilestoneLookup(t *testing.T) {
+	finder := &milestoneFinder{milestones: map[int]*gitlab.Milestone{7: {ID: 7, Title: "v3.0", State: "active"}}}
+	adaptor := stubMergeEventAdaptor()
+	adaptor.ObjectAttributes.MilestoneID = 7
+	policy := Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{Milestone: &Milestone{Title: "v3.*"}}}
+
+	trace := explain(policy, adaptor, gitlab.EventTypeMergeRequest, Options{Milestones: finder})
+	if !trace.Matched() || finder.lookups != 1 {
+		t.Fatalf("expected the milestone to be looked up once and match, got %+v", trace)
+	}
+	if actual, ok := trace[1].Actual.(milestoneTrace); !ok || actual.Title != "v3.0" {
+		t.Errorf("expected the looked up milestone to be traced, got %+v", trace[1].Actual)
+	}
+}
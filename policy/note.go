@@ -1,5 +1,11 @@
 package policy
 
+import (
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"strings"
+)
+
 // NoteType is the type of note: Commit, MergeRequest, Issue, Snippet
 type NoteType string
 
@@ -31,3 +37,99 @@ type Note struct {
 	// Command is the specified string to look for if needed.
 	Command Command `yaml:"command"`
 }
+
+// matches reports whether a comment meets the Note condition. Every property that
+// is set on the Note must be met, with a comment needing only one of the Mentions
+func (n *Note) matches(c Commenter) bool {
+	if n == nil {
+		return true
+	}
+	if n.Type != nil && *n.Type != c.noteType() {
+		return false
+	}
+	if n.Mentions != nil && !n.Mentions.mentionedIn(c.noteBody()) {
+		return false
+	}
+	if n.Command != "" && !n.Command.invokedIn(c.noteBody()) {
+		return false
+	}
+	return true
+}
+
+// mentionedIn checks whether any of the users are mentioned in the body. Users
+// can be declared with or without their leading `@`
+func (m Mentions) mentionedIn(body string) bool {
+	for _, user := range m {
+		if mentions(body, strings.TrimPrefix(user, "@")) {
+			return true
+		}
+	}
+	return false
+}
+
+// mentions checks the body for `@user`, making sure it isn't just the start of a longer username
+func mentions(body, user string) bool {
+	if user == "" {
+		return false
+	}
+	mention := "@" + user
+	for i := strings.Index(body, mention); i != -1; {
+		end := i + len(mention)
+		if end == len(body) || !isUsernameChar(body[end]) {
+			return true
+		}
+		next := strings.Index(body[end:], mention)
+		if next == -1 {
+			return false
+		}
+		i = end + next
+	}
+	return false
+}
+
+// isUsernameChar reports whether the byte could be part of a GitLab username
+func isUsernameChar(b byte) bool {
+	return b == '_' || b == '-' || b == '.' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// validate ensures the Note condition is only used on note events and has a known NoteType
+func (n *Note) validate(eventType gitlab.EventType) error {
+	if n == nil {
+		return nil
+	}
+	if eventType != gitlab.EventTypeNote && eventType != gitlab.EventConfidentialNote {
+		return fmt.Errorf("the note condition was used on an unexpected event type: %s", eventType)
+	}
+	if err := n.Command.validate(); err != nil {
+		return err
+	}
+	if n.Type == nil {
+		return nil
+	}
+	switch *n.Type {
+	case NoteCommit, NoteMergeRequest, NoteIssue, NoteSnippet:
+		return nil
+	}
+	return fmt.Errorf("available note types are `%s`, `%s`, `%s`, `%s`. But received: %s", NoteCommit, NoteMergeRequest, NoteIssue, NoteSnippet, *n.Type)
+}
+
+// action renders the arguments given to the Note's Command into the Action. When the note invoked
+// the Command but the arguments couldn't be parsed, the Action is replaced with a reply explaining its usage
+func (n *Note) action(action Action, ne NoteEventAdaptor) Action {
+	args := map[string]string{"author": ne.Author}
+	if n == nil || n.Command == "" {
+		return action.render(args)
+	}
+	parsed, err := n.Command.arguments(ne.Body)
+	if err != nil {
+		usage := Action{Comment: fmt.Sprintf("%v\n\nUsage: `%s`", err, n.Command)}
+		if ne.Author != "" {
+			usage.Mention = []string{ne.Author}
+		}
+		return usage
+	}
+	for k, v := range parsed {
+		args[k] = v
+	}
+	return action.render(args)
+}
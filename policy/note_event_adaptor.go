@@ -0,0 +1,300 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+)
+
+// NoteEventAdaptor wraps the comment events GitLab sends as a `Note Hook`.
+// go-gitlab decodes a note into one of four types depending on what was commented on,
+// so the adaptor keeps the details common to each of them along with the noteable's identifiers
+type NoteEventAdaptor struct {
+	// Type is the type of noteable that was commented on
+	Type NoteType
+	// Body is the contents of the note
+	Body string
+	// Author is the username of the user who left the note
+	Author    string
+	ProjectID int
+	// IID is the internal id of the Issue or MergeRequest that was commented on
+	IID int
+	// CommitSHA is the commit that was commented on
+	CommitSHA string
+	// SnippetID is the snippet that was commented on
+	SnippetID   int
+	State       string
+	Labels      []string
+	MilestoneID int
+	// CreatedAt and UpdatedAt are the timestamps of the Issue or MergeRequest that was commented on,
+	// commits and snippets use the timestamps of the note itself
+	CreatedAt string
+	UpdatedAt string
+	// event is the comment event the adaptor was built from
+	event interface{}
+}
+
+// MergeCommentEvent is a comment on a merge request. go-gitlab's MergeCommentEvent doesn't decode
+// the labels of the merge request, so they're decoded alongside it from `merge_request.labels`
+type MergeCommentEvent struct {
+	gitlab.MergeCommentEvent
+	MergeRequestLabels []*gitlab.Label
+}
+
+// mergeRequestLabels are the labels of a comment's merge request in its payload
+type mergeRequestLabels struct {
+	MergeRequest struct {
+		Labels []*gitlab.Label `json:"labels"`
+	} `json:"merge_request"`
+}
+
+// UnmarshalJSON decodes the comment and the labels of its merge request
+func (m *MergeCommentEvent) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.MergeCommentEvent); err != nil {
+		return err
+	}
+	var labels mergeRequestLabels
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return err
+	}
+	m.MergeRequestLabels = labels.MergeRequest.Labels
+	return nil
+}
+
+// MarshalJSON encodes the comment with the labels back in its merge request, so it decodes the same again
+func (m MergeCommentEvent) MarshalJSON() ([]byte, error) {
+	encoded, err := json.Marshal(m.MergeCommentEvent)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	var mergeRequest map[string]json.RawMessage
+	if err = json.Unmarshal(fields["merge_request"], &mergeRequest); err != nil {
+		return nil, err
+	}
+	if mergeRequest["labels"], err = json.Marshal(m.MergeRequestLabels); err != nil {
+		return nil, err
+	}
+	if fields["merge_request"], err = json.Marshal(mergeRequest); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// newNoteEventAdaptor builds a NoteEventAdaptor from any of the comment events.
+// The bool reports whether the event was a comment event
+func newNoteEventAdaptor(event interface{}) (NoteEventAdaptor, bool) {
+	switch ev := event.(type) {
+	case *gitlab.IssueCommentEvent:
+		var labels []string
+		for _, label := range ev.Issue.Labels {
+			labels = append(labels, label.Name)
+		}
+		ne := NoteEventAdaptor{
+			Type:        NoteIssue,
+			Body:        ev.ObjectAttributes.Note,
+			ProjectID:   ev.ProjectID,
+			IID:         ev.Issue.IID,
+			State:       ev.Issue.State,
+			Labels:      labels,
+			MilestoneID: ev.Issue.MilestoneID,
+			CreatedAt:   ev.Issue.CreatedAt,
+			UpdatedAt:   ev.Issue.UpdatedAt,
+		}
+		if ev.User != nil {
+			ne.Author = ev.User.Username
+		}
+		ne.event = ev
+		return ne, true
+	case *gitlab.MergeCommentEvent:
+		return newNoteEventAdaptor(&MergeCommentEvent{MergeCommentEvent: *ev})
+	case *MergeCommentEvent:
+		var labels []string
+		for _, label := range ev.MergeRequestLabels {
+			labels = append(labels, label.Name)
+		}
+		ne := NoteEventAdaptor{
+			Type:        NoteMergeRequest,
+			Body:        ev.ObjectAttributes.Note,
+			ProjectID:   ev.ProjectID,
+			IID:         ev.MergeRequest.IID,
+			State:       ev.MergeRequest.State,
+			Labels:      labels,
+			MilestoneID: ev.MergeRequest.MilestoneID,
+			CreatedAt:   ev.MergeRequest.CreatedAt,
+			UpdatedAt:   ev.MergeRequest.UpdatedAt,
+		}
+		if ev.User != nil {
+			ne.Author = ev.User.Username
+		}
+		ne.event = ev
+		return ne, true
+	case *gitlab.CommitCommentEvent:
+		ne := NoteEventAdaptor{
+			Type:      NoteCommit,
+			Body:      ev.ObjectAttributes.Note,
+			ProjectID: ev.ProjectID,
+			CommitSHA: ev.ObjectAttributes.CommitID,
+			CreatedAt: ev.ObjectAttributes.CreatedAt,
+			UpdatedAt: ev.ObjectAttributes.UpdatedAt,
+		}
+		if ev.Commit != nil {
+			ne.CommitSHA = ev.Commit.ID
+		}
+		if ev.User != nil {
+			ne.Author = ev.User.Username
+		}
+		ne.event = ev
+		return ne, true
+	case *gitlab.SnippetCommentEvent:
+		ne := NoteEventAdaptor{
+			Type:      NoteSnippet,
+			Body:      ev.ObjectAttributes.Note,
+			ProjectID: ev.ProjectID,
+			SnippetID: ev.ObjectAttributes.NoteableID,
+			CreatedAt: ev.ObjectAttributes.CreatedAt,
+			UpdatedAt: ev.ObjectAttributes.UpdatedAt,
+		}
+		if ev.Snippet != nil {
+			ne.SnippetID = ev.Snippet.ID
+		}
+		if ev.User != nil {
+			ne.Author = ev.User.Username
+		}
+		ne.event = ev
+		return ne, true
+	}
+	return NoteEventAdaptor{}, false
+}
+
+func (n NoteEventAdaptor) state() []string {
+	return []string{n.State}
+}
+
+func (n NoteEventAdaptor) labels() []string {
+	return sliceLower(n.Labels)
+}
+
+func (n NoteEventAdaptor) timestamp(attribute DateAttribute) string {
+	if attribute == updatedAt {
+		return n.UpdatedAt
+	}
+	return n.CreatedAt
+}
+
+func (n NoteEventAdaptor) payload() interface{} {
+	return n.event
+}
+
+func (n NoteEventAdaptor) triggeredBy() string {
+	return n.Author
+}
+
+func (n NoteEventAdaptor) project() int {
+	return n.ProjectID
+}
+
+// resourceKey identifies what was commented on, so a limit counts the comments on each of them together
+func (n NoteEventAdaptor) resourceKey() string {
+	switch n.Type {
+	case NoteIssue:
+		return fmt.Sprintf("issue/%d", n.IID)
+	case NoteMergeRequest:
+		return fmt.Sprintf("merge_request/%d", n.IID)
+	case NoteCommit:
+		return fmt.Sprintf("commit/%s", n.CommitSHA)
+	}
+	return fmt.Sprintf("snippet/%d", n.SnippetID)
+}
+
+func (n NoteEventAdaptor) milestone() int {
+	return n.MilestoneID
+}
+
+func (n NoteEventAdaptor) noteType() NoteType {
+	return n.Type
+}
+
+func (n NoteEventAdaptor) noteBody() string {
+	return n.Body
+}
+
+// prepare updates goes through the action list and determines what update requests are required.
+// Only Issues and MergeRequests can have their labels updated and users assigned.
+func (n NoteEventAdaptor) prepareUpdates(action Preparer, opts Options) []update {
+	var executables []update
+	if action.updateLabels() && (n.Type == NoteIssue || n.Type == NoteMergeRequest) {
+		change := action.labelChange(n.Labels)
+		executables = append(executables, update{kind: updateKindLabels, fn: n.executeLabels, labels: &change})
+	}
+	if action.addNote() {
+		executables = append(executables, update{kind: updateKindNote, fn: n.executeNote})
+	}
+	if assign := action.assign(); assign != nil && (n.Type == NoteIssue || n.Type == NoteMergeRequest) {
+		var assigned []string
+		fn := n.assigner(assign.picker("assign", false, 0, opts, &assigned))
+		executables = append(executables, update{kind: updateKindAssignees, fn: fn, assigned: &assigned})
+	}
+	return executables
+}
+
+func (n NoteEventAdaptor) execute(action Action, client *gitlab.Client, opts Options) []GitLabUpdateResult {
+	return executeUpdates(n.prepareUpdates(action, opts), action, client, opts)
+}
+
+// executeLabels adds and removes the labels in one request, so a scoped label and the label it replaces change together
+func (n NoteEventAdaptor) executeLabels(action Action, client *gitlab.Client, options ...gitlab.RequestOptionFunc) (string, error) {
+	change := action.labelChange(n.Labels)
+	if n.Type == NoteIssue {
+		opt := gitlab.UpdateIssueOptions{
+			AddLabels:    change.add,
+			RemoveLabels: change.remove,
+		}
+		_, resp, err := client.Issues.UpdateIssue(n.ProjectID, n.IID, &opt, options...)
+		return endpoint(resp), err
+	}
+	opt := gitlab.UpdateMergeRequestOptions{
+		AddLabels:    change.add,
+		RemoveLabels: change.remove,
+	}
+	_, resp, err := client.MergeRequests.UpdateMergeRequest(n.ProjectID, n.IID, &opt, options...)
+	return endpoint(resp), err
+}
+
+// assigner assigns the picked users to the issue or merge request that was commented on
+func (n NoteEventAdaptor) assigner(pick func() ([]int, error)) gitLabUpdateFn {
+	return func(action Action, client *gitlab.Client, options ...gitlab.RequestOptionFunc) (string, error) {
+		ids, err := pick()
+		if err != nil {
+			return "", err
+		}
+		var resp *gitlab.Response
+		if n.Type == NoteIssue {
+			_, resp, err = client.Issues.UpdateIssue(n.ProjectID, n.IID, &gitlab.UpdateIssueOptions{AssigneeIDs: ids}, options...)
+		} else {
+			_, resp, err = client.MergeRequests.UpdateMergeRequest(n.ProjectID, n.IID, &gitlab.UpdateMergeRequestOptions{AssigneeIDs: ids}, options...)
+		}
+		return endpoint(resp), err
+	}
+}
+
+// executeNote replies on the noteable that was commented on
+func (n NoteEventAdaptor) executeNote(action Action, client *gitlab.Client, options ...gitlab.RequestOptionFunc) (string, error) {
+	note := action.commentate()
+	var resp *gitlab.Response
+	var err error
+	switch n.Type {
+	case NoteIssue:
+		_, resp, err = client.Notes.CreateIssueNote(n.ProjectID, n.IID, &gitlab.CreateIssueNoteOptions{Body: &note}, options...)
+	case NoteMergeRequest:
+		_, resp, err = client.Notes.CreateMergeRequestNote(n.ProjectID, n.IID, &gitlab.CreateMergeRequestNoteOptions{Body: &note}, options...)
+	case NoteCommit:
+		_, resp, err = client.Commits.PostCommitComment(n.ProjectID, n.CommitSHA, &gitlab.PostCommitCommentOptions{Note: &note}, options...)
+	case NoteSnippet:
+		_, resp, err = client.Notes.CreateSnippetNote(n.ProjectID, n.SnippetID, &gitlab.CreateSnippetNoteOptions{Body: &note}, options...)
+	}
+	return endpoint(resp), err
+}
@@ -0,0 +1,147 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNewNoteEventAdaptor(t *testing.T) {
+	issueNote := &gitlab.IssueCommentEvent{ProjectID: 1}
+	issueNote.Issue.IID = 3
+	issueNote.Issue.Labels = []gitlab.Label{{Name: "Bug"}}
+	mergeNote := &gitlab.MergeCommentEvent{ProjectID: 1}
+	mergeNote.MergeRequest.IID = 4
+	commitNote := &gitlab.CommitCommentEvent{ProjectID: 1}
+	commitNote.ObjectAttributes.CommitID = "abc123"
+	snippetNote := &gitlab.SnippetCommentEvent{ProjectID: 1, Snippet: &gitlab.Snippet{ID: 5}}
+
+	data := []struct {
+		name     string
+		event    interface{}
+		ok       bool
+		expected NoteType
+	}{
+		{name: "Issue note", event: issueNote, ok: true, expected: NoteIssue},
+		{name: "Merge Request note", event: mergeNote, ok: true, expected: NoteMergeRequest},
+		{name: "Commit note", event: commitNote, ok: true, expected: NoteCommit},
+		{name: "Snippet note", event: snippetNote, ok: true, expected: NoteSnippet},
+		{name: "Not a note", event: &gitlab.MergeEvent{}, ok: false, expected: ""},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got, ok := newNoteEventAdaptor(d.event)
+			if ok != d.ok {
+				t.Errorf("expected ok to be %t but got %t", d.ok, ok)
+			}
+			if got.noteType() != d.expected {
+				t.Errorf("expected note type %s but got %s", d.expected, got.noteType())
+			}
+		})
+	}
+
+	t.Run("Issue labels are carried over", func(t *testing.T) {
+		got, _ := newNoteEventAdaptor(issueNote)
+		if len(got.labels()) != 1 || got.labels()[0] != "bug" {
+			t.Errorf("expected the issue's labels to be on the adaptor, got %v", got.labels())
+		}
+	})
+
+	t.Run("Merge request labels are carried over", func(t *testing.T) {
+		payload := []byte(`{"object_kind":"note","project_id":1,"object_attributes":{"note":"lgtm","noteable_type":"MergeRequest"},"merge_request":{"iid":4,"labels":[{"title":"Bug"}]}}`)
+		event, err := ParseWebhook(gitlab.EventTypeNote, payload)
+		if err != nil {
+			t.Fatalf("failed to parse webhook: %v", err)
+		}
+		got, _ := newNoteEventAdaptor(event)
+		if got.IID != 4 || !reflect.DeepEqual(got.labels(), []string{"bug"}) {
+			t.Errorf("expected the merge request's labels to be on the adaptor, got %v", got.labels())
+		}
+
+		// dead letters keep the event encoded, so the labels must survive being encoded again
+		encoded, err := json.Marshal(event)
+		if err != nil {
+			t.Fatalf("failed to encode event: %v", err)
+		}
+		if event, err = ParseWebhook(gitlab.EventTypeNote, encoded); err != nil {
+			t.Fatalf("failed to parse encoded webhook: %v", err)
+		}
+		if got, _ = newNoteEventAdaptor(event); !reflect.DeepEqual(got.labels(), []string{"bug"}) {
+			t.Errorf("expected the labels to be kept once encoded, got %v", got.labels())
+		}
+	})
+}
+
+func TestNoteEventPrepareUpdate(t *testing.T) {
+	action := Action{Labels: Labels{[]string{"added"}}, Comment: "noted"}
+	data := []struct {
+		name     string
+		adaptor  NoteEventAdaptor
+		expected int
+		errMsg   string
+	}{
+		{name: "Issue note can update labels", adaptor: NoteEventAdaptor{Type: NoteIssue}, expected: 2, errMsg: "expected %d funcs to be stacked, but got %d"},
+		{name: "Commit note can only reply", adaptor: NoteEventAdaptor{Type: NoteCommit}, expected: 1, errMsg: "expected %d funcs to be stacked as commits have no labels, but got %d"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := d.adaptor.prepareUpdates(action, Options{})
+			if len(got) != d.expected {
+				t.Errorf(d.errMsg, d.expected, len(got))
+			}
+		})
+	}
+}
+
+func TestNoteExecuteMethods(t *testing.T) {
+	mux, server, client := setup(t)
+	defer teardown(server)
+
+	action := Action{Mention: []string{"jonny"}, Comment: "thanks for the note"}
+	encode := func(v interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(v); err != nil {
+				t.Errorf("failed to encode response")
+			}
+		}
+	}
+
+	issueEndpoint := fmt.Sprintf("/api/v4/projects/%d/issues/%d/notes", 1, 3)
+	mergeEndpoint := fmt.Sprintf("/api/v4/projects/%d/merge_requests/%d/notes", 1, 4)
+	commitEndpoint := fmt.Sprintf("/api/v4/projects/%d/repository/commits/%s/comments", 1, "abc123")
+	snippetEndpoint := fmt.Sprintf("/api/v4/projects/%d/snippets/%d/notes", 1, 5)
+	mergeLabelEndpoint := fmt.Sprintf("/api/v4/projects/%d/merge_requests/%d", 1, 4)
+	mux.HandleFunc(issueEndpoint, encode(&gitlab.Note{}))
+	mux.HandleFunc(mergeEndpoint, encode(&gitlab.Note{}))
+	mux.HandleFunc(commitEndpoint, encode(&gitlab.CommitComment{}))
+	mux.HandleFunc(snippetEndpoint, encode(&gitlab.Note{}))
+	mux.HandleFunc(mergeLabelEndpoint, encode(&gitlab.MergeRequest{}))
+
+	data := []struct {
+		name     string
+		updateFn gitLabUpdateFn
+		expected string
+		errMsg   string
+	}{
+		{name: "Reply to Issue", updateFn: NoteEventAdaptor{Type: NoteIssue, ProjectID: 1, IID: 3}.executeNote, expected: issueEndpoint, errMsg: "expected endpoint to be %s but got %s"},
+		{name: "Reply to Merge Request", updateFn: NoteEventAdaptor{Type: NoteMergeRequest, ProjectID: 1, IID: 4}.executeNote, expected: mergeEndpoint, errMsg: "expected endpoint to be %s but got %s"},
+		{name: "Reply to Commit", updateFn: NoteEventAdaptor{Type: NoteCommit, ProjectID: 1, CommitSHA: "abc123"}.executeNote, expected: commitEndpoint, errMsg: "expected endpoint to be %s but got %s"},
+		{name: "Reply to Snippet", updateFn: NoteEventAdaptor{Type: NoteSnippet, ProjectID: 1, SnippetID: 5}.executeNote, expected: snippetEndpoint, errMsg: "expected endpoint to be %s but got %s"},
+		{name: "Label Merge Request", updateFn: NoteEventAdaptor{Type: NoteMergeRequest, ProjectID: 1, IID: 4}.executeLabels, expected: mergeLabelEndpoint, errMsg: "expected endpoint to be %s but got %s"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got, err := d.updateFn(action, client)
+			if err != nil {
+				t.Errorf("expected no error to occur in mock request: %v", err)
+			}
+			if got != d.expected {
+				t.Errorf(d.errMsg, d.expected, got)
+			}
+		})
+	}
+}
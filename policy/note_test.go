@@ -1,8 +1,115 @@
 package policy
 
 import (
+	"github.com/xanzy/go-gitlab"
+	"strings"
 	"testing"
 )
 
 func TestNote(t *testing.T) {
+	issue := NoteIssue
+	commit := NoteCommit
+	adaptor := NoteEventAdaptor{Type: NoteIssue, Body: "@quetzal show -help please"}
+
+	data := []struct {
+		name     string
+		note     *Note
+		expected bool
+		errMsg   string
+	}{
+		{name: "No Note condition", note: nil, expected: true, errMsg: "expected true as the policy has no note condition"},
+		{name: "Matching NoteType", note: &Note{Type: &issue}, expected: true, errMsg: "expected true as the note is on an issue"},
+		{name: "Unmatched NoteType", note: &Note{Type: &commit}, expected: false, errMsg: "expected false as the note is not on a commit"},
+		{name: "Matching Mention", note: &Note{Mentions: Mentions{"someone", "quetzal"}}, expected: true, errMsg: "expected true as one of the mentions is in the note"},
+		{name: "Matching Mention with @", note: &Note{Mentions: Mentions{"@quetzal"}}, expected: true, errMsg: "expected true as mentions can be declared with an @"},
+		{name: "Unmatched Mention", note: &Note{Mentions: Mentions{"quetz"}}, expected: false, errMsg: "expected false as a partial username is not a mention"},
+		{name: "Matching Command", note: &Note{Command: "show -help"}, expected: true, errMsg: "expected true as the command is in the note"},
+		{name: "Unmatched Command", note: &Note{Command: "show -version"}, expected: false, errMsg: "expected false as the command is not in the note"},
+		{name: "Matching everything", note: &Note{Type: &issue, Mentions: Mentions{"quetzal"}, Command: "show -help"}, expected: true, errMsg: "expected true as all properties are met"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if d.note.matches(adaptor) != d.expected {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestMentions(t *testing.T) {
+	data := []struct {
+		name     string
+		body     string
+		user     string
+		expected bool
+	}{
+		{name: "Mention at end", body: "thanks @jonny7", user: "jonny7", expected: true},
+		{name: "Mention with punctuation", body: "@jonny7, could you look", user: "jonny7", expected: true},
+		{name: "Longer username", body: "@jonny77 could you look", user: "jonny7", expected: false},
+		{name: "Longer username then mention", body: "@jonny77 and @jonny7", user: "jonny7", expected: true},
+		{name: "No mention", body: "jonny7 could you look", user: "jonny7", expected: false},
+		{name: "Empty user", body: "@ could you look", user: "", expected: false},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if got := mentions(d.body, d.user); got != d.expected {
+				t.Errorf("expected %t but got %t", d.expected, got)
+			}
+		})
+	}
+}
+
+func TestNoteValidate(t *testing.T) {
+	snippet := NoteSnippet
+	invalid := NoteType("Epic")
+	data := []struct {
+		name          string
+		note          *Note
+		eventType     gitlab.EventType
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "No Note", note: nil, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: true, errMsg: "expected nil as there is no note condition"},
+		{name: "Note on Note Hook", note: &Note{Command: "help"}, eventType: gitlab.EventTypeNote, expectedIsNil: true, errMsg: "expected nil as notes are valid on Note Hooks"},
+		{name: "Note on Merge Request Hook", note: &Note{Command: "help"}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as notes are only valid on Note Hooks"},
+		{name: "Valid NoteType", note: &Note{Type: &snippet}, eventType: gitlab.EventConfidentialNote, expectedIsNil: true, errMsg: "expected nil as Snippet is a valid note type"},
+		{name: "Invalid NoteType", note: &Note{Type: &invalid}, eventType: gitlab.EventTypeNote, expectedIsNil: false, errMsg: "expected an error as Epic is not a valid note type"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := d.note.validate(d.eventType)
+			want := expectedIsNil(got)
+			if want != d.expectedIsNil {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestNoteAction(t *testing.T) {
+	action := Action{Labels: Labels{[]string{"{{name}}"}}, Comment: "added {{name}} for {{author}}"}
+	note := &Note{Command: "@quetzal label add <name>"}
+
+	t.Run("Arguments are rendered", func(t *testing.T) {
+		got := note.action(action, NoteEventAdaptor{Author: "jonny7", Body: "@quetzal label add bug"})
+		if got.Labels.Labels[0] != "bug" || got.Comment != "added bug for jonny7" {
+			t.Errorf("expected the arguments to be rendered, got %v", got)
+		}
+	})
+	t.Run("Usage reply when arguments don't parse", func(t *testing.T) {
+		got := note.action(action, NoteEventAdaptor{Author: "jonny7", Body: "@quetzal label add"})
+		if got.updateLabels() {
+			t.Errorf("expected labels not to be updated when arguments are missing")
+		}
+		if got.Mention[0] != "jonny7" || !strings.Contains(got.Comment, "Usage: `@quetzal label add <name>`") {
+			t.Errorf("expected a usage reply to the author, got %v", got)
+		}
+	})
+	t.Run("No command still renders the author", func(t *testing.T) {
+		var empty *Note
+		got := empty.action(Action{Comment: "thanks {{author}}"}, NoteEventAdaptor{Author: "jonny7"})
+		if got.Comment != "thanks jonny7" {
+			t.Errorf("expected author to be rendered, got %s", got.Comment)
+		}
+	})
 }
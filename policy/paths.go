@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"regexp"
+	"strings"
+)
+
+// Paths is the condition on the files a merge request changes, such as only `docs/**`.
+// A changed file is matched when it matches one of the Include globs, or there are none,
+// and none of the Exclude globs
+type Paths struct {
+	// Include are globs of the files that are matched, `*` matches within a directory and `**` across directories
+	Include []string `yaml:"include,omitempty"`
+	// Exclude are globs of the files that aren't matched, even when they're included
+	Exclude []string `yaml:"exclude,omitempty"`
+	// Match is `any` when at least one changed file must be matched, or `all` when every one must be.
+	// It's `any` by default
+	Match PathMatch `yaml:"match,omitempty"`
+}
+
+// PathMatch is how many of the changed files must be matched by Paths
+type PathMatch string
+
+const (
+	pathMatchAny PathMatch = "any"
+	pathMatchAll PathMatch = "all"
+)
+
+// ChangeFinder looks up the files changed by a merge request, sha is the merge request's
+// latest commit so the changes of each push can be told apart. Diffs looks up the merge
+// request with the diff of each of its changes
+type ChangeFinder interface {
+	ChangedPaths(project, mergeRequest int, sha string) ([]string, error)
+	Diffs(project, mergeRequest int) (*gitlab.MergeRequest, error)
+}
+
+// PathChanger provides the files changed by a webhook's merge request
+type PathChanger interface {
+	changedPaths(finder ChangeFinder) ([]string, error)
+}
+
+// pathGlob compiles a glob of a file path. `**/` matches any number of directories,
+// `**` anything, `*` anything but a `/` and `?` a single character other than `/`
+func pathGlob(glob string) (*regexp.Regexp, error) {
+	if glob == "" {
+		return nil, errors.New("path globs can't be empty")
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			expr.WriteString("[^/]*")
+		case glob[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// pathGlobs compiles each of the globs, stopping at the first that isn't valid
+func pathGlobs(globs []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(globs))
+	for _, glob := range globs {
+		pattern, err := pathGlob(glob)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, pattern)
+	}
+	return compiled, nil
+}
+
+func (p *Paths) match() PathMatch {
+	if p.Match == "" {
+		return pathMatchAny
+	}
+	return p.Match
+}
+
+// fieldValidator ensures the Paths are only used with merge requests, and can be matched
+func (p *Paths) fieldValidator(eventType gitlab.EventType) error {
+	if p == nil {
+		return nil
+	}
+	if eventType != gitlab.EventTypeMergeRequest {
+		return fmt.Errorf("paths can only be used with the %s resource, not %s", gitlab.EventTypeMergeRequest, eventType)
+	}
+	if len(p.Include) == 0 && len(p.Exclude) == 0 {
+		return errors.New("paths must include or exclude at least one glob")
+	}
+	switch p.Match {
+	case "", pathMatchAny, pathMatchAll:
+	default:
+		return fmt.Errorf("paths match allowed options are: `%s`, `%s`. But received: %s", pathMatchAny, pathMatchAll, p.Match)
+	}
+	if _, err := pathGlobs(append(append([]string{}, p.Include...), p.Exclude...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// matches compares the changed files with the Paths, the reason explains which file made them fail
+func (p *Paths) matches(changed []string) (bool, string) {
+	include, _ := pathGlobs(p.Include)
+	exclude, _ := pathGlobs(p.Exclude)
+	matchesAny := func(patterns []*regexp.Regexp, path string) bool {
+		for _, pattern := range patterns {
+			if pattern.MatchString(path) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(changed) == 0 {
+		return false, "the merge request has no changes"
+	}
+	for _, path := range changed {
+		matched := (len(include) == 0 || matchesAny(include, path)) && !matchesAny(exclude, path)
+		switch {
+		case matched && p.match() == pathMatchAny:
+			return true, ""
+		case !matched && p.match() == pathMatchAll:
+			return false, "the changed file " + path + " isn't matched"
+		}
+	}
+	if p.match() == pathMatchAll {
+		return true, ""
+	}
+	return false, "none of the changed files are matched"
+}
+
+// explain looks up the files the webhook's merge request changed and compares them with the Paths
+func (p *Paths) explain(adaptor GitLabAdaptor, finder ChangeFinder) ConditionTrace {
+	condition := ConditionTrace{Condition: "paths", Expected: p}
+	changer, ok := adaptor.(PathChanger)
+	switch {
+	case !ok:
+		condition.Reason = "the webhook is not a merge request"
+		return condition
+	case finder == nil:
+		condition.Reason = "the changed files can't be looked up without a GitLab client"
+		return condition
+	}
+	changed, err := changer.changedPaths(finder)
+	if err != nil {
+		condition.Reason = fmt.Sprintf("the changed files couldn't be looked up: %v", err)
+		return condition
+	}
+	condition.Actual = changed
+	condition.Passed, condition.Reason = p.matches(changed)
+	return condition
+}
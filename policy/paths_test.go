@@ -0,0 +1,127 @@
+package policy
+
+import (
+	"errors"
+	"github.com/xanzy/go-gitlab"
+	"testing"
+)
+
+// changeFinder is a ChangeFinder for tests
+type changeFinder struct {
+	paths []string
+	diffs *gitlab.MergeRequest
+	err   error
+	sha   string
+}
+
+func (f *changeFinder) ChangedPaths(project, mergeRequest int, sha string) ([]string, error) {
+	f.sha = sha
+	return f.paths, f.err
+}
+
+func (f *changeFinder) Diffs(project, mergeRequest int) (*gitlab.MergeRequest, error) {
+	return f.diffs, f.err
+}
+
+func TestPathGlob(t *testing.T) {
+	data := []struct {
+		glob     string
+		path     string
+		expected bool
+	}{
+		{glob: "docs/**", path: "docs/guide/install.md", expected: true},
+		{glob: "docs/*", path: "docs/guide/install.md", expected: false},
+		{glob: "docs/*.md", path: "docs/README.md", expected: true},
+		{glob: "**/*.md", path: "README.md", expected: true},
+		{glob: "**/*.md", path: "cmd/quetzal/README.md", expected: true},
+		{glob: "db/migrations/**", path: "db/migrations_test.go", expected: false},
+		{glob: "v?.go", path: "v1.go", expected: true},
+		{glob: "main.go", path: "cmd/main.go", expected: false},
+	}
+	for _, d := range data {
+		t.Run(d.glob+" "+d.path, func(t *testing.T) {
+			pattern, err := pathGlob(d.glob)
+			if err != nil {
+				t.Fatalf("failed to compile %s: %v", d.glob, err)
+			}
+			if got := pattern.MatchString(d.path); got != d.expected {
+				t.Errorf("expected %s matching %s to be %v", d.glob, d.path, d.expected)
+			}
+		})
+	}
+}
+
+func TestPathsValidate(t *testing.T) {
+	data := []struct {
+		name          string
+		paths         *Paths
+		eventType     gitlab.EventType
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "No Paths Listed", paths: nil, eventType: gitlab.EventTypeIssue, expectedIsNil: true, errMsg: "expected nil as no paths in policy is valid"},
+		{name: "Valid Paths", paths: &Paths{Include: []string{"docs/**"}, Exclude: []string{"docs/internal/**"}, Match: pathMatchAll}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: true, errMsg: "expected nil for valid paths"},
+		{name: "Issue Hook", paths: &Paths{Include: []string{"docs/**"}}, eventType: gitlab.EventTypeIssue, expectedIsNil: false, errMsg: "expected an error as issues don't change files"},
+		{name: "No Globs", paths: &Paths{Match: pathMatchAll}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error without any globs"},
+		{name: "Empty Glob", paths: &Paths{Include: []string{""}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error for an empty glob"},
+		{name: "Invalid Match", paths: &Paths{Include: []string{"docs/**"}, Match: "none"}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as none is not a match"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := d.paths.fieldValidator(d.eventType)
+			want := expectedIsNil(got)
+			if want != d.expectedIsNil {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestPathsMatches(t *testing.T) {
+	docsOnly := []string{"docs/index.md", "docs/guide/install.md"}
+	mixed := []string{"docs/index.md", "db/migrations/001_users.sql", "main.go"}
+	data := []struct {
+		name     string
+		paths    Paths
+		changed  []string
+		expected bool
+		errMsg   string
+	}{
+		{name: "Only docs changed", paths: Paths{Include: []string{"docs/**"}, Match: pathMatchAll}, changed: docsOnly, expected: true, errMsg: "expected every file to be in docs"},
+		{name: "Not only docs changed", paths: Paths{Include: []string{"docs/**"}, Match: pathMatchAll}, changed: mixed, expected: false, errMsg: "expected main.go not to be in docs"},
+		{name: "A migration changed", paths: Paths{Include: []string{"db/migrations/**"}}, changed: mixed, expected: true, errMsg: "expected the migration to match"},
+		{name: "No migration changed", paths: Paths{Include: []string{"db/migrations/**"}}, changed: docsOnly, expected: false, errMsg: "expected no file to match"},
+		{name: "Excluded", paths: Paths{Include: []string{"docs/**"}, Exclude: []string{"docs/guide/**"}, Match: pathMatchAll}, changed: docsOnly, expected: false, errMsg: "expected the excluded file to fail all"},
+		{name: "Only Exclude", paths: Paths{Exclude: []string{"**/*.md"}}, changed: mixed, expected: true, errMsg: "expected a file other than markdown to match"},
+		{name: "No changes", paths: Paths{Exclude: []string{"**/*.md"}, Match: pathMatchAll}, changed: nil, expected: false, errMsg: "expected no match without changes"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got, reason := d.paths.matches(d.changed)
+			if got != d.expected {
+				t.Errorf(d.errMsg)
+			}
+			if !got && reason == "" {
+				t.Errorf("expected a reason when the paths don't match")
+			}
+		})
+	}
+}
+
+func TestExplainPaths(t *testing.T) {
+	adaptor := stubMergeEventAdaptor()
+	adaptor.ObjectAttributes.LastCommit.ID = "da1560886d4f094c3e6c9ef40349f7d38b5d27d7"
+	pol := Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{Paths: &Paths{Include: []string{"docs/**"}}}}
+
+	finder := &changeFinder{paths: []string{"docs/index.md"}}
+	if trace := explain(pol, adaptor, gitlab.EventTypeMergeRequest, Options{Changes: finder}); !trace.Matched() || finder.sha != adaptor.ObjectAttributes.LastCommit.ID {
+		t.Errorf("expected the changes of the latest commit to match, got %+v", trace)
+	}
+	failing := &changeFinder{err: errors.New("403 Forbidden")}
+	if trace := explain(pol, adaptor, gitlab.EventTypeMergeRequest, Options{Changes: failing}); trace.Matched() || trace[1].Reason == "" {
+		t.Errorf("expected the failed lookup to be explained, got %+v", trace)
+	}
+	if trace := explain(pol, adaptor, gitlab.EventTypeMergeRequest, Options{}); trace.Matched() {
+		t.Errorf("expected paths not to match without a change finder")
+	}
+}
@@ -0,0 +1,237 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"strings"
+)
+
+// PeopleConditions are the conditions on who is involved with an issue or merge request
+type PeopleConditions struct {
+	// Author is who opened the issue or merge request
+	Author *Author `yaml:"author,omitempty"`
+	// Assignee is the username of a user who must be assigned
+	Assignee string `yaml:"assignee,omitempty"`
+	// Assignees is whether there must be `any` assignees or `none`
+	Assignees Presence `yaml:"assignees,omitempty"`
+	// Reviewers is whether a merge request must have `any` reviewers or `none`
+	Reviewers Presence `yaml:"reviewers,omitempty"`
+}
+
+// Author matches the author of an issue or merge request by their username or group
+type Author struct {
+	// Include are the usernames the author must have one of, matched case-insensitively.
+	// Like labels they can also be globs such as `*-bot` or regular expressions between slashes
+	Include []string `yaml:"include,omitempty"`
+	// Exclude are the usernames the author mustn't have, in the same form as Include
+	Exclude []string `yaml:"exclude,omitempty"`
+	// Group is the full path of a group the author must be a member of, including through a parent group
+	Group string `yaml:"group,omitempty"`
+}
+
+// Presence is whether there must be any or none of something
+type Presence string
+
+const (
+	presenceAny  Presence = "any"
+	presenceNone Presence = "none"
+)
+
+// UserFinder looks up the details of users that the webhooks don't include, and the users that actions assign
+type UserFinder interface {
+	// Username returns the username of the user with the id
+	Username(id int) (string, error)
+	// InGroup reports whether the user with the id is a member of the group, directly or through a parent group
+	InGroup(group string, id int) (bool, error)
+	// Reviewers returns the usernames of the merge request's reviewers
+	Reviewers(project, mergeRequest int) ([]string, error)
+	// UserID returns the id of the user with the username
+	UserID(username string) (int, error)
+	// OpenMergeRequests counts the open merge requests the user with the id is assigned to, or reviewing
+	OpenMergeRequests(id int, reviewing bool) (int, error)
+}
+
+// Participant provides the people involved with the webhook's issue or merge request
+type Participant interface {
+	authorID() int
+	// knownAuthor is the username of the author when the webhook includes it, which is when they triggered it
+	knownAuthor() (string, bool)
+	assignees() []string
+}
+
+// Reviewed provides the reviewers of the webhook's merge request
+type Reviewed interface {
+	reviewers(finder UserFinder) ([]string, error)
+}
+
+// validate ensures the Presence is one of its options
+func (p Presence) validate(field string) error {
+	switch p {
+	case "", presenceAny, presenceNone:
+		return nil
+	}
+	return fmt.Errorf("%s allowed options are: `%s`, `%s`. But received: %s", field, presenceAny, presenceNone, p)
+}
+
+// matches compares the Presence with the number of people
+func (p Presence) matches(people []string) bool {
+	if p == presenceNone {
+		return len(people) == 0
+	}
+	return len(people) > 0
+}
+
+// validate ensures the Author has something to match, and its usernames compile
+func (a *Author) validate() error {
+	if a == nil {
+		return nil
+	}
+	if len(a.Include) == 0 && len(a.Exclude) == 0 && a.Group == "" {
+		return errors.New("author must have usernames to include or exclude, or a group")
+	}
+	if err := validateLabelPatterns(a.Include); err != nil {
+		return err
+	}
+	return validateLabelPatterns(a.Exclude)
+}
+
+// fieldErrors validates each of the conditions, path is where the conditions are in the policy.
+// Reviewers are only on merge requests, the rest are on both issues and merge requests
+func (pc PeopleConditions) fieldErrors(eventType gitlab.EventType, path string) []fieldError {
+	errs := []fieldError{
+		{field: path + ".author", err: pc.Author.validate()},
+		{field: path + ".assignees", err: pc.Assignees.validate("assignees")},
+		{field: path + ".reviewers", err: pc.Reviewers.validate("reviewers")},
+	}
+	issueOrMergeRequest := eventType == gitlab.EventTypeMergeRequest || eventType == gitlab.EventTypeIssue || eventType == gitlab.EventConfidentialIssue
+	for _, field := range []struct {
+		key string
+		set bool
+	}{{"author", pc.Author != nil}, {"assignee", pc.Assignee != ""}, {"assignees", pc.Assignees != ""}} {
+		if field.set && !issueOrMergeRequest {
+			errs = append(errs, fieldError{field: path + "." + field.key, err: fmt.Errorf("%s can only be used with issues and merge requests, not %s", field.key, eventType)})
+		}
+	}
+	if pc.Reviewers != "" && eventType != gitlab.EventTypeMergeRequest {
+		errs = append(errs, fieldError{field: path + ".reviewers", err: fmt.Errorf("reviewers can only be used with the %s resource, not %s", gitlab.EventTypeMergeRequest, eventType)})
+	}
+	return errs
+}
+
+// explain traces each of the conditions that are set, looking up what the webhook doesn't include with the finder.
+// When skipLookups is set, the conditions that need a lookup aren't evaluated
+func (pc PeopleConditions) explain(adaptor GitLabAdaptor, finder UserFinder, skipLookups bool) Trace {
+	var trace Trace
+	if pc.Author != nil {
+		if skipLookups && pc.Author.needsLookup(adaptor) {
+			trace = append(trace, ConditionTrace{Condition: "author", Expected: pc.Author, Reason: notEvaluated})
+		} else {
+			trace = append(trace, pc.Author.explain(adaptor, finder))
+		}
+	}
+	participant, ok := adaptor.(Participant)
+	if pc.Assignee != "" {
+		condition := ConditionTrace{Condition: "assignee", Expected: pc.Assignee}
+		if ok {
+			condition.Actual = participant.assignees()
+			condition.Passed = containsFold(participant.assignees(), strings.TrimPrefix(pc.Assignee, "@"))
+		} else {
+			condition.Reason = "the webhook is not an issue or merge request"
+		}
+		trace = append(trace, condition)
+	}
+	if pc.Assignees != "" {
+		condition := ConditionTrace{Condition: "assignees", Expected: pc.Assignees}
+		if ok {
+			condition.Actual = participant.assignees()
+			condition.Passed = pc.Assignees.matches(participant.assignees())
+		} else {
+			condition.Reason = "the webhook is not an issue or merge request"
+		}
+		trace = append(trace, condition)
+	}
+	if pc.Reviewers != "" {
+		condition := ConditionTrace{Condition: "reviewers", Expected: pc.Reviewers}
+		reviewed, isMergeRequest := adaptor.(Reviewed)
+		switch {
+		case !isMergeRequest:
+			condition.Reason = "the webhook is not a merge request"
+		case skipLookups:
+			condition.Reason = notEvaluated
+		case finder == nil:
+			condition.Reason = "the reviewers can't be looked up without a GitLab client"
+		default:
+			reviewers, err := reviewed.reviewers(finder)
+			condition.Actual = reviewers
+			condition.Passed = err == nil && pc.Reviewers.matches(reviewers)
+			if err != nil {
+				condition.Reason = fmt.Sprintf("the reviewers couldn't be looked up: %v", err)
+			}
+		}
+		trace = append(trace, condition)
+	}
+	return trace
+}
+
+// needsLookup reports whether the author's username or group has to be looked up in GitLab
+func (a *Author) needsLookup(adaptor GitLabAdaptor) bool {
+	participant, ok := adaptor.(Participant)
+	if !ok {
+		return false
+	}
+	_, known := participant.knownAuthor()
+	return !known || a.Group != ""
+}
+
+// explain compares the author with the usernames, then their group. The username is only looked up
+// when the webhook doesn't include it, and their group only when the usernames match
+func (a *Author) explain(adaptor GitLabAdaptor, finder UserFinder) ConditionTrace {
+	condition := ConditionTrace{Condition: "author", Expected: a}
+	participant, ok := adaptor.(Participant)
+	if !ok {
+		condition.Reason = "the webhook is not an issue or merge request"
+		return condition
+	}
+	username, known := participant.knownAuthor()
+	if !known {
+		if finder == nil {
+			condition.Reason = "the author can't be looked up without a GitLab client"
+			return condition
+		}
+		var err error
+		if username, err = finder.Username(participant.authorID()); err != nil {
+			condition.Reason = fmt.Sprintf("the author couldn't be looked up: %v", err)
+			return condition
+		}
+	}
+	condition.Actual = username
+	lowered := []string{strings.ToLower(username)}
+	if len(a.Include) > 0 {
+		if matched, _ := labelsMatch(labelMatchAny, a.Include, lowered); !matched {
+			condition.Reason = "the author isn't one of the included users"
+			return condition
+		}
+	}
+	if excluded, _ := forbiddenLabelPresent(a.Exclude, lowered); excluded {
+		condition.Reason = "the author is one of the excluded users"
+		return condition
+	}
+	if a.Group != "" {
+		if finder == nil {
+			condition.Reason = "the author's groups can't be looked up without a GitLab client"
+			return condition
+		}
+		member, err := finder.InGroup(a.Group, participant.authorID())
+		if err != nil {
+			condition.Reason = fmt.Sprintf("the author's membership couldn't be looked up: %v", err)
+			return condition
+		}
+		if !member {
+			condition.Reason = "the author isn't a member of " + a.Group
+			return condition
+		}
+	}
+	condition.Passed = true
+	return condition
+}
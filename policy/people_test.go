@@ -0,0 +1,167 @@
+package policy
+
+import (
+	"errors"
+	"github.com/xanzy/go-gitlab"
+	"reflect"
+	"testing"
+)
+
+// userFinder is a UserFinder for tests
+type userFinder struct {
+	usernames map[int]string
+	groups    map[string][]int
+	reviewers []string
+	// open are the open merge requests of each user id
+	open    map[int]int
+	err     error
+	lookups int
+}
+
+func (f *userFinder) Username(id int) (string, error) {
+	f.lookups++
+	return f.usernames[id], f.err
+}
+
+func (f *userFinder) InGroup(group string, id int) (bool, error) {
+	for _, member := range f.groups[group] {
+		if member == id {
+			return true, f.err
+		}
+	}
+	return false, f.err
+}
+
+func (f *userFinder) Reviewers(project, mergeRequest int) ([]string, error) {
+	f.lookups++
+	return f.reviewers, f.err
+}
+
+func (f *userFinder) UserID(username string) (int, error) {
+	for id, name := range f.usernames {
+		if name == username {
+			return id, f.err
+		}
+	}
+	return 0, errors.New("404 Not Found")
+}
+
+func (f *userFinder) OpenMergeRequests(id int, reviewing bool) (int, error) {
+	return f.open[id], f.err
+}
+
+func TestPeopleValidate(t *testing.T) {
+	data := []struct {
+		name          string
+		conditions    PeopleConditions
+		eventType     gitlab.EventType
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "Author", conditions: PeopleConditions{Author: &Author{Exclude: []string{"*-bot"}, Group: "org/team"}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: true, errMsg: "expected nil for an author with usernames and a group"},
+		{name: "Empty Author", conditions: PeopleConditions{Author: &Author{}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as the author has nothing to match"},
+		{name: "Invalid Username Pattern", conditions: PeopleConditions{Author: &Author{Include: []string{"/[/"}}}, eventType: gitlab.EventTypeIssue, expectedIsNil: false, errMsg: "expected an error as the regular expression doesn't compile"},
+		{name: "Issue Assignees", conditions: PeopleConditions{Assignee: "jonny", Assignees: presenceAny}, eventType: gitlab.EventTypeIssue, expectedIsNil: true, errMsg: "expected nil as issues have assignees"},
+		{name: "Unknown Presence", conditions: PeopleConditions{Assignees: "some"}, eventType: gitlab.EventTypeIssue, expectedIsNil: false, errMsg: "expected an error for an unknown option"},
+		{name: "Issue Reviewers", conditions: PeopleConditions{Reviewers: presenceNone}, eventType: gitlab.EventTypeIssue, expectedIsNil: false, errMsg: "expected an error as issues don't have reviewers"},
+		{name: "Note Author", conditions: PeopleConditions{Author: &Author{Include: []string{"jonny"}}}, eventType: gitlab.EventTypeNote, expectedIsNil: false, errMsg: "expected an error as notes aren't issues or merge requests"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := Policy{Resource: Resource{d.eventType}, Conditions: Condition{People: d.conditions}}.Validate()
+			want := expectedIsNil(got)
+			if want != d.expectedIsNil {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestExplainAuthor(t *testing.T) {
+	finder := &userFinder{usernames: map[int]string{5: "Renovate-Bot", 6: "jonny"}, groups: map[string][]int{"org/team": {6}}}
+	data := []struct {
+		name     string
+		author   Author
+		authorID int
+		expected bool
+	}{
+		{name: "Excluded Bot", author: Author{Exclude: []string{"*-bot"}}, authorID: 5, expected: false},
+		{name: "Not Excluded", author: Author{Exclude: []string{"*-bot"}}, authorID: 6, expected: true},
+		{name: "Included", author: Author{Include: []string{"jonny", "sam"}}, authorID: 6, expected: true},
+		{name: "Not Included", author: Author{Include: []string{"sam"}}, authorID: 6, expected: false},
+		{name: "Group Member", author: Author{Group: "org/team"}, authorID: 6, expected: true},
+		{name: "Not a Group Member", author: Author{Group: "org/team"}, authorID: 5, expected: false},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			adaptor := stubMergeEventAdaptor()
+			adaptor.ObjectAttributes.AuthorID = d.authorID
+			got := d.author.explain(adaptor, finder)
+			if got.Passed != d.expected {
+				t.Errorf("expected %v, got %+v", d.expected, got)
+			}
+			if !got.Passed && got.Reason == "" {
+				t.Errorf("expected a reason when the author doesn't match")
+			}
+		})
+	}
+}
+
+func TestExplainKnownAuthor(t *testing.T) {
+	adaptor := stubIssueEventAdaptor()
+	adaptor.ObjectAttributes.AuthorID = 6
+	adaptor.User = &gitlab.EventUser{ID: 6, Username: "jonny"}
+	finder := &userFinder{}
+	if got := (&Author{Include: []string{"jonny"}}).explain(adaptor, finder); !got.Passed || finder.lookups != 0 {
+		t.Errorf("expected the author who triggered the webhook to match without a lookup, got %+v", got)
+	}
+	adaptor.User = &gitlab.EventUser{ID: 7, Username: "sam"}
+	failing := &userFinder{err: errors.New("404 Not Found")}
+	if got := (&Author{Include: []string{"sam"}}).explain(adaptor, failing); got.Passed || got.Reason == "" {
+		t.Errorf("expected the failed lookup of another author to be explained, got %+v", got)
+	}
+}
+
+func TestAssignees(t *testing.T) {
+	me := stubMergeEventAdaptor()
+	me.ObjectAttributes.Assignee = &gitlab.EventUser{Username: "jonny"}
+	if got := me.assignees(); !reflect.DeepEqual(got, []string{"jonny"}) {
+		t.Errorf("expected the single assignee to be used without the assignees, got %v", got)
+	}
+	me.Assignees = []*gitlab.EventUser{{Username: "sam"}, {Username: "jonny"}}
+	if got := me.assignees(); !reflect.DeepEqual(got, []string{"sam", "jonny"}) {
+		t.Errorf("expected every assignee, got %v", got)
+	}
+	ie := stubIssueEventAdaptor()
+	ie.Assignees = &[]gitlab.EventUser{{Username: "sam"}}
+	if got := ie.assignees(); !reflect.DeepEqual(got, []string{"sam"}) {
+		t.Errorf("expected the issue's assignees, got %v", got)
+	}
+}
+
+func TestExplainPeople(t *testing.T) {
+	adaptor := stubMergeEventAdaptor()
+	adaptor.Assignees = []*gitlab.EventUser{{Username: "Jonny"}}
+	finder := &userFinder{reviewers: []string{}}
+	data := []struct {
+		name       string
+		conditions PeopleConditions
+		options    Options
+		expected   bool
+	}{
+		{name: "Assignee", conditions: PeopleConditions{Assignee: "@jonny"}, options: Options{Users: finder}, expected: true},
+		{name: "Another Assignee", conditions: PeopleConditions{Assignee: "sam"}, options: Options{Users: finder}, expected: false},
+		{name: "Any Assignees", conditions: PeopleConditions{Assignees: presenceAny}, options: Options{Users: finder}, expected: true},
+		{name: "No Assignees", conditions: PeopleConditions{Assignees: presenceNone}, options: Options{Users: finder}, expected: false},
+		{name: "No Reviewers", conditions: PeopleConditions{Reviewers: presenceNone}, options: Options{Users: finder}, expected: true},
+		{name: "Reviewers Without a Finder", conditions: PeopleConditions{Reviewers: presenceNone}, options: Options{}, expected: false},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			pol := Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{People: d.conditions}}
+			if got := explain(pol, adaptor, gitlab.EventTypeMergeRequest, d.options); got.Matched() != d.expected {
+				t.Errorf("expected %v, got %+v", d.expected, got)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package policy
 
 import (
+	"errors"
+	"fmt"
 	"github.com/xanzy/go-gitlab"
 	"strings"
 )
@@ -21,18 +23,55 @@ type Policies struct {
 	Policies []Policy `yaml:"policies"`
 }
 
+// nameErrors reports each Policy without a name, or with the name of an earlier Policy. Limits and
+// loops are counted by name, so policies sharing a name would count against each other
+func (p Policies) nameErrors() map[int]error {
+	errs := map[int]error{}
+	seen := map[string]bool{}
+	for i, pol := range p.Policies {
+		switch {
+		case strings.TrimSpace(pol.Name) == "":
+			errs[i] = errors.New("policies must have a name")
+		case seen[pol.Name]:
+			errs[i] = fmt.Errorf("policy names must be unique, but %q is used more than once", pol.Name)
+		}
+		seen[pol.Name] = true
+	}
+	return errs
+}
+
+// ValidateNames ensures every Policy has a name that no other Policy has
+func (p Policies) ValidateNames() error {
+	errs := p.nameErrors()
+	for i := range p.Policies {
+		if err, ok := errs[i]; ok {
+			return err
+		}
+	}
+	return nil
+}
+
 // Policy is a containing struct that identifies the
 // required policy for a certain webhook
 type Policy struct {
 	Name       string    `yaml:"name"`
 	Resource   Resource  `yaml:",inline"`
 	Conditions Condition `yaml:"conditions,omitempty"`
-	//Limit      *Limit    `yaml:"limit,omitempty"` @todo
+	// Limit caps how many times the Policy's actions can be taken
+	Limit   *Limit `yaml:"limit,omitempty"`
 	Actions Action `yaml:"actions,omitempty"`
 }
 
-func (p Policy) milestone() int {
-	return p.Conditions.Milestone.milestone()
+func (p Policy) date() *Date {
+	return p.Conditions.date()
+}
+
+func (p Policy) milestone() *Milestone {
+	return p.Conditions.milestone()
+}
+
+func (p Policy) note() *Note {
+	return p.Conditions.note()
 }
 
 func (p Policy) resource() gitlab.EventType {
@@ -40,7 +79,27 @@ func (p Policy) resource() gitlab.EventType {
 }
 
 func (p Policy) state() []string {
-	return p.Conditions.State.state()
+	return p.Conditions.state()
+}
+
+func (p Policy) mergeRequestConditions() MergeRequestConditions {
+	return p.Conditions.mergeRequestConditions()
+}
+
+func (p Policy) peopleConditions() PeopleConditions {
+	return p.Conditions.peopleConditions()
+}
+
+func (p Policy) paths() *Paths {
+	return p.Conditions.paths()
+}
+
+func (p Policy) expr() *Expression {
+	return p.Conditions.expr()
+}
+
+func (p Policy) groups() ConditionGroups {
+	return p.Conditions.groups()
 }
 
 // lower a slice so label matching is case-insensitive
@@ -53,101 +112,197 @@ func sliceLower(sl []string) []string {
 }
 
 func (p Policy) labels() []string {
-	return sliceLower(p.Conditions.Labels.Labels)
+	return p.Conditions.labels()
 }
 
 func (p Policy) forbiddenLabels() []string {
-	return sliceLower(p.Conditions.ForbiddenLabels.ForbiddenLabels)
+	return p.Conditions.forbiddenLabels()
+}
+
+func (p Policy) labelMatch() LabelMatch {
+	return p.Conditions.labelMatch()
 }
 
 // Validate validates a Policy's correctness
 func (p Policy) Validate() error {
-	// validate conditions
-	if err := p.Resource.validate(); err != nil {
-		return err
-	}
-	if err := p.Conditions.State.validate(p.Resource.EventType); err != nil {
-		return err
-	}
-	// validate actions
-	if err := p.Actions.validate(p.Resource.EventType); err != nil {
-		return err
+	if errs := p.fieldErrors(); len(errs) > 0 {
+		return errs[0].err
 	}
 	return nil
 }
 
+// fieldError is a validation error along with the path of the field that caused it
+type fieldError struct {
+	field string
+	err   error
+}
+
+// fieldErrors runs every validation of the Policy, rather than stopping at the first error
+func (p Policy) fieldErrors() []fieldError {
+	// validate conditions
+	checks := []fieldError{{field: "resource", err: p.Resource.validate()}}
+	checks = append(checks, p.Conditions.fieldErrors(p.Resource.EventType, "conditions")...)
+	checks = append(checks, []fieldError{
+		{field: "conditions.note", err: p.Conditions.Note.validate(p.Resource.EventType)},
+		{field: "limit", err: p.Limit.validate()},
+		// validate actions
+		{field: "actions.labels", err: p.Actions.validateScopes()},
+		{field: "actions.size", err: p.Actions.Size.fieldValidator(p.Resource.EventType)},
+		{field: "actions.assign", err: p.Actions.Assign.fieldValidator("assign", p.Resource.EventType, p.Conditions.Note)},
+		{field: "actions.assignReviewers", err: p.Actions.AssignReviewers.fieldValidator("assignReviewers", p.Resource.EventType, p.Conditions.Note)},
+		{field: "actions.retry", err: p.Actions.Retry.validate()},
+		{field: "actions.status", err: p.Actions.validateStatus(p.Resource.EventType)},
+	}...)
+	var errs []fieldError
+	for _, check := range checks {
+		if check.err != nil {
+			errs = append(errs, check)
+		}
+	}
+	return errs
+}
+
 // Condition declares what properties and states are required by
 // the webhook to have an action performed on it
 type Condition struct {
 	// Date is a struct to manage date related entries
-	//Date *Date `yaml:"date,omitempty"`
+	Date *Date `yaml:"date,omitempty"`
 	// State is the expected state of the webhook event
 	State *State `yaml:",inline"`
-	// Milestone is the milestone of the issue
-	Milestone *Milestone `yaml:",inline"`
+	// Milestone is the milestone of the issue or merge request, by its id, title or state
+	Milestone *Milestone `yaml:"milestone,omitempty"`
 	// Labels provides an array of required labels for the condition to be met
 	Labels Labels `yaml:",inline"`
 	// ForbiddenLabels is an array of labels that need to all be missing to
 	ForbiddenLabels ForbiddenLabels `yaml:",inline"`
+	// LabelMatch is how Labels are compared with the webhook's labels: `exact`, `all` or `any`, `exact` by default
+	LabelMatch LabelMatch `yaml:"labelMatch,omitempty"`
 	// Discussion provides a struct to manage whether certain discussion properties meet the given condition
 	//Discussion *Discussion `yaml:"discussion,omitempty"` @todo
 	// Note is the contents of a given note/comment on various different events like commit, mr, issue, code snippet
-	Note *Note `yaml:"note"`
+	Note *Note `yaml:"note,omitempty"`
+	// MergeRequest are the conditions on a merge request's branches, title, description and status
+	MergeRequest MergeRequestConditions `yaml:",inline"`
+	// People are the conditions on the author, assignees and reviewers
+	People PeopleConditions `yaml:",inline"`
+	// Paths are the files a merge request must change
+	Paths *Paths `yaml:"paths,omitempty"`
+	// Expr is an expression evaluated against the webhook's payload, for anything the other conditions can't express
+	Expr *Expression `yaml:"expr,omitempty"`
+	// ConditionGroups nest further conditions, combining them with all, any or not
+	ConditionGroups `yaml:",inline"`
 }
 
-// ForbiddenLabels is a list of labels that are missing from an issue and will trigger an action
-type ForbiddenLabels struct {
-	ForbiddenLabels []string `yaml:"forbiddenLabels"`
+// ConditionGroups combine nested conditions, each of them is met alongside the rest of the Condition
+type ConditionGroups struct {
+	// All is met when every one of its conditions is met
+	All []Condition `yaml:"all,omitempty"`
+	// Any is met when at least one of its conditions is met
+	Any []Condition `yaml:"any,omitempty"`
+	// Not is met when its condition isn't
+	Not *Condition `yaml:"not,omitempty"`
+}
+
+func (c Condition) date() *Date {
+	return c.Date
 }
 
-// Date is possible condition that can be used to allow or
-// disallow the behaviour of the Bot see `config.yaml`
-type Date struct {
-	// Attribute can be `created_at` or `updated_at`
-	Attribute DateAttribute `yaml:"attribute"`
-	// Condition can be `older_than` or `newer_than`
-	Condition DateCondition `yaml:"condition"`
-	// IntervalType can be `days`, `weeks`, `months`, `years`
-	IntervalType DateIntervalType `yaml:"intervalType"`
-	// Interval is a numeric representation of the `IntervalType`
-	Interval int `yaml:"interval"`
+func (c Condition) milestone() *Milestone {
+	return c.Milestone.milestone()
 }
 
-// DateAttribute is the updated or created property
-type DateAttribute string
+func (c Condition) note() *Note {
+	return c.Note
+}
 
-//const (
-//	createdAt DateAttribute = "created_at"
-//	updatedAt DateAttribute = "updated_at"
-//)
+func (c Condition) state() []string {
+	return c.State.state()
+}
 
-// DateCondition is the greater than or less than [date] filter
-type DateCondition string
+// labels are kept as written, rather than lower cased, as they can be regular expressions.
+// They're matched case-insensitively by labelsMatch
+func (c Condition) labels() []string {
+	if len(c.Labels.Labels) == 0 {
+		return nil
+	}
+	return c.Labels.Labels
+}
 
-//const (
-//	olderThan DateCondition = "older_than"
-//	newerThan DateCondition = "newer_than"
-//)
+func (c Condition) forbiddenLabels() []string {
+	if len(c.ForbiddenLabels.ForbiddenLabels) == 0 {
+		return nil
+	}
+	return c.ForbiddenLabels.ForbiddenLabels
+}
 
-// DateIntervalType is the type of available interval
-type DateIntervalType string
+func (c Condition) labelMatch() LabelMatch {
+	return c.LabelMatch
+}
 
-//const (
-//	days   DateIntervalType = "days"
-//	weeks  DateIntervalType = "weeks"
-//	months DateIntervalType = "months"
-//	years  DateIntervalType = "years"
-//)
+func (c Condition) mergeRequestConditions() MergeRequestConditions {
+	return c.MergeRequest
+}
 
-// issueState represents the possible states an issue can be in
-//type issueState string
+func (c Condition) peopleConditions() PeopleConditions {
+	return c.People
+}
 
-//const (
-//	issueStateOpen   issueState = "open"
-//	issueStateClose  issueState = "close"
-//	issueStateReopen issueState = "reopen"
-//	issueStateUpdate issueState = "update"
-//)
+func (c Condition) paths() *Paths {
+	return c.Paths
+}
+
+func (c Condition) expr() *Expression {
+	return c.Expr
+}
+
+func (c Condition) groups() ConditionGroups {
+	return c.ConditionGroups
+}
+
+// fieldErrors validates the Condition along with every nested Condition, path is where the Condition is in the policy.
+// The note condition is validated with the policy, as it's only allowed at the top of the conditions
+func (c Condition) fieldErrors(eventType gitlab.EventType, path string) []fieldError {
+	errs := []fieldError{
+		{field: path + ".date", err: c.Date.validate()},
+		{field: path + ".state", err: c.State.validate(eventType)},
+		{field: path + ".milestone", err: c.Milestone.validate()},
+		{field: path + ".expr", err: c.Expr.validate(eventType)},
+		{field: path + ".labels", err: validateLabelPatterns(c.Labels.Labels)},
+		{field: path + ".forbiddenLabels", err: validateLabelPatterns(c.ForbiddenLabels.ForbiddenLabels)},
+		{field: path + ".labelMatch", err: c.LabelMatch.validate()},
+	}
+	errs = append(errs, c.MergeRequest.fieldErrors(eventType, path)...)
+	errs = append(errs, fieldError{field: path + ".paths", err: c.Paths.fieldValidator(eventType)})
+	errs = append(errs, c.People.fieldErrors(eventType, path)...)
+	nested := func(group string, conditions []Condition) {
+		if conditions != nil && len(conditions) == 0 {
+			errs = append(errs, fieldError{field: path + "." + group, err: fmt.Errorf("%s must have at least one condition", group)})
+		}
+		for i, condition := range conditions {
+			errs = append(errs, condition.nestedFieldErrors(eventType, fmt.Sprintf("%s.%s[%d]", path, group, i))...)
+		}
+	}
+	nested("all", c.All)
+	nested("any", c.Any)
+	if c.Not != nil {
+		errs = append(errs, c.Not.nestedFieldErrors(eventType, path+".not")...)
+	}
+	return errs
+}
+
+// nestedFieldErrors validates a Condition within a group, where a note isn't allowed
+func (c Condition) nestedFieldErrors(eventType gitlab.EventType, path string) []fieldError {
+	errs := c.fieldErrors(eventType, path)
+	if c.Note != nil {
+		errs = append(errs, fieldError{field: path + ".note", err: errors.New("note can only be used at the top of the conditions, not within all, any or not")})
+	}
+	return errs
+}
+
+// ForbiddenLabels is a list of labels that are missing from an issue and will trigger an action
+type ForbiddenLabels struct {
+	ForbiddenLabels []string `yaml:"forbiddenLabels"`
+}
 
 // releaseState represents the possible states an releaseState can be in
 //type releaseState string
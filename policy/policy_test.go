@@ -31,6 +31,28 @@ func TestPolicyValidator(t *testing.T) {
 	}
 }
 
+func TestPoliciesValidateNames(t *testing.T) {
+	data := []struct {
+		name          string
+		policies      []Policy
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "Unique names", policies: []Policy{{Name: "first"}, {Name: "second"}}, expectedIsNil: true, errMsg: "expected nil as every policy has its own name"},
+		{name: "Missing name", policies: []Policy{{Name: "first"}, {Name: " "}}, expectedIsNil: false, errMsg: "expected an error as a policy has no name"},
+		{name: "Duplicate names", policies: []Policy{{Name: "first"}, {Name: "first"}}, expectedIsNil: false, errMsg: "expected an error as two policies share a name"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := Policies{Policies: d.policies}.ValidateNames()
+			want := expectedIsNil(got)
+			if want != d.expectedIsNil {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
 func TestPolicyMatcherWithState(t *testing.T) {
 	//: 12
 	state := &State{[]string{string(mergeRequestStateApproved)}}
@@ -0,0 +1,126 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultBackoff is the wait before the first retry when no backoff is given
+	defaultBackoff = time.Second
+	// defaultMaxBackoff caps the wait between retries when no max backoff is given
+	defaultMaxBackoff = time.Minute
+)
+
+// defaultRetryOn are the HTTP statuses retried when none are given
+var defaultRetryOn = []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// Retry configures how an Action's failed updates to GitLab are retried
+type Retry struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int `yaml:"maxAttempts"`
+	// Backoff is the wait before the first retry, it doubles for every retry after that
+	Backoff time.Duration `yaml:"backoff,omitempty"`
+	// MaxBackoff caps the wait between retries
+	MaxBackoff time.Duration `yaml:"maxBackoff,omitempty"`
+	// RetryOn are the HTTP statuses that can be retried. Requests that fail
+	// without a response, such as a timeout, are always retried
+	RetryOn []int `yaml:"retryOn,omitempty"`
+}
+
+// attempts is the total number of attempts allowed, without a Retry an update is only tried once
+func (r *Retry) attempts() int {
+	if r == nil || r.MaxAttempts < 1 {
+		return 1
+	}
+	return r.MaxAttempts
+}
+
+// maxBackoff is the longest wait between retries
+func (r *Retry) maxBackoff() time.Duration {
+	if r != nil && r.MaxBackoff > 0 {
+		return r.MaxBackoff
+	}
+	return defaultMaxBackoff
+}
+
+// backoff is the exponential wait after the given attempt
+func (r *Retry) backoff(attempt int) time.Duration {
+	base, ceiling := defaultBackoff, r.maxBackoff()
+	if r != nil && r.Backoff > 0 {
+		base = r.Backoff
+	}
+	wait := base
+	for i := 1; i < attempt; i++ {
+		wait *= 2
+		if wait >= ceiling {
+			return ceiling
+		}
+	}
+	if wait > ceiling {
+		return ceiling
+	}
+	return wait
+}
+
+// retryable reports whether the error can be retried, along with how long GitLab asked
+// the bot to wait through the `Retry-After` header. Requests that failed without a response
+// are retried, but errors from the bot itself, such as a user that can't be picked, aren't
+// as they'd fail the same way again
+func (r *Retry) retryable(err error) (time.Duration, bool) {
+	var errResp *gitlab.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		var urlErr *url.Error
+		var netErr net.Error
+		return 0, errors.As(err, &urlErr) || errors.As(err, &netErr)
+	}
+	retryOn := defaultRetryOn
+	if r != nil && r.RetryOn != nil {
+		retryOn = r.RetryOn
+	}
+	for _, status := range retryOn {
+		if status == errResp.Response.StatusCode {
+			return retryAfter(errResp.Response.Header.Get("Retry-After")), true
+		}
+	}
+	return 0, false
+}
+
+// retryAfter parses the `Retry-After` header, which is either a number of seconds or a date
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// validate ensures the Retry has sensible values
+func (r *Retry) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.MaxAttempts < 1 {
+		return fmt.Errorf("retry maxAttempts must be at least 1 but received: %d", r.MaxAttempts)
+	}
+	if r.Backoff < 0 || r.MaxBackoff < 0 {
+		return fmt.Errorf("retry backoff and maxBackoff can't be negative")
+	}
+	for _, status := range r.RetryOn {
+		if status < 400 || status > 599 {
+			return fmt.Errorf("retry retryOn only accepts HTTP error statuses but received: %d", status)
+		}
+	}
+	return nil
+}
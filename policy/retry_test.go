@@ -0,0 +1,184 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// setupWithoutRetries is like setup, but the client doesn't retry failed requests itself
+func setupWithoutRetries(t *testing.T) (*http.ServeMux, *httptest.Server, *gitlab.Client) {
+	t.Helper()
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL(server.URL), gitlab.WithoutRetries())
+	if err != nil {
+		server.Close()
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return mux, server, client
+}
+
+func errorResponse(status int, retryAfter string) error {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return &gitlab.ErrorResponse{Response: resp}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	data := []struct {
+		name     string
+		retry    *Retry
+		attempt  int
+		expected time.Duration
+	}{
+		{name: "Default first backoff", retry: nil, attempt: 1, expected: time.Second},
+		{name: "Default doubles", retry: nil, attempt: 3, expected: 4 * time.Second},
+		{name: "Default is capped", retry: nil, attempt: 20, expected: time.Minute},
+		{name: "Custom backoff", retry: &Retry{MaxAttempts: 3, Backoff: 100 * time.Millisecond}, attempt: 2, expected: 200 * time.Millisecond},
+		{name: "Custom cap", retry: &Retry{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 3 * time.Second}, attempt: 3, expected: 3 * time.Second},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if got := d.retry.backoff(d.attempt); got != d.expected {
+				t.Errorf("expected %s but got %s", d.expected, got)
+			}
+		})
+	}
+}
+
+func TestRetryRetryable(t *testing.T) {
+	data := []struct {
+		name       string
+		retry      *Retry
+		err        error
+		expected   bool
+		retryAfter time.Duration
+	}{
+		{name: "Transport error", retry: nil, err: &url.Error{Op: "Put", URL: "https://gitlab.example.com", Err: errors.New("connection refused")}, expected: true},
+		{name: "Local error", retry: nil, err: errors.New("none of the users can be picked"), expected: false},
+		{name: "Wrapped status", retry: nil, err: fmt.Errorf("alice couldn't be looked up: %w", errorResponse(http.StatusServiceUnavailable, "")), expected: true},
+		{name: "Dry run", retry: nil, err: errDryRun, expected: false},
+		{name: "Service unavailable", retry: nil, err: errorResponse(http.StatusServiceUnavailable, ""), expected: true},
+		{name: "Not found", retry: nil, err: errorResponse(http.StatusNotFound, ""), expected: false},
+		{name: "Retry-After seconds", retry: nil, err: errorResponse(http.StatusTooManyRequests, "7"), expected: true, retryAfter: 7 * time.Second},
+		{name: "Custom statuses", retry: &Retry{MaxAttempts: 2, RetryOn: []int{http.StatusConflict}}, err: errorResponse(http.StatusConflict, ""), expected: true},
+		{name: "Custom statuses replace defaults", retry: &Retry{MaxAttempts: 2, RetryOn: []int{http.StatusConflict}}, err: errorResponse(http.StatusServiceUnavailable, ""), expected: false},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			retryAfter, got := d.retry.retryable(d.err)
+			if got != d.expected {
+				t.Errorf("expected retryable to be %v but got %v", d.expected, got)
+			}
+			if retryAfter != d.retryAfter {
+				t.Errorf("expected retry after %s but got %s", d.retryAfter, retryAfter)
+			}
+		})
+	}
+}
+
+func TestRetryValidate(t *testing.T) {
+	data := []struct {
+		name  string
+		retry *Retry
+		valid bool
+	}{
+		{name: "No retry", retry: nil, valid: true},
+		{name: "Valid", retry: &Retry{MaxAttempts: 3, Backoff: time.Second, RetryOn: []int{503}}, valid: true},
+		{name: "No attempts", retry: &Retry{}, valid: false},
+		{name: "Negative backoff", retry: &Retry{MaxAttempts: 2, Backoff: -time.Second}, valid: false},
+		{name: "Success status", retry: &Retry{MaxAttempts: 2, RetryOn: []int{200}}, valid: false},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if err := d.retry.validate(); (err == nil) != d.valid {
+				t.Errorf("expected valid to be %v but got error: %v", d.valid, err)
+			}
+		})
+	}
+}
+
+func TestExecuteWithRetry(t *testing.T) {
+	mux, server, client := setupWithoutRetries(t)
+	defer teardown(server)
+
+	me := stubMergeEventAdaptor()
+	requests := 0
+	mux.HandleFunc(stubUpdatedMergeEventEndPoint(me)+"/notes", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 1}`))
+	})
+
+	var waits []time.Duration
+	opts := Options{sleep: func(d time.Duration) { waits = append(waits, d) }}
+
+	t.Run("Retries until it succeeds", func(t *testing.T) {
+		action := Action{Comment: "retried", Retry: &Retry{MaxAttempts: 3, Backoff: time.Second}}
+		got := me.execute(action, client, opts)
+		if len(got) != 1 {
+			t.Fatalf("expected 1 result but got %d", len(got))
+		}
+		if got[0].Error != "" || got[0].Attempts != 2 {
+			t.Errorf("expected success after 2 attempts but got %d attempts with error: %s", got[0].Attempts, got[0].Error)
+		}
+		if len(waits) != 1 || waits[0] != 2*time.Second {
+			t.Errorf("expected a single wait honouring Retry-After but got %v", waits)
+		}
+	})
+
+	t.Run("Gives up when asked to wait longer than the max backoff", func(t *testing.T) {
+		requests, waits = 0, nil
+		action := Action{Comment: "retried", Retry: &Retry{MaxAttempts: 3, MaxBackoff: time.Second}}
+		_, attempts, exhausted, err := executeWithRetry(me.executeNote, action, client, opts)
+		if err == nil || attempts != 1 || !exhausted || len(waits) != 0 {
+			t.Errorf("expected to give up without waiting, got %d attempts, exhausted %v, waits %v and error %v", attempts, exhausted, waits, err)
+		}
+	})
+
+	t.Run("Transport errors are retried", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+		unreachable, err := gitlab.NewClient("", gitlab.WithBaseURL(closed.URL), gitlab.WithoutRetries())
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		waits = nil
+		got := me.execute(Action{Comment: "retried", Retry: &Retry{MaxAttempts: 2}}, unreachable, opts)
+		if got[0].Attempts != 2 || !got[0].exhausted {
+			t.Errorf("expected the unreachable server to be retried, got %+v", got[0])
+		}
+	})
+
+	t.Run("Without a retry it fails once", func(t *testing.T) {
+		requests, waits = 0, nil
+		got := me.execute(Action{Comment: "not retried"}, client, opts)
+		if got[0].Error == "" || got[0].Attempts != 1 || len(waits) != 0 {
+			t.Errorf("expected a single failed attempt but got %d attempts and %d waits", got[0].Attempts, len(waits))
+		}
+	})
+}
+
+func TestRetryUnmarshal(t *testing.T) {
+	var action Action
+	if err := yaml.Unmarshal([]byte("retry:\n  maxAttempts: 3\n  backoff: 2s\n  retryOn: [503]\n"), &action); err != nil {
+		t.Fatalf("failed to unmarshal retry: %v", err)
+	}
+	if action.Retry == nil || action.Retry.MaxAttempts != 3 || action.Retry.Backoff != 2*time.Second || len(action.Retry.RetryOn) != 1 {
+		t.Errorf("expected the retry to be decoded, got %+v", action.Retry)
+	}
+}
@@ -0,0 +1,47 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+)
+
+// simulationBaseURL is the GitLab instance the simulated requests are built for, nothing is ever sent to it
+const simulationBaseURL = "https://gitlab.example.com"
+
+// Simulate runs a saved webhook payload against the policies as a dry run, so no GitLab
+// credentials are needed. There is a WebhookResult for every policy, in the order given, reporting
+// whether it matched and the requests its Action would have made. A note asking the user for help
+// only returns the help reply, as it would in the bot. There are no finders to look anything up in
+// GitLab, so conditions that need a lookup aren't met and assign and size actions fail
+func Simulate(eventType gitlab.EventType, payload []byte, policies []Policy, user string) ([]WebhookResult, error) {
+	event, err := ParseWebhook(eventType, payload)
+	if err != nil {
+		return nil, fmt.Errorf("webhook could not be decoded: %v", err)
+	}
+	if _, ok := newAdaptor(event); !ok {
+		return nil, fmt.Errorf("webhooks of type %s are not supported", eventType)
+	}
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL(simulationBaseURL), gitlab.WithoutRetries())
+	if err != nil {
+		return nil, err
+	}
+
+	w := Webhook{EventType: eventType, Event: event}
+	opts := Options{DryRun: true}
+	if help, ok := w.Help(user, policies, client, opts); ok {
+		return []WebhookResult{help}, nil
+	}
+
+	in := make(chan Policy)
+	go func() {
+		defer close(in)
+		for _, pol := range policies {
+			in <- pol
+		}
+	}()
+	var results []WebhookResult
+	for result := range w.FilterEvent(in, client, opts) {
+		results = append(results, result)
+	}
+	return results, nil
+}
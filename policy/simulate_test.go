@@ -0,0 +1,73 @@
+package policy
+
+import (
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	payload := []byte(`{"object_kind":"merge_request","project":{"id":1},"object_attributes":{"iid":7,"action":"open"},"labels":[{"title":"bug"}]}`)
+	policies := []Policy{
+		{Name: "label bugs", Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{Labels: Labels{[]string{"bug"}}}, Actions: Action{Comment: "thanks"}},
+		{Name: "issues only", Resource: Resource{gitlab.EventTypeIssue}, Actions: Action{Comment: "never"}},
+	}
+
+	got, err := Simulate(gitlab.EventTypeMergeRequest, payload, policies, "quetzal")
+	if err != nil {
+		t.Fatalf("failed to simulate: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected a result for each policy, but got %d", len(got))
+	}
+	if !got[0].Matched || got[0].Policy.Name != "label bugs" || len(got[0].Actions) != 1 {
+		t.Fatalf("expected the first policy to match with 1 update, got %+v", got[0])
+	}
+	request := got[0].Actions[0].Request
+	if !got[0].Actions[0].DryRun || request == nil || request.Method != http.MethodPost || request.Endpoint != "/api/v4/projects/1/merge_requests/7/notes" {
+		t.Errorf("expected the note to be recorded rather than sent, got %+v", got[0].Actions[0])
+	}
+	if got[1].Matched || got[1].Actions != nil {
+		t.Errorf("expected the second policy not to match, got %+v", got[1])
+	}
+
+	t.Run("Help", func(t *testing.T) {
+		note := []byte(`{"object_kind":"note","project_id":1,"object_attributes":{"note":"@quetzal help","noteable_type":"Issue"},"issue":{"iid":3}}`)
+		got, err := Simulate(gitlab.EventTypeNote, note, policies, "quetzal")
+		if err != nil {
+			t.Fatalf("failed to simulate: %v", err)
+		}
+		if len(got) != 1 || got[0].Policy.Name != helpPolicyName {
+			t.Errorf("expected only the help reply, got %+v", got)
+		}
+	})
+
+	t.Run("Lookups", func(t *testing.T) {
+		lookups := []Policy{
+			{Name: "docs", Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{Paths: &Paths{Include: []string{"docs/**"}}}, Actions: Action{Comment: "docs"}},
+			{Name: "assign", Resource: Resource{gitlab.EventTypeMergeRequest}, Actions: Action{Assign: &Assign{Users: []string{"alice"}}}},
+		}
+		got, err := Simulate(gitlab.EventTypeMergeRequest, payload, lookups, "")
+		if err != nil {
+			t.Fatalf("failed to simulate: %v", err)
+		}
+		if got[0].Matched {
+			t.Errorf("expected paths not to be met as nothing is looked up, got %+v", got[0])
+		}
+		if !got[1].Matched || len(got[1].Actions) != 1 || got[1].Actions[0].Error == "" {
+			t.Errorf("expected the assign action to report an error, got %+v", got[1])
+		}
+	})
+
+	t.Run("Invalid payload", func(t *testing.T) {
+		if _, err := Simulate(gitlab.EventTypeMergeRequest, []byte(`{`), policies, ""); err == nil {
+			t.Errorf("expected an invalid payload to fail")
+		}
+	})
+
+	t.Run("Unsupported event", func(t *testing.T) {
+		if _, err := Simulate(gitlab.EventTypePush, []byte(`{"object_kind":"push"}`), policies, ""); err == nil {
+			t.Errorf("expected an unsupported event to fail")
+		}
+	})
+}
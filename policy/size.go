@@ -0,0 +1,129 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"strconv"
+	"strings"
+)
+
+// sizeScope is the scope of the size labels, such as `size::M`
+const sizeScope = "size"
+
+// sizeNames are the sizes from smallest to largest, a merge request larger than every threshold is the last
+var sizeNames = []string{"XS", "S", "M", "L", "XL"}
+
+// defaultSizeLines are the most lines changed for each of the sizes but XL, when the Size doesn't set them
+var defaultSizeLines = []int{10, 30, 100, 500}
+
+// Size is the action labelling a merge request by how much it changes, with one of the scoped labels
+// `size::XS`, `size::S`, `size::M`, `size::L` or `size::XL`. Adding the label replaces any previous size label
+type Size struct {
+	// Lines are the most lines added and removed for XS, S, M and L, anything more is XL.
+	// They're 10, 30, 100 and 500 by default
+	Lines []int `yaml:"lines,omitempty"`
+	// Files are the most files changed for XS, S, M and L. When they're set the merge request
+	// is the larger of its size by lines and its size by files
+	Files []int `yaml:"files,omitempty"`
+	// Ignore are globs of files that aren't counted, such as generated code or lock files
+	Ignore []string `yaml:"ignore,omitempty"`
+}
+
+// diffStats are the lines and files a merge request changes
+type diffStats struct {
+	added   int
+	removed int
+	files   int
+	// overflow is set when GitLab left some of the changes out, as there were too many of them
+	overflow bool
+}
+
+// countDiffStats counts the lines added and removed in the diff of each change, other than the ignored files
+func countDiffStats(mr *gitlab.MergeRequest, ignore []string) (diffStats, error) {
+	ignored, err := pathGlobs(ignore)
+	if err != nil {
+		return diffStats{}, err
+	}
+	stats := diffStats{overflow: mr.Overflow}
+	// the count is capped, such as 1000+, once there are more changes than GitLab returns
+	count, err := strconv.Atoi(strings.TrimSuffix(mr.ChangesCount, "+"))
+	if strings.HasSuffix(mr.ChangesCount, "+") || (err == nil && count > len(mr.Changes)) {
+		stats.overflow = true
+	}
+	for _, change := range mr.Changes {
+		skip := false
+		for _, pattern := range ignored {
+			skip = skip || pattern.MatchString(change.NewPath) || pattern.MatchString(change.OldPath)
+		}
+		if skip {
+			continue
+		}
+		stats.files++
+		for _, line := range strings.Split(change.Diff, "\n") {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				stats.added++
+			case strings.HasPrefix(line, "-"):
+				stats.removed++
+			}
+		}
+	}
+	return stats, nil
+}
+
+// label is the size label for the stats
+func (s *Size) label(stats diffStats) string {
+	// the changes that were left out can't be counted, but there's more than any threshold
+	if stats.overflow {
+		return sizeScope + scopeSeparator + sizeNames[len(sizeNames)-1]
+	}
+	lines := s.Lines
+	if len(lines) == 0 {
+		lines = defaultSizeLines
+	}
+	size := sizeIndex(lines, stats.added+stats.removed)
+	if len(s.Files) > 0 {
+		if bySize := sizeIndex(s.Files, stats.files); bySize > size {
+			size = bySize
+		}
+	}
+	return sizeScope + scopeSeparator + sizeNames[size]
+}
+
+// sizeIndex is the index of the first size the count fits within
+func sizeIndex(thresholds []int, count int) int {
+	for i, max := range thresholds {
+		if count <= max {
+			return i
+		}
+	}
+	return len(sizeNames) - 1
+}
+
+// fieldValidator ensures the Size is only used with merge requests, and that its thresholds grow with each size
+func (s *Size) fieldValidator(eventType gitlab.EventType) error {
+	if s == nil {
+		return nil
+	}
+	if eventType != gitlab.EventTypeMergeRequest {
+		return fmt.Errorf("size can only be used with the %s resource, not %s", gitlab.EventTypeMergeRequest, eventType)
+	}
+	for _, thresholds := range []struct {
+		name   string
+		values []int
+	}{{"lines", s.Lines}, {"files", s.Files}} {
+		if len(thresholds.values) == 0 {
+			continue
+		}
+		if len(thresholds.values) != len(sizeNames)-1 {
+			return fmt.Errorf("size %s must have a threshold for each of %s, but received %d", thresholds.name, strings.Join(sizeNames[:len(sizeNames)-1], ", "), len(thresholds.values))
+		}
+		for i, value := range thresholds.values {
+			if value < 1 || (i > 0 && value <= thresholds.values[i-1]) {
+				return fmt.Errorf("size %s thresholds must be positive and increase with each size, but received: %v", thresholds.name, thresholds.values)
+			}
+		}
+	}
+	_, err := pathGlobs(s.Ignore)
+	return err
+}
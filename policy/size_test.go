@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// diff builds a diff adding and removing the number of lines
+func diff(added, removed int) string {
+	return "@@ -1 +1 @@\n" + strings.Repeat("-old\n", removed) + strings.Repeat("+new\n", added)
+}
+
+// changedMergeRequest decodes a merge request that changes main.go by the diff
+func changedMergeRequest(t *testing.T, diff string) *gitlab.MergeRequest {
+	mr := &gitlab.MergeRequest{}
+	if err := json.Unmarshal([]byte(fmt.Sprintf(`{"changes": [{"old_path": "main.go", "new_path": "main.go", "diff": %q}]}`, diff)), mr); err != nil {
+		t.Fatalf("failed to decode changes: %v", err)
+	}
+	return mr
+}
+
+func TestSizeLabel(t *testing.T) {
+	data := []struct {
+		name     string
+		size     Size
+		stats    diffStats
+		expected string
+	}{
+		{name: "Default XS", size: Size{}, stats: diffStats{added: 4, removed: 6, files: 1}, expected: "size::XS"},
+		{name: "Default M", size: Size{}, stats: diffStats{added: 60, removed: 20, files: 3}, expected: "size::M"},
+		{name: "Default XL", size: Size{}, stats: diffStats{added: 501, files: 2}, expected: "size::XL"},
+		{name: "Custom Lines", size: Size{Lines: []int{1, 2, 3, 4}}, stats: diffStats{added: 3}, expected: "size::M"},
+		{name: "Larger by Files", size: Size{Files: []int{1, 5, 10, 20}}, stats: diffStats{added: 2, files: 12}, expected: "size::L"},
+		{name: "Larger by Lines", size: Size{Files: []int{1, 5, 10, 20}}, stats: diffStats{added: 200, files: 1}, expected: "size::L"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if got := d.size.label(d.stats); got != d.expected {
+				t.Errorf("expected %s, got %s", d.expected, got)
+			}
+		})
+	}
+}
+
+func TestCountDiffStats(t *testing.T) {
+	mr := &gitlab.MergeRequest{}
+	if err := json.Unmarshal([]byte(fmt.Sprintf(`{"changes": [
+		{"old_path": "main.go", "new_path": "main.go", "diff": %q},
+		{"old_path": "api/api.pb.go", "new_path": "api/api.pb.go", "diff": %q},
+		{"old_path": "go.sum", "new_path": "go.sum", "diff": %q}
+	]}`, diff(3, 2), diff(400, 100), diff(20, 0))), mr); err != nil {
+		t.Fatalf("failed to decode changes: %v", err)
+	}
+	stats, err := countDiffStats(mr, []string{"**/*.pb.go", "go.sum"})
+	if err != nil || stats != (diffStats{added: 3, removed: 2, files: 1}) {
+		t.Errorf("expected only main.go to be counted, got %+v and error %v", stats, err)
+	}
+}
+
+func TestCountDiffStatsOverflow(t *testing.T) {
+	data := []struct {
+		name     string
+		count    string
+		overflow bool
+		expected bool
+	}{
+		{name: "Every change returned", count: "1", expected: false},
+		{name: "Overflow set", count: "1", overflow: true, expected: true},
+		{name: "More changes than returned", count: "3", expected: true},
+		{name: "Capped count", count: "1000+", expected: true},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			mr := changedMergeRequest(t, diff(1, 0))
+			mr.ChangesCount, mr.Overflow = d.count, d.overflow
+			stats, err := countDiffStats(mr, nil)
+			if err != nil || stats.overflow != d.expected {
+				t.Errorf("expected overflow to be %v, got %+v and error %v", d.expected, stats, err)
+			}
+			if d.expected && (&Size{}).label(stats) != "size::XL" {
+				t.Errorf("expected a merge request with changes left out to be XL")
+			}
+		})
+	}
+}
+
+func TestSizeValidate(t *testing.T) {
+	data := []struct {
+		name          string
+		actions       Action
+		eventType     gitlab.EventType
+		expectedIsNil bool
+		errMsg        string
+	}{
+		{name: "Defaults", actions: Action{Size: &Size{}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: true, errMsg: "expected nil for the default thresholds"},
+		{name: "Custom", actions: Action{Size: &Size{Lines: []int{5, 50, 250, 1000}, Files: []int{1, 5, 15, 40}, Ignore: []string{"**/*.pb.go"}}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: true, errMsg: "expected nil for custom thresholds"},
+		{name: "Issue Hook", actions: Action{Size: &Size{}}, eventType: gitlab.EventTypeIssue, expectedIsNil: false, errMsg: "expected an error as issues don't have a size"},
+		{name: "Too Few Thresholds", actions: Action{Size: &Size{Lines: []int{10, 100}}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error without a threshold for each size"},
+		{name: "Decreasing Thresholds", actions: Action{Size: &Size{Files: []int{10, 5, 20, 30}}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as the thresholds decrease"},
+		{name: "Size Label Alongside", actions: Action{Size: &Size{}, Labels: Labels{[]string{"size::S"}}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as the size label is also added"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := Policy{Resource: Resource{d.eventType}, Actions: d.actions}.Validate()
+			want := expectedIsNil(got)
+			if want != d.expectedIsNil {
+				t.Errorf(d.errMsg)
+			}
+		})
+	}
+}
+
+func TestExecuteSizeLabel(t *testing.T) {
+	mux, server, client := setup(t)
+	defer teardown(server)
+
+	me := stubMergeEventAdaptor()
+	me.Labels = []*gitlab.Label{{Name: "size::XS"}, {Name: "backend"}}
+	changes := &changeFinder{diffs: changedMergeRequest(t, diff(40, 10))}
+	var body map[string]string
+	mux.HandleFunc(stubUpdatedMergeEventEndPoint(me), func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if err := json.NewEncoder(w).Encode(&gitlab.MergeRequest{}); err != nil {
+			t.Errorf("failed to encode response")
+		}
+	})
+
+	got := me.execute(Action{Labels: Labels{[]string{"reviewed"}}, Size: &Size{}}, client, Options{Changes: changes})
+	if len(got) != 1 || got[0].Error != "" {
+		t.Fatalf("expected the labels update to succeed, got %+v", got)
+	}
+	if body["add_labels"] != "reviewed,size::M" || body["remove_labels"] != "size::XS" {
+		t.Errorf("expected the size label to replace the previous one alongside the labels, got %v", body)
+	}
+	if !reflect.DeepEqual(got[0].LabelsAdded, []string{"reviewed", "size::M"}) || !reflect.DeepEqual(got[0].LabelsRemoved, []string{"size::XS"}) {
+		t.Errorf("expected the result to report the size label, got %+v", got[0])
+	}
+}
+
+func TestExecuteSizeLabelDryRun(t *testing.T) {
+	_, server, client := setup(t)
+	defer teardown(server)
+
+	me := stubMergeEventAdaptor()
+	changes := &changeFinder{diffs: changedMergeRequest(t, diff(2, 1))}
+	got := me.execute(Action{Size: &Size{}}, client, Options{DryRun: true, Changes: changes})
+	if len(got) != 1 || got[0].Error != "" || got[0].Request == nil {
+		t.Fatalf("expected the labels update to be recorded, got %+v", got)
+	}
+	if !strings.Contains(string(got[0].Request.Body), "size::XS") {
+		t.Errorf("expected the recorded request to add the size label, got %s", got[0].Request.Body)
+	}
+
+	got = me.execute(Action{Size: &Size{}}, client, Options{DryRun: true})
+	if len(got) != 1 || got[0].Error == "" {
+		t.Errorf("expected an error as the changes can't be looked up without a finder, got %+v", got)
+	}
+}
@@ -25,6 +25,16 @@ const (
 	mergeRequestStateMerge      mergeRequestState = "merge"
 )
 
+// issueState represents the possible states an issue can be in
+type issueState string
+
+const (
+	issueStateOpen   issueState = "open"
+	issueStateClose  issueState = "close"
+	issueStateReopen issueState = "reopen"
+	issueStateUpdate issueState = "update"
+)
+
 func (s *State) state() []string {
 	if s == nil {
 		return nil
@@ -39,6 +49,9 @@ func (s *State) validate(eventType gitlab.EventType) error {
 	if eventType == gitlab.EventTypeMergeRequest {
 		return validateMergeRequestState(*s)
 	}
+	if eventType == gitlab.EventTypeIssue || eventType == gitlab.EventConfidentialIssue {
+		return validateIssueState(*s)
+	}
 	return fmt.Errorf("the state was used on an unexpected event type :%s", eventType)
 }
 
@@ -52,3 +65,15 @@ func validateMergeRequestState(s State) error {
 	}
 	return fmt.Errorf("available states for Merge Requests are `%s`, `%s`, `%s`, `%s`, `%s`, `%s`, `%s`", mergeRequestStateOpen, mergeRequestStateClose, mergeRequestStateReopen, mergeRequestStateUpdate, mergeRequestStateApproved, mergeRequestStateUnApproved, mergeRequestStateMerge)
 }
+
+// validates that every given state for IssueEvents is valid
+func validateIssueState(s State) error {
+	for _, state := range s.State {
+		switch issueState(strings.ToLower(state)) {
+		case issueStateOpen, issueStateClose, issueStateReopen, issueStateUpdate:
+			continue
+		}
+		return fmt.Errorf("available states for Issues are `%s`, `%s`, `%s`, `%s`", issueStateOpen, issueStateClose, issueStateReopen, issueStateUpdate)
+	}
+	return nil
+}
@@ -17,6 +17,9 @@ func TestStateFieldValidation(t *testing.T) {
 		{name: "No State Listed", state: nil, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: true, errMsg: "expected nil as no state in policy is valid"},
 		{name: "Valid MergeEvent State", state: &State{State: []string{string(mergeRequestStateOpen)}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: true, errMsg: "expected nil as a MergeEvent can have a state of string(mergeRequestStateOpen)"},
 		{name: "Invalid MergeEvent State", state: &State{State: []string{"invalid"}}, eventType: gitlab.EventTypeMergeRequest, expectedIsNil: false, errMsg: "expected an error as a MergeEvent cannot have a state of invalid"},
+		{name: "Valid IssueEvent State", state: &State{State: []string{string(issueStateOpen), string(issueStateUpdate)}}, eventType: gitlab.EventTypeIssue, expectedIsNil: true, errMsg: "expected nil as an IssueEvent can have a state of open and update"},
+		{name: "Invalid IssueEvent State", state: &State{State: []string{string(issueStateOpen), string(mergeRequestStateMerge)}}, eventType: gitlab.EventTypeIssue, expectedIsNil: false, errMsg: "expected an error as an IssueEvent cannot have a state of merge"},
+		{name: "Valid Confidential IssueEvent State", state: &State{State: []string{string(issueStateClose)}}, eventType: gitlab.EventConfidentialIssue, expectedIsNil: true, errMsg: "expected nil as a confidential IssueEvent can have a state of close"},
 	}
 	for _, d := range data {
 		t.Run(d.name, func(t *testing.T) {
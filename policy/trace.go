@@ -0,0 +1,218 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/xanzy/go-gitlab"
+	"sort"
+	"time"
+)
+
+// ConditionTrace is the outcome of one of a Policy's conditions against a Webhook
+type ConditionTrace struct {
+	// Condition is the name of the condition, as it's written in the policy file
+	Condition string      `json:"condition"`
+	Expected  interface{} `json:"expected"`
+	Actual    interface{} `json:"actual"`
+	Passed    bool        `json:"passed"`
+	// Reason explains the outcome when the expected and actual values don't
+	Reason string `json:"reason,omitempty"`
+	// Children are the traces of the conditions nested within an all, any or not group
+	Children Trace `json:"children,omitempty"`
+}
+
+// Trace explains why a Policy did or didn't match a Webhook, with an entry for each of its conditions
+type Trace []ConditionTrace
+
+// Matched reports whether every condition passed, nested conditions are
+// accounted for by the group they're in
+func (t Trace) Matched() bool {
+	for _, condition := range t {
+		if !condition.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// noteTrace is the part of a comment the note condition is compared against
+type noteTrace struct {
+	Type NoteType `json:"type"`
+	Body string   `json:"body"`
+}
+
+// notEvaluated is the reason given for a condition that would look something up in GitLab
+// when an earlier condition has already failed
+const notEvaluated = "not evaluated, as an earlier condition failed"
+
+// explain compares each of the Policy's conditions with the Webhook Adaptor. Unlike stopping at the
+// first condition that fails, every condition is traced so the whole outcome can be explained, apart
+// from those that look things up in GitLab once another has failed, which are marked as not evaluated.
+// Date conditions are compared with the time from the Options' Clock, which is the same for every condition
+func explain(policy Matcher, adaptor GitLabAdaptor, event gitlab.EventType, opts Options) Trace {
+	now := opts.now()
+	opts.Clock = func() time.Time { return now }
+	trace := Trace{{
+		Condition: "resource",
+		Expected:  policy.resource(),
+		Actual:    event,
+		Passed:    policy.resource() == event,
+	}}
+	trace = append(trace, explainSelf(adaptor, opts)...)
+	opts.skipLookups = !trace.Matched()
+	return append(trace, explainConditions(policy, adaptor, opts)...)
+}
+
+// explainConditions traces the conditions of a Policy, or of a Condition nested within a group
+func explainConditions(policy Conditioner, adaptor GitLabAdaptor, opts Options) Trace {
+	var trace Trace
+	if policy.state() != nil {
+		actual := adaptor.state()[0]
+		trace = append(trace, ConditionTrace{
+			Condition: "state",
+			Expected:  policy.state(),
+			Actual:    actual,
+			Passed:    sliceContains(policy.state(), actual),
+		})
+	}
+
+	if policy.labels() != nil {
+		adaptorLabels := adaptor.labels()
+		sort.Strings(adaptorLabels)
+		condition := ConditionTrace{Condition: "labels", Expected: policy.labels(), Actual: adaptorLabels}
+		condition.Passed, condition.Reason = labelsMatch(policy.labelMatch(), policy.labels(), adaptorLabels)
+		trace = append(trace, condition)
+	}
+
+	if policy.forbiddenLabels() != nil {
+		condition := ConditionTrace{Condition: "forbiddenLabels", Expected: policy.forbiddenLabels(), Actual: adaptor.labels()}
+		present, reason := forbiddenLabelPresent(policy.forbiddenLabels(), adaptor.labels())
+		condition.Passed, condition.Reason = !present, reason
+		trace = append(trace, condition)
+	}
+
+	if policy.note() != nil {
+		condition := ConditionTrace{Condition: "note", Expected: policy.note()}
+		if commenter, ok := adaptor.(Commenter); ok {
+			condition.Actual = noteTrace{Type: commenter.noteType(), Body: commenter.noteBody()}
+			condition.Passed = policy.note().matches(commenter)
+		} else {
+			condition.Reason = "the webhook is not a comment"
+		}
+		trace = append(trace, condition)
+	}
+
+	if date := policy.date(); date != nil {
+		condition := ConditionTrace{
+			Condition: "date",
+			Expected:  fmt.Sprintf("%s (%s)", date, date.threshold(opts.now()).Format(time.RFC3339)),
+			Actual:    adaptor.timestamp(date.Attribute),
+			Passed:    date.matches(adaptor, opts.now()),
+		}
+		if _, ok := parseTimestamp(adaptor.timestamp(date.Attribute)); !ok {
+			condition.Reason = "the webhook's " + string(date.Attribute) + " timestamp could not be parsed"
+		}
+		trace = append(trace, condition)
+	}
+	trace = append(trace, policy.mergeRequestConditions().explain(adaptor)...)
+
+	if expr := policy.expr(); expr != nil {
+		condition := ConditionTrace{Condition: "expr", Expected: expr.String()}
+		value, err := expr.evaluate(adaptor.payload())
+		condition.Actual = value
+		condition.Passed = value == true
+		if err != nil {
+			condition.Reason = fmt.Sprintf("the expression couldn't be evaluated: %v", err)
+		}
+		trace = append(trace, condition)
+	}
+
+	// the conditions that look things up in GitLab come last, so they can be skipped once another has failed
+
+	// go-gitlab will encode a null milestone_id as 0, so a webhook without a milestone has 0.
+	// A policy milestone of 0 means it doesn't care what the webhook has
+	if milestone := policy.milestone(); milestone != nil {
+		condition := ConditionTrace{Condition: "milestone", Expected: milestone.String()}
+		if opts.skipLookups = opts.skipLookups || !trace.Matched(); opts.skipLookups && milestone.needsLookup() {
+			condition.Reason = notEvaluated
+		} else {
+			condition.Passed, condition.Actual, condition.Reason = milestone.matches(adaptor, opts.Milestones, opts.now())
+		}
+		trace = append(trace, condition)
+	}
+
+	if paths := policy.paths(); paths != nil {
+		if opts.skipLookups = opts.skipLookups || !trace.Matched(); opts.skipLookups {
+			trace = append(trace, ConditionTrace{Condition: "paths", Expected: paths, Reason: notEvaluated})
+		} else {
+			trace = append(trace, paths.explain(adaptor, opts.Changes))
+		}
+	}
+
+	opts.skipLookups = opts.skipLookups || !trace.Matched()
+	trace = append(trace, policy.peopleConditions().explain(adaptor, opts.Users, opts.skipLookups)...)
+	return append(trace, explainGroups(policy.groups(), adaptor, opts)...)
+}
+
+// explainGroups traces each of the groups, the children of all and any groups are
+// the trace of each nested Condition, named by its position such as `any[1]`
+func explainGroups(groups ConditionGroups, adaptor GitLabAdaptor, opts Options) Trace {
+	var trace Trace
+	nested := func(name string, conditions []Condition) Trace {
+		var children Trace
+		for i, condition := range conditions {
+			conditionTrace := explainConditions(condition, adaptor, opts)
+			children = append(children, ConditionTrace{
+				Condition: fmt.Sprintf("%s[%d]", name, i),
+				Passed:    conditionTrace.Matched(),
+				Children:  conditionTrace,
+			})
+		}
+		return children
+	}
+
+	if groups.All != nil {
+		children := nested("all", groups.All)
+		condition := ConditionTrace{Condition: "all", Passed: children.Matched(), Children: children}
+		if !condition.Passed {
+			condition.Reason = "not every condition was met"
+		}
+		trace = append(trace, condition)
+	}
+
+	if groups.Any != nil {
+		children := nested("any", groups.Any)
+		condition := ConditionTrace{Condition: "any", Children: children}
+		for _, child := range children {
+			condition.Passed = condition.Passed || child.Passed
+		}
+		if !condition.Passed {
+			condition.Reason = "none of the conditions were met"
+		}
+		trace = append(trace, condition)
+	}
+
+	if groups.Not != nil {
+		children := explainConditions(*groups.Not, adaptor, opts)
+		condition := ConditionTrace{Condition: "not", Passed: !children.Matched(), Children: children}
+		if !condition.Passed {
+			condition.Reason = "the negated conditions were met"
+		}
+		trace = append(trace, condition)
+	}
+	return trace
+}
+
+// Explain traces every policy against the Webhook without taking any of their actions. Of the Options, only
+// the Clock, Self and the Milestones, Changes and Users finders are used, limits and loops aren't counted
+func (w *Webhook) Explain(policies []Policy, opts Options) ([]WebhookResult, bool) {
+	adaptor, ok := newAdaptor(w.Event)
+	if !ok {
+		return nil, false
+	}
+	results := make([]WebhookResult, 0, len(policies))
+	for _, pol := range policies {
+		trace := explain(pol, adaptor, w.EventType, opts)
+		results = append(results, WebhookResult{Policy: pol, Matched: trace.Matched(), Trace: trace})
+	}
+	return results, true
+}
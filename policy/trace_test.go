@@ -0,0 +1,188 @@
+package policy
+
+import (
+	"github.com/xanzy/go-gitlab"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	adaptor := MergeEventAdaptor{gitlab.MergeEvent{}}
+	adaptor.ObjectAttributes.Action = "open"
+	adaptor.ObjectAttributes.MilestoneID = 4
+	adaptor.Labels = []*gitlab.Label{{Name: "bug"}, {Name: "wip"}}
+
+	data := []struct {
+		name     string
+		policy   Policy
+		expected map[string]bool
+		matched  bool
+	}{
+		{
+			name:     "Only the resource",
+			policy:   Policy{Resource: Resource{gitlab.EventTypeMergeRequest}},
+			expected: map[string]bool{"resource": true},
+			matched:  true,
+		},
+		{
+			name: "Every failing condition is traced",
+			policy: Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{
+				State:     &State{[]string{"merge"}},
+				Labels:    Labels{[]string{"bug"}},
+				Milestone: &Milestone{ID: 5},
+			}},
+			expected: map[string]bool{"resource": true, "state": false, "labels": false, "milestone": false},
+		},
+		{
+			name:     "Forbidden label present",
+			policy:   Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{ForbiddenLabels: ForbiddenLabels{[]string{"wip"}}}},
+			expected: map[string]bool{"resource": true, "forbiddenLabels": false},
+		},
+		{
+			name:     "Forbidden labels checked alongside labels",
+			policy:   Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{Labels: Labels{[]string{"bug", "wip"}}, ForbiddenLabels: ForbiddenLabels{[]string{"wip"}}}},
+			expected: map[string]bool{"resource": true, "labels": true, "forbiddenLabels": false},
+		},
+		{
+			name:     "Forbidden labels absent alongside labels",
+			policy:   Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{Labels: Labels{[]string{"bug", "wip"}}, ForbiddenLabels: ForbiddenLabels{[]string{"severity::high"}}}},
+			expected: map[string]bool{"resource": true, "labels": true, "forbiddenLabels": true},
+			matched:  true,
+		},
+		{
+			name: "Any group with one condition met",
+			policy: Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{ConditionGroups: ConditionGroups{
+				Any: []Condition{{Milestone: &Milestone{ID: 5}}, {ForbiddenLabels: ForbiddenLabels{[]string{"severity::high"}}}},
+			}}},
+			expected: map[string]bool{"resource": true, "any": true},
+			matched:  true,
+		},
+		{
+			name: "All group alongside labels checks forbidden labels",
+			policy: Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{
+				Labels:          Labels{[]string{"bug", "wip"}},
+				ConditionGroups: ConditionGroups{All: []Condition{{ForbiddenLabels: ForbiddenLabels{[]string{"wip"}}}}},
+			}},
+			expected: map[string]bool{"resource": true, "labels": true, "all": false},
+		},
+		{
+			name: "Not group",
+			policy: Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{ConditionGroups: ConditionGroups{
+				Not: &Condition{ConditionGroups: ConditionGroups{Any: []Condition{{State: &State{[]string{"merge"}}}, {Milestone: &Milestone{ID: 4}}}}},
+			}}},
+			expected: map[string]bool{"resource": true, "not": false},
+		},
+		{
+			name:     "Date without a timestamp",
+			policy:   Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{Date: &Date{Attribute: createdAt, Condition: olderThan, IntervalType: days, Interval: 1}}},
+			expected: map[string]bool{"resource": true, "date": false},
+		},
+		{
+			name:     "Note on a merge request",
+			policy:   Policy{Resource: Resource{gitlab.EventTypeNote}, Conditions: Condition{Note: &Note{Command: "help"}}},
+			expected: map[string]bool{"resource": false, "note": false},
+		},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			trace := explain(d.policy, adaptor, gitlab.EventTypeMergeRequest, Options{})
+			if len(trace) != len(d.expected) {
+				t.Fatalf("expected %d conditions to be traced, but got %d: %+v", len(d.expected), len(trace), trace)
+			}
+			for _, condition := range trace {
+				passed, ok := d.expected[condition.Condition]
+				if !ok || passed != condition.Passed {
+					t.Errorf("expected %s to have passed %v, but got %+v", condition.Condition, passed, condition)
+				}
+			}
+			if trace.Matched() != d.matched || matcher(d.policy, adaptor, gitlab.EventTypeMergeRequest) != d.matched {
+				t.Errorf("expected matched to be %v", d.matched)
+			}
+		})
+	}
+}
+
+func TestWebhookExplain(t *testing.T) {
+	event := &gitlab.MergeEvent{}
+	event.ObjectAttributes.Action = "open"
+	w := Webhook{EventType: gitlab.EventTypeMergeRequest, Event: event}
+	policies := []Policy{
+		{Name: "open", Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{State: &State{[]string{"open"}}}, Actions: Action{Comment: "not sent"}},
+		{Name: "issues", Resource: Resource{gitlab.EventTypeIssue}},
+	}
+
+	got, ok := w.Explain(policies, Options{})
+	if !ok || len(got) != 2 {
+		t.Fatalf("expected a result for each policy, got %+v", got)
+	}
+	if !got[0].Matched || got[0].Actions != nil || len(got[0].Trace) != 2 {
+		t.Errorf("expected the first policy to match without taking its action, got %+v", got[0])
+	}
+	if got[1].Matched || got[1].Trace[0].Actual != gitlab.EventTypeMergeRequest {
+		t.Errorf("expected the second policy not to match on its resource, got %+v", got[1])
+	}
+
+	if _, ok = (&Webhook{EventType: gitlab.EventTypePush, Event: &gitlab.PushEvent{}}).Explain(policies, Options{}); ok {
+		t.Errorf("expected unsupported webhooks not to be explained")
+	}
+}
+
+func TestExplainGroupChildren(t *testing.T) {
+	adaptor := MergeEventAdaptor{gitlab.MergeEvent{}}
+	adaptor.Labels = []*gitlab.Label{{Name: "bug"}}
+	// has bug AND (missing severity::high OR milestone unset)
+	policy := Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: Condition{
+		Labels: Labels{[]string{"bug"}},
+		ConditionGroups: ConditionGroups{Any: []Condition{
+			{ForbiddenLabels: ForbiddenLabels{[]string{"severity::high"}}},
+			{Milestone: &Milestone{ID: 3}},
+		}},
+	}}
+
+	trace := explain(policy, adaptor, gitlab.EventTypeMergeRequest, Options{})
+	if !trace.Matched() {
+		t.Fatalf("expected the policy to match, got %+v", trace)
+	}
+	group := trace[len(trace)-1]
+	if group.Condition != "any" || len(group.Children) != 2 {
+		t.Fatalf("expected an any group with a child for each condition, got %+v", group)
+	}
+	if first := group.Children[0]; first.Condition != "any[0]" || !first.Passed || first.Children[0].Condition != "forbiddenLabels" {
+		t.Errorf("expected the first condition to pass on its forbidden labels, got %+v", first)
+	}
+	if second := group.Children[1]; second.Condition != "any[1]" || second.Passed || second.Children[0].Condition != "milestone" {
+		t.Errorf("expected the second condition to fail on its milestone, got %+v", second)
+	}
+}
+
+func TestExplainSkipsLookups(t *testing.T) {
+	adaptor := stubMergeEventAdaptor()
+	adaptor.ObjectAttributes.Action = "open"
+	adaptor.ObjectAttributes.MilestoneID = 4
+	adaptor.ObjectAttributes.AuthorID = 6
+	users := &userFinder{usernames: map[int]string{6: "jonny"}, reviewers: []string{}}
+	changes := &changeFinder{paths: []string{"docs/index.md"}}
+	milestones := &milestoneFinder{}
+	opts := Options{Users: users, Changes: changes, Milestones: milestones}
+	conditions := Condition{
+		Milestone: &Milestone{Title: "v1"},
+		Paths:     &Paths{Include: []string{"docs/**"}},
+		People:    PeopleConditions{Author: &Author{Include: []string{"jonny"}}, Reviewers: presenceNone},
+	}
+
+	failing := Policy{Resource: Resource{gitlab.EventTypeMergeRequest}, Conditions: conditions}
+	failing.Conditions.State = &State{[]string{"merge"}}
+	trace := explain(failing, adaptor, gitlab.EventTypeMergeRequest, opts)
+	for _, condition := range trace[2:] {
+		if condition.Passed || condition.Reason != notEvaluated {
+			t.Errorf("expected %s not to be evaluated once the state failed, got %+v", condition.Condition, condition)
+		}
+	}
+	if users.lookups != 0 || changes.sha != "" || milestones.lookups != 0 {
+		t.Errorf("expected nothing to be looked up once the state failed")
+	}
+
+	trace = explain(Policy{Resource: Resource{gitlab.EventTypeIssue}, Conditions: conditions}, adaptor, gitlab.EventTypeMergeRequest, opts)
+	if trace.Matched() || users.lookups != 0 {
+		t.Errorf("expected nothing to be looked up once the resource failed, got %+v", trace)
+	}
+}
@@ -0,0 +1,342 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidationError is a problem found in a policy file, along with where it was found
+type ValidationError struct {
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Policy string `json:"policy,omitempty"`
+	// Field is the path to the field with the problem, such as `policies[0].actions.status`
+	Field string `json:"field,omitempty"`
+	Msg   string `json:"msg"`
+}
+
+// Error formats the ValidationError as `line:column: policy "name": field: message`,
+// the column is left out when it isn't known
+func (v ValidationError) Error() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%d:", v.Line)
+	if v.Column > 0 {
+		fmt.Fprintf(&out, "%d:", v.Column)
+	}
+	if v.Policy != "" {
+		fmt.Fprintf(&out, " policy %q:", v.Policy)
+	}
+	if v.Field != "" {
+		fmt.Fprintf(&out, " %s:", v.Field)
+	}
+	fmt.Fprintf(&out, " %s", v.Msg)
+	return out.String()
+}
+
+// unmarshalerType is used to skip the key checks of types that decode themselves
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// yamlLine finds the line number yaml.v3 puts at the start of its error messages
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+// ValidateYAML checks a policy file without loading it into the bot. Unlike loading the file,
+// which stops at the first problem, every error is reported: yaml that can't be parsed, unknown keys,
+// values of the wrong type and policies that fail validation. The errors are sorted by their position
+func ValidateYAML(body []byte) []ValidationError {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(body, &doc); err != nil {
+		return []ValidationError{yamlError(err.Error(), &doc, "", "")}
+	}
+	root := resolve(&doc)
+	if root == nil || root.Kind == 0 {
+		return []ValidationError{{Line: 1, Column: 1, Msg: "policy file is empty"}}
+	}
+
+	var errs []ValidationError
+	checkKeys(root, reflect.TypeOf(Policies{}), "", "", &errs)
+
+	policies := mappingValue(root, "policies")
+	if policies != nil && policies.Kind == yaml.SequenceNode {
+		var named Policies
+		for i, node := range policies.Content {
+			errs = append(errs, validatePolicyNode(resolve(node), fmt.Sprintf("policies[%d]", i))...)
+			var pol Policy
+			if nameNode := mappingValue(resolve(node), "name"); nameNode != nil {
+				pol.Name = nameNode.Value
+			}
+			named.Policies = append(named.Policies, pol)
+		}
+		nameErrs := named.nameErrors()
+		for i := range named.Policies {
+			err, ok := nameErrs[i]
+			if !ok {
+				continue
+			}
+			at := resolve(policies.Content[i])
+			if nameNode := mappingValue(at, "name"); nameNode != nil {
+				at = nameNode
+			}
+			errs = append(errs, ValidationError{Line: at.Line, Column: at.Column, Policy: named.Policies[i].Name, Field: fmt.Sprintf("policies[%d].name", i), Msg: err.Error()})
+		}
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Line != errs[j].Line {
+			return errs[i].Line < errs[j].Line
+		}
+		return errs[i].Column < errs[j].Column
+	})
+	return errs
+}
+
+// validatePolicyNode decodes a single policy and validates it
+func validatePolicyNode(node *yaml.Node, path string) []ValidationError {
+	name := ""
+	if nameNode := mappingValue(node, "name"); nameNode != nil {
+		name = nameNode.Value
+	}
+	var pol Policy
+	var errs []ValidationError
+	if err := node.Decode(&pol); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return []ValidationError{yamlError(err.Error(), node, name, path)}
+		}
+		// yaml.v3 carries on decoding past type errors, so the rest of the policy can still be validated
+		for _, msg := range typeErr.Errors {
+			errs = append(errs, yamlError(msg, node, name, path))
+		}
+	}
+	for _, fieldErr := range pol.fieldErrors() {
+		if hasErrorWithin(errs, fmt.Sprintf("%s.%s", path, fieldErr.field)) {
+			// the field couldn't be decoded, so its validation error would only repeat that
+			continue
+		}
+		at := node
+		if found := fieldNode(node, fieldErr.field); found != nil {
+			at = found
+		}
+		errs = append(errs, ValidationError{
+			Line:   at.Line,
+			Column: at.Column,
+			Policy: name,
+			Field:  fmt.Sprintf("%s.%s", path, fieldErr.field),
+			Msg:    fieldErr.err.Error(),
+		})
+	}
+	return errs
+}
+
+// hasErrorWithin reports whether any of the errors are for the field or one of its children
+func hasErrorWithin(errs []ValidationError, field string) bool {
+	for _, e := range errs {
+		if e.Field == field || strings.HasPrefix(e.Field, field+".") || strings.HasPrefix(e.Field, field+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkKeys walks the yaml alongside the type it decodes into, reporting any keys the type doesn't have
+func checkKeys(node *yaml.Node, t reflect.Type, path, policy string, errs *[]ValidationError) {
+	node = resolve(node)
+	if node == nil {
+		return
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			fieldPath := joinPath(path, key.Value)
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				*errs = append(*errs, ValidationError{
+					Line:   key.Line,
+					Column: key.Column,
+					Policy: policy,
+					Field:  fieldPath,
+					Msg:    fmt.Sprintf("unknown field %q", key.Value),
+				})
+				continue
+			}
+			checkKeys(value, fieldType, fieldPath, policy, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			itemPolicy := policy
+			if t.Elem() == reflect.TypeOf(Policy{}) {
+				if nameNode := mappingValue(resolve(item), "name"); nameNode != nil {
+					itemPolicy = nameNode.Value
+				}
+			}
+			checkKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), itemPolicy, errs)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			checkKeys(node.Content[i+1], t.Elem(), joinPath(path, node.Content[i].Value), policy, errs)
+		}
+	}
+}
+
+// yamlFields maps each yaml key of the struct to the type of its field, including those of inlined structs
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		inline := false
+		for _, flag := range parts[1:] {
+			if flag == "inline" {
+				inline = true
+			}
+		}
+		if inline {
+			inlined := field.Type
+			for inlined.Kind() == reflect.Ptr {
+				inlined = inlined.Elem()
+			}
+			for key, fieldType := range yamlFields(inlined) {
+				fields[key] = fieldType
+			}
+			continue
+		}
+		key := parts[0]
+		if key == "" {
+			key = strings.ToLower(field.Name)
+		}
+		fields[key] = field.Type
+	}
+	return fields
+}
+
+// fieldIndex splits a key such as `any[1]` into its key and sequence index
+var fieldIndex = regexp.MustCompile(`^(.+)\[(\d+)\]$`)
+
+// fieldNode finds the value of a dot separated field path in a mapping, keys can index into sequences like `any[1]`
+func fieldNode(node *yaml.Node, field string) *yaml.Node {
+	for _, key := range strings.Split(field, ".") {
+		index := -1
+		if match := fieldIndex.FindStringSubmatch(key); match != nil {
+			key = match[1]
+			index, _ = strconv.Atoi(match[2])
+		}
+		node = mappingValue(node, key)
+		if node == nil {
+			return nil
+		}
+		if index >= 0 {
+			if node.Kind != yaml.SequenceNode || index >= len(node.Content) {
+				return nil
+			}
+			node = resolve(node.Content[index])
+		}
+	}
+	return node
+}
+
+// mappingValue returns the value of the key in a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return resolve(node.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// resolve follows documents and aliases to the node holding the content
+func resolve(node *yaml.Node) *yaml.Node {
+	for node != nil {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			if len(node.Content) == 0 {
+				return nil
+			}
+			node = node.Content[0]
+		case yaml.AliasNode:
+			node = node.Alias
+		default:
+			return node
+		}
+	}
+	return nil
+}
+
+// yamlError converts a yaml.v3 error message, using its line number when it has one
+func yamlError(msg string, node *yaml.Node, policy, path string) ValidationError {
+	verr := ValidationError{Line: node.Line, Column: node.Column, Policy: policy, Field: path, Msg: msg}
+	if match := yamlLine.FindStringSubmatch(msg); match != nil {
+		verr.Line, _ = strconv.Atoi(match[1])
+		verr.Column, verr.Field = valueAtLine(node, verr.Line, path)
+		verr.Msg = strings.TrimPrefix(msg, match[0])
+	}
+	if verr.Line == 0 {
+		verr.Line = 1
+	}
+	return verr
+}
+
+// valueAtLine finds the column and field path of the last value on the line, which is the value yaml.v3 couldn't decode
+func valueAtLine(node *yaml.Node, line int, path string) (int, string) {
+	column, field := 0, path
+	var walk func(n *yaml.Node, path string)
+	walk = func(n *yaml.Node, path string) {
+		if n == nil {
+			return
+		}
+		if n.Line == line && n.Column > column {
+			column, field = n.Column, path
+		}
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				walk(n.Content[i+1], joinPath(path, n.Content[i].Value))
+			}
+		case yaml.SequenceNode:
+			for i, item := range n.Content {
+				walk(item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	}
+	walk(node, path)
+	return column, field
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return fmt.Sprintf("%s.%s", path, key)
+}
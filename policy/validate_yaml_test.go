@@ -0,0 +1,149 @@
+package policy
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidateYAML(t *testing.T) {
+	data := []struct {
+		name     string
+		yaml     string
+		expected []ValidationError
+	}{
+		{
+			name: "Valid policy",
+			yaml: `policies:
+  - name: valid
+    resource: Issue Hook
+    actions:
+      status: close
+`,
+		},
+		{
+			name: "Unknown keys",
+			yaml: `policies:
+  - name: typo
+    resource: Issue Hook
+    conditions:
+      labelz: [bug]
+    action:
+      comment: hi
+`,
+			expected: []ValidationError{
+				{Line: 5, Column: 7, Policy: "typo", Field: "policies[0].conditions.labelz", Msg: `unknown field "labelz"`},
+				{Line: 6, Column: 5, Policy: "typo", Field: "policies[0].action", Msg: `unknown field "action"`},
+			},
+		},
+		{
+			name: "Every invalid policy is reported",
+			yaml: `policies:
+  - name: first
+    resource: Merge Request Hook
+    actions:
+      status: reopen
+  - name: second
+    resource: Nope Hook
+`,
+			expected: []ValidationError{
+				{Line: 5, Column: 15, Policy: "first", Field: "policies[0].actions.status", Msg: "merge Request Events only allow for statuses of open, closed, approved"},
+				{Line: 7, Column: 15, Policy: "second", Field: "policies[1].resource"},
+			},
+		},
+		{
+			name: "Wrong type",
+			yaml: `policies:
+  - name: retry
+    resource: Issue Hook
+    actions:
+      retry:
+        maxAttempts: lots
+`,
+			expected: []ValidationError{
+				{Line: 6, Column: 22, Policy: "retry", Field: "policies[0].actions.retry.maxAttempts", Msg: "cannot unmarshal !!str `lots` into int"},
+			},
+		},
+		{
+			name: "Nested conditions",
+			yaml: `policies:
+  - name: nested
+    resource: Issue Hook
+    conditions:
+      any:
+        - labels: [bug]
+        - state: [merge]
+      not:
+        note:
+          command: hi
+      all: []
+`,
+			expected: []ValidationError{
+				{Line: 7, Column: 18, Policy: "nested", Field: "policies[0].conditions.any[1].state"},
+				{Line: 10, Column: 11, Policy: "nested", Field: "policies[0].conditions.not.note", Msg: "note can only be used at the top of the conditions, not within all, any or not"},
+				{Line: 11, Column: 12, Policy: "nested", Field: "policies[0].conditions.all", Msg: "all must have at least one condition"},
+			},
+		},
+		{
+			name: "Missing and duplicate names",
+			yaml: `policies:
+  - name: twice
+    resource: Issue Hook
+  - resource: Issue Hook
+  - name: twice
+    resource: Issue Hook
+`,
+			expected: []ValidationError{
+				{Line: 4, Column: 5, Field: "policies[1].name", Msg: "policies must have a name"},
+				{Line: 5, Column: 11, Policy: "twice", Field: "policies[2].name", Msg: `policy names must be unique, but "twice" is used more than once`},
+			},
+		},
+		{
+			name:     "Invalid yaml",
+			yaml:     "policies:\n  - name: x\n   bad: [\n",
+			expected: []ValidationError{{Line: 1}},
+		},
+		{
+			name:     "Empty file",
+			yaml:     "",
+			expected: []ValidationError{{Line: 1, Column: 1, Msg: "policy file is empty"}},
+		},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			got := ValidateYAML([]byte(d.yaml))
+			if len(got) != len(d.expected) {
+				t.Fatalf("expected %d errors, but got %d: %v", len(d.expected), len(got), got)
+			}
+			for i, expected := range d.expected {
+				if got[i].Line != expected.Line || got[i].Column != expected.Column || got[i].Policy != expected.Policy || got[i].Field != expected.Field {
+					t.Errorf("expected error at %+v, but got %+v", expected, got[i])
+				}
+				if expected.Msg != "" && got[i].Msg != expected.Msg {
+					t.Errorf("expected message %q, but got %q", expected.Msg, got[i].Msg)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateYAMLExample(t *testing.T) {
+	body, err := os.ReadFile("../examples/.policies.yaml")
+	if err != nil {
+		t.Fatalf("failed to read example policies: %v", err)
+	}
+	if errs := ValidateYAML(body); len(errs) != 0 {
+		t.Errorf("expected the example policies to be valid, got %v", errs)
+	}
+}
+
+func TestValidationErrorFormat(t *testing.T) {
+	err := ValidationError{Line: 5, Column: 7, Policy: "typo", Field: "policies[0].action", Msg: `unknown field "action"`}
+	expected := `5:7: policy "typo": policies[0].action: unknown field "action"`
+	if err.Error() != expected {
+		t.Errorf("expected %s, but got %s", expected, err.Error())
+	}
+	if got := (ValidationError{Line: 1, Msg: "bad"}).Error(); !strings.HasPrefix(got, "1: ") {
+		t.Errorf("expected the column to be left out when unknown, got %s", got)
+	}
+}
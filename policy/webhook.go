@@ -1,8 +1,9 @@
 package policy
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/xanzy/go-gitlab"
-	"sort"
 )
 
 // Webhook is a wrapper around the incoming webhook
@@ -16,74 +17,94 @@ type Webhook struct {
 // WebhookResult returns the Policy that was matched against the Webhook
 // along with an array of actions that the bot tried to take.
 type WebhookResult struct {
-	Policy  Policy               `json:"policy"`
+	Policy Policy `json:"policy"`
+	// Matched reports whether the Policy's conditions were met, and so its Action was taken
+	Matched bool                 `json:"matched"`
 	Actions []GitLabUpdateResult `json:"actions"`
+	// Trace explains the outcome of each of the Policy's conditions
+	Trace Trace  `json:"trace,omitempty"`
+	Error string `json:"error,omitempty"`
 }
 
 // FilterEvent takes a channel of Policy to check against the incoming Webhook
 // If a Policy has conditions that are met by the Webhook, the Policy Action(s)
-// are triggered, which normally results in the gitlab.Client making updates to GitLab
-func (w *Webhook) FilterEvent(in <-chan Policy, client *gitlab.Client) <-chan WebhookResult {
+// are triggered, which normally results in the gitlab.Client making updates to GitLab,
+// unless Options.DryRun is set in which case the requests are only recorded
+func (w *Webhook) FilterEvent(in <-chan Policy, client *gitlab.Client, opts Options) <-chan WebhookResult {
 	processed := make(chan WebhookResult)
 	go func() {
+		adaptor, ok := newAdaptor(w.Event)
 		for pol := range in {
-			result := WebhookResult{Policy: pol}
-			switch ev := w.Event.(type) {
-			case *gitlab.MergeEvent:
-				me := MergeEventAdaptor{*ev}
-				if matcher(pol, me, w.EventType) {
-					result.Actions = me.execute(pol.Actions, client)
+			if !ok {
+				continue
+			}
+			result := WebhookResult{Policy: pol, Trace: explain(pol, adaptor, w.EventType, opts)}
+			// the loop and limit are only counted once every condition has been met, the loop first
+			// so a halted policy doesn't use up its limit
+			if result.Trace.Matched() {
+				if loop := w.loop(pol, adaptor, opts); loop != nil {
+					result.Trace = append(result.Trace, *loop)
+				}
+			}
+			if result.Trace.Matched() {
+				if limit := w.limit(pol, adaptor, opts); limit != nil {
+					result.Trace = append(result.Trace, *limit)
 				}
-				processed <- result
 			}
+			if result.Trace.Matched() {
+				result.Matched = true
+				result.Actions = adaptor.execute(w.action(pol, adaptor), client, opts)
+				if err := w.deadLetters(pol, result.Actions, opts.DeadLetters); err != nil {
+					result.Error = fmt.Sprintf("failed updates could not be stored: %v", err)
+				}
+			}
+			processed <- result
 		}
 		close(processed)
 	}()
 	return processed
 }
 
-// matcher compares the Policy with the Webhook Adaptor and ultimately decides
-// whether to process the Action
-// @todo break this up to reduce number of return sites.
-func matcher(policy Matcher, adaptor GitLabAdaptor, event gitlab.EventType) bool {
-	if policy.resource() != event {
-		return false
-	}
-	if policy.state() != nil {
-		if !sliceContains(policy.state(), adaptor.state()[0]) {
-			return false
-		}
+// ParseWebhook decodes the payload of a webhook as gitlab.ParseWebhook does, apart from comments on
+// merge requests, which are decoded as a MergeCommentEvent so the merge request's labels are kept
+func ParseWebhook(eventType gitlab.EventType, payload []byte) (interface{}, error) {
+	event, err := gitlab.ParseWebhook(eventType, payload)
+	if err != nil {
+		return nil, err
 	}
-	if policy.labels() != nil {
-		sort.Slice(policy.labels(), func(i, j int) bool {
-			return policy.labels()[i] < policy.labels()[j]
-		})
-		adaptorLabels := adaptor.labels()
-		sort.Slice(adaptorLabels, func(i, j int) bool {
-			return adaptorLabels[i] < adaptorLabels[j]
-		})
-		if !slicesMatch(policy.labels(), adaptorLabels) {
-			return false
+	if _, ok := event.(*gitlab.MergeCommentEvent); ok {
+		comment := &MergeCommentEvent{}
+		if err = json.Unmarshal(payload, comment); err != nil {
+			return nil, err
 		}
+		return comment, nil
 	}
-	// if labels is not nil, forbidden labels won't be triggered
-	if policy.labels() == nil && policy.forbiddenLabels() != nil {
-		for _, forbidden := range policy.forbiddenLabels() {
-			if sliceContains(adaptor.labels(), forbidden) {
-				return false
-			}
-		}
+	return event, nil
+}
+
+// newAdaptor wraps the event in its GitLabAdaptor. The bool reports whether the event is supported
+func newAdaptor(event interface{}) (GitLabAdaptor, bool) {
+	switch ev := event.(type) {
+	case *gitlab.MergeEvent:
+		return MergeEventAdaptor{*ev}, true
+	case *gitlab.IssueEvent:
+		return IssueEventAdaptor{*ev}, true
 	}
+	return newNoteEventAdaptor(event)
+}
 
-	// go-gitlab will encode a null milestone_id as 0 the policy methods match this,
-	// therefore if policy and webhook both are 0, it effectively means no milestones were set
-	// if the policy milestone was 0, it means it doesn't care what the webhook has
-	if policy.milestone() > 0 {
-		if policy.milestone() != adaptor.milestone() {
-			return false
-		}
+// action returns the Policy's Action, notes have any command arguments rendered into it
+func (w *Webhook) action(pol Policy, adaptor GitLabAdaptor) Action {
+	if ne, ok := adaptor.(NoteEventAdaptor); ok {
+		return pol.Conditions.Note.action(pol.Actions, ne)
 	}
-	return true
+	return pol.Actions
+}
+
+// matcher compares the Policy with the Webhook Adaptor and ultimately decides
+// whether to process the Action, explain provides the reasons behind the decision
+func matcher(policy Matcher, adaptor GitLabAdaptor, event gitlab.EventType) bool {
+	return explain(policy, adaptor, event, Options{}).Matched()
 }
 
 // checks if two slices match exactly. Expects the slices to have been sorted
@@ -6,6 +6,7 @@ import (
 	"github.com/xanzy/go-gitlab"
 	"go.uber.org/goleak"
 	"net/http"
+	"reflect"
 	"sort"
 	"testing"
 )
@@ -73,7 +74,7 @@ func TestWebhookFilter(t *testing.T) {
 				defer close(ch)
 				ch <- d.policy
 			}()
-			got := <-d.hook.FilterEvent(ch, client)
+			got := <-d.hook.FilterEvent(ch, client, Options{})
 			if got.Policy.Name != d.policy.Name {
 				t.Errorf("expected policy name to be: %s", d.policy.Name)
 			}
@@ -85,6 +86,93 @@ func TestWebhookFilter(t *testing.T) {
 	}
 }
 
+func TestWebhookFilterNote(t *testing.T) {
+	mux, server, client := setup(t)
+	defer teardown(server)
+
+	noteType := NoteIssue
+	pol := Policy{Name: "reply", Resource: Resource{gitlab.EventTypeNote}, Conditions: Condition{Note: &Note{Type: &noteType, Command: "help"}}, Actions: Action{Comment: "here to help"}}
+	event := &gitlab.IssueCommentEvent{ProjectID: 1}
+	event.Issue.IID = 3
+	event.ObjectAttributes.Note = "@quetzal help"
+	unmatched := &gitlab.IssueCommentEvent{ProjectID: 1}
+	unmatched.ObjectAttributes.Note = "nothing to see"
+
+	mux.HandleFunc(fmt.Sprintf("/api/v4/projects/%d/issues/%d/notes", 1, 3), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(&gitlab.Note{})
+	})
+
+	data := []struct {
+		name            string
+		hook            Webhook
+		expectedActions int
+	}{
+		{name: "Note that matches", hook: Webhook{EventType: gitlab.EventTypeNote, Event: event}, expectedActions: 1},
+		{name: "Note that doesn't match", hook: Webhook{EventType: gitlab.EventTypeNote, Event: unmatched}, expectedActions: 0},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			ch := make(chan Policy)
+			go func() {
+				defer close(ch)
+				ch <- pol
+			}()
+			got := <-d.hook.FilterEvent(ch, client, Options{})
+			if len(got.Actions) != d.expectedActions {
+				t.Errorf("expected %d actions, but got %d", d.expectedActions, len(got.Actions))
+			}
+		})
+	}
+}
+
+func TestWebhookFilterAssignCommand(t *testing.T) {
+	mux, server, client := setupWithoutRetries(t)
+	defer teardown(server)
+
+	noteType := NoteMergeRequest
+	pol := Policy{
+		Name:       "assign from a command",
+		Resource:   Resource{gitlab.EventTypeNote},
+		Conditions: Condition{Note: &Note{Type: &noteType, Command: "@quetzal assign <user:user>"}},
+		Actions:    Action{Assign: &Assign{Users: []string{"{{user}}"}}, Comment: "Assigned @{{user}}"},
+	}
+	if err := pol.Validate(); err != nil {
+		t.Fatalf("expected the policy to be valid, got %v", err)
+	}
+	payload := []byte(`{"object_kind":"note","project_id":1,"user":{"username":"dave"},"object_attributes":{"note":"@quetzal assign @carol","noteable_type":"MergeRequest"},"merge_request":{"iid":4}}`)
+	event, err := ParseWebhook(gitlab.EventTypeNote, payload)
+	if err != nil {
+		t.Fatalf("failed to parse webhook: %v", err)
+	}
+
+	var body map[string]interface{}
+	mux.HandleFunc("/api/v4/projects/1/merge_requests/4", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_ = json.NewEncoder(w).Encode(&gitlab.MergeRequest{})
+	})
+	mux.HandleFunc("/api/v4/projects/1/merge_requests/4/notes", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(&gitlab.Note{})
+	})
+
+	ch := make(chan Policy, 1)
+	ch <- pol
+	close(ch)
+	w := Webhook{EventType: gitlab.EventTypeNote, Event: event}
+	got := <-w.FilterEvent(ch, client, Options{Users: stubUserFinder()})
+	if !got.Matched || len(got.Actions) != 2 {
+		t.Fatalf("expected the command to comment and assign, got %+v", got)
+	}
+	assigned := got.Actions[1]
+	if assigned.Update != updateKindAssignees || assigned.Error != "" || !reflect.DeepEqual(assigned.Assigned, []string{"carol"}) {
+		t.Errorf("expected carol to be assigned, got %+v", assigned)
+	}
+	if ids, ok := body["assignee_ids"].([]interface{}); !ok || len(ids) != 1 || ids[0] != float64(3) {
+		t.Errorf("expected carol's id to be sent, got %v", body)
+	}
+}
+
 func TestSlicesMatch(t *testing.T) {
 	var a []string
 	b := []string{"kittens", "puppies"}